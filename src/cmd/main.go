@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // daily quotas need IANA zones even on hosts without them
 
 	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/geo"
+	"dating-backend/internal/handlers"
 	"dating-backend/internal/logging"
+	"dating-backend/internal/metrics"
+	"dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/quota"
 	"dating-backend/internal/realtime"
+	"dating-backend/internal/scheduler"
 	server "dating-backend/internal/server"
+	"dating-backend/internal/storage"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -21,18 +36,247 @@ func main() {
 	defer logging.Sync()
 
 	data_access.InitDB()
+
+	// CLEAR_EXTERNAL_PHOTO_URLS=1 is a one-off migration that drops the
+	// photo_url of users who never uploaded a gallery photo.
+	if os.Getenv("CLEAR_EXTERNAL_PHOTO_URLS") == "1" {
+		if err := data_access.ClearExternalPhotoURLs(); err != nil {
+			logging.Log.Fatalw("failed to clear external photo urls", "err", err)
+		}
+	}
+
+	// Optionally load an offline GeoNames gazetteer for location lookups.
+	// Set GAZETTEER_PATH (for example: "./cities15000.txt") and optionally
+	// GAZETTEER_ADMIN1_PATH ("./admin1CodesASCII.txt") for region names.
+	if path := os.Getenv("GAZETTEER_PATH"); path != "" {
+		g, err := geo.Load(path, os.Getenv("GAZETTEER_ADMIN1_PATH"))
+		if err != nil {
+			logging.Log.Fatalw("failed to load gazetteer", "path", path, "err", err)
+		}
+		geo.Default = g
+		logging.Log.Infof("loaded gazetteer with %d places from %s", g.Len(), path)
+	}
 	mux := server.NewRouter()
 
 	// Optionally use Redis for session tokens. Set REDIS_ADDR env var
 	// (for example: "localhost:6379") to enable Redis-backed session store.
 	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
 		realtime.DefaultSessionStore = realtime.NewRedisSessionStore(&redis.Options{Addr: addr})
-		logging.Log.Infof("using Redis session store at %s", addr)
+		quota.Default.Store = quota.NewRedisStore(&redis.Options{Addr: addr})
+
+		// Route realtime events to users connected to other instances
+		realtime.ChatHub.Broker = realtime.NewRedisBroker(&redis.Options{Addr: addr})
+		realtime.ChatHub.Presence = realtime.NewRedisPresence(&redis.Options{Addr: addr})
+		realtime.ChatHub.InstanceID = instanceID()
+		logging.Log.Infof("using Redis session, quota and realtime store at %s (instance %s)", addr, realtime.ChatHub.InstanceID)
+	}
+
+	// Like quota can be tuned with LIKE_QUOTA (number of likes) and
+	// LIKE_QUOTA_WINDOW ("daily" in the user's timezone, or a duration
+	// such as "12h" for a rolling window).
+	if limit := os.Getenv("LIKE_QUOTA"); limit != "" {
+		p, err := quota.ParsePolicy(limit, os.Getenv("LIKE_QUOTA_WINDOW"))
+		if err != nil {
+			logging.Log.Fatalw("invalid like quota", "err", err)
+		}
+		quota.Default.Policies["like"] = p
+	}
+	// BLUR_LIKES=1 hides who liked a user unless they hold the "see_likes"
+	// entitlement.
+	if os.Getenv("BLUR_LIKES") != "" {
+		handlers.BlurLikesInbox = true
+	}
+
+	// ADMIN_USER_IDS is a comma-separated list of user ids allowed to use
+	// the /admin endpoints.
+	for _, s := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			logging.Log.Fatalw("invalid ADMIN_USER_IDS", "value", s)
+		}
+		middleware.AdminUserIDs[id] = true
+	}
+
+	// MATCH_EXPIRY_DAYS=N expires matches nobody has written in within N
+	// days. MATCH_EXPIRY_WARN (default "24h") is how early both users get a
+	// "match_expiring" event; MATCH_EXPIRY_REMATCH=0 keeps an expired pair
+	// apart for good instead of letting them meet again in discovery.
+	if days := os.Getenv("MATCH_EXPIRY_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			logging.Log.Fatalw("invalid MATCH_EXPIRY_DAYS", "value", days)
+		}
+		expiry := &scheduler.MatchExpiry{
+			After:      time.Duration(n) * 24 * time.Hour,
+			WarnBefore: 24 * time.Hour,
+			Rematch:    os.Getenv("MATCH_EXPIRY_REMATCH") != "0",
+		}
+		if warn := os.Getenv("MATCH_EXPIRY_WARN"); warn != "" {
+			d, err := time.ParseDuration(warn)
+			if err != nil {
+				logging.Log.Fatalw("invalid MATCH_EXPIRY_WARN", "value", warn, "err", err)
+			}
+			expiry.WarnBefore = d
+		}
+		handlers.RematchExpired = expiry.Rematch
+		if err := scheduler.Default.Cron("match_expiry", "@every 1m", expiry.Run); err != nil {
+			logging.Log.Fatalw("failed to schedule match expiry", "err", err)
+		}
+	}
+
+	// Delete login sessions whose refresh token expired.
+	// MAX_SESSIONS_PER_USER caps concurrent logins per user (0 disables).
+	if v := os.Getenv("MAX_SESSIONS_PER_USER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			logging.Log.Fatalw("invalid MAX_SESSIONS_PER_USER", "value", v)
+		}
+		handlers.MaxSessionsPerUser = n
+	}
+	pruneSessions := func(now time.Time, _ *models.Job) error {
+		n, err := data_access.PruneSessions(now)
+		if err != nil {
+			return err
+		}
+		metrics.SessionsPruned.Add(n)
+		return nil
+	}
+	if err := scheduler.Default.Cron("sessions.prune", "@every 15m", pruneSessions); err != nil {
+		logging.Log.Fatalw("failed to schedule session pruning", "err", err)
+	}
+	metrics.Publish("sessions_total", func() any {
+		n, _ := data_access.CountSessions()
+		return n
+	})
+
+	// Free expired one-time WebSocket tokens of the in-memory store; Redis
+	// expires them by itself.
+	if store, ok := realtime.DefaultSessionStore.(*realtime.InMemorySessionStore); ok {
+		store.StartPruning(context.Background(), time.Minute)
 	}
-	realtime.StartPingLoop()
+
+	// WS_SEND_BUFFER is how many events may queue per WebSocket connection;
+	// when it overflows the connection is closed, or with
+	// WS_SLOW_CONSUMER=drop the event is dropped instead.
+	if v := os.Getenv("WS_SEND_BUFFER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			logging.Log.Fatalw("invalid WS_SEND_BUFFER", "value", v)
+		}
+		realtime.ChatHub.SendBuffer = n
+	}
+	if os.Getenv("WS_SLOW_CONSUMER") == "drop" {
+		realtime.ChatHub.SlowConsumer = realtime.DropMessages
+	}
+
+	// Log realtime events so reconnecting clients can catch up. Each user's
+	// log keeps at most WS_EVENT_LOG_SIZE events (0 disables the log) for
+	// WS_EVENT_RETENTION.
+	eventLog := realtime.SQLiteEventLog{MaxPerUser: 500}
+	if v := os.Getenv("WS_EVENT_LOG_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			logging.Log.Fatalw("invalid WS_EVENT_LOG_SIZE", "value", v)
+		}
+		eventLog.MaxPerUser = n
+	}
+	retention := 72 * time.Hour
+	if v := os.Getenv("WS_EVENT_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logging.Log.Fatalw("invalid WS_EVENT_RETENTION", "value", v)
+		}
+		retention = d
+	}
+	if eventLog.MaxPerUser > 0 {
+		realtime.ChatHub.Events = eventLog
+		pruneEvents := func(now time.Time, _ *models.Job) error {
+			n, err := data_access.PruneUserEvents(now.Add(-retention))
+			if err != nil {
+				return err
+			}
+			metrics.WSEventsPruned.Add(n)
+			return nil
+		}
+		if err := scheduler.Default.Cron("ws_events.prune", "@every 15m", pruneEvents); err != nil {
+			logging.Log.Fatalw("failed to schedule event log pruning", "err", err)
+		}
+	}
+
+	// Chat attachments are stored under STORAGE_DIR (default "uploads"), or
+	// with STORAGE_DRIVER=s3 in the S3_BUCKET of an S3-compatible service.
+	// Download links are signed with FILE_URL_SECRET, which all instances
+	// must share, and expire after FILE_URL_TTL (default 1h).
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		if dir := os.Getenv("STORAGE_DIR"); dir != "" {
+			storage.Default = &storage.Local{Dir: dir}
+		}
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		storage.Default = &storage.S3{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    region,
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		}
+		logging.Log.Infof("storing files in S3 bucket %s at %s", os.Getenv("S3_BUCKET"), os.Getenv("S3_ENDPOINT"))
+	default:
+		logging.Log.Fatalw("invalid STORAGE_DRIVER", "value", driver)
+	}
+	if secret := os.Getenv("FILE_URL_SECRET"); secret != "" {
+		storage.URLs.Secret = []byte(secret)
+	} else {
+		logging.Log.Warn("FILE_URL_SECRET not set: file links only work on this instance until it restarts")
+	}
+	if v := os.Getenv("FILE_URL_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logging.Log.Fatalw("invalid FILE_URL_TTL", "value", v)
+		}
+		storage.URLs.TTL = d
+	}
+	pruneUploads := func(now time.Time, _ *models.Job) error {
+		_, err := handlers.PruneOrphanUploads(context.Background(), now.Add(-24*time.Hour))
+		return err
+	}
+	if err := scheduler.Default.Cron("uploads.prune", "@every 1h", pruneUploads); err != nil {
+		logging.Log.Fatalw("failed to schedule upload pruning", "err", err)
+	}
+
+	// Presence follows WebSocket connections: matches are told when a user
+	// comes online or goes offline, and last_active is refreshed while the
+	// user stays connected.
+	lastSeen := realtime.NewLastSeen(30 * time.Second)
+	realtime.ChatHub.OnPresence = func(userID int64, online bool) {
+		lastSeen.Touch(time.Now(), userID)
+		handlers.NotifyPresence(userID, online)
+	}
+	lastSeen.Start(context.Background(), time.Minute, realtime.ChatHub.LocalUsers)
+
+	if err := realtime.ChatHub.Start(context.Background()); err != nil {
+		logging.Log.Fatalw("failed to start realtime hub", "err", err)
+	}
+	scheduler.Default.Start(context.Background())
 
 	logging.Log.Infow("server starting", "addr", ":8088")
 	if err := http.ListenAndServe(":8088", mux); err != nil {
 		logging.Log.Fatalw("server exited", "err", err)
 	}
-}
\ No newline at end of file
+}
+
+// instanceID names this process for realtime routing: the host name and a
+// random suffix, so restarts don't inherit a dead instance's presence.
+func instanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,163 @@
+// Package attributes describes the optional profile fields, such as
+// smoking or height, in one declarative schema: their kind, allowed values
+// and who may see them. Validation, display and search filters all follow
+// the schema; a new field only needs an entry in Schema.
+package attributes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"dating-backend/internal/models"
+)
+
+// Kind is how an attribute's values are typed.
+type Kind string
+
+const (
+	Enum Kind = "enum" // one of Values, or several if Multi
+	Int  Kind = "int"  // a whole number between Min and Max
+	Text Kind = "text" // free text up to MaxLen runes, not searchable
+)
+
+// Visibility says who sees an attribute on a profile.
+const (
+	Public  = "public"  // everyone, and it can be searched on
+	Matches = "matches" // only the user's matches
+	Hidden  = "hidden"  // only the user
+)
+
+// Attribute is one optional profile field.
+type Attribute struct {
+	Key        string   `json:"key"`
+	Kind       Kind     `json:"kind"`
+	Values     []string `json:"values,omitempty"`
+	Multi      bool     `json:"multi,omitempty"`
+	Min        int64    `json:"min,omitempty"`
+	Max        int64    `json:"max,omitempty"`
+	MaxLen     int      `json:"max_len,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	Visibility string   `json:"visibility"` // default, users may change it
+}
+
+// Schema lists the profile attributes.
+var Schema = []Attribute{
+	{Key: "occupation", Kind: Text, MaxLen: 100, Visibility: Public},
+	{Key: "education", Kind: Enum, Values: []string{"high_school", "college", "bachelor", "master", "phd"}, Visibility: Public},
+	{Key: "height", Kind: Int, Min: 100, Max: 250, Unit: "cm", Visibility: Public},
+	{Key: "religion", Kind: Enum, Values: []string{"agnostic", "atheist", "buddhist", "christian", "hindu", "jewish", "muslim", "spiritual", "other"}, Visibility: Matches},
+	{Key: "smoking", Kind: Enum, Values: []string{"never", "sometimes", "regularly"}, Visibility: Public},
+	{Key: "drinking", Kind: Enum, Values: []string{"never", "socially", "often"}, Visibility: Public},
+	{Key: "pets", Kind: Enum, Multi: true, Values: []string{"dog", "cat", "bird", "fish", "reptile", "other"}, Visibility: Public},
+	{Key: "children", Kind: Enum, Values: []string{"have", "want", "dont_want", "not_sure"}, Visibility: Public},
+}
+
+// Lookup returns the attribute with the key.
+func Lookup(key string) (*Attribute, bool) {
+	for i := range Schema {
+		if Schema[i].Key == key {
+			return &Schema[i], true
+		}
+	}
+	return nil, false
+}
+
+// ValidVisibility reports whether v is a visibility level.
+func ValidVisibility(v string) bool {
+	return v == Public || v == Matches || v == Hidden
+}
+
+// Parse validates a JSON value sent for the attribute and returns it as
+// stored values. null, "" and [] clear the attribute.
+func (a *Attribute) Parse(raw json.RawMessage) ([]models.AttributeValue, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var values []string
+	switch a.Kind {
+	case Int:
+		var n int64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", a.Key)
+		}
+		if n < a.Min || n > a.Max {
+			return nil, fmt.Errorf("%s must be between %d and %d", a.Key, a.Min, a.Max)
+		}
+		return []models.AttributeValue{{Key: a.Key, Value: strconv.FormatInt(n, 10), Num: &n}}, nil
+	case Text:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("%s must be a string", a.Key)
+		}
+		s = strings.TrimSpace(s)
+		if utf8.RuneCountInString(s) > a.MaxLen {
+			return nil, fmt.Errorf("%s must be at most %d characters", a.Key, a.MaxLen)
+		}
+		if s != "" {
+			values = []string{s}
+		}
+	case Enum:
+		if a.Multi && raw[0] == '[' {
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return nil, fmt.Errorf("%s must be a list of strings", a.Key)
+			}
+		} else {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, fmt.Errorf("%s must be a string", a.Key)
+			}
+			if s != "" {
+				values = []string{s}
+			}
+		}
+		for _, v := range values {
+			if !slices.Contains(a.Values, v) {
+				return nil, fmt.Errorf("%s: unknown value %q", a.Key, v)
+			}
+		}
+		slices.Sort(values)
+		values = slices.Compact(values)
+	}
+
+	out := make([]models.AttributeValue, len(values))
+	for i, v := range values {
+		out[i] = models.AttributeValue{Key: a.Key, Value: v}
+	}
+	return out, nil
+}
+
+// Profile turns a user's stored attributes into the "attributes" of a
+// profile, leaving out those the viewer may not see. Multi-valued
+// attributes are lists, Int ones numbers. It also returns the visibility of
+// every attribute the user set one for, for the user's own profile.
+func Profile(stored []models.AttributeValue, canSee func(visibility string) bool) (values map[string]any, visibility map[string]string) {
+	values = map[string]any{}
+	visibility = map[string]string{}
+	for _, v := range stored {
+		a, ok := Lookup(v.Key)
+		if !ok {
+			continue
+		}
+		visibility[v.Key] = v.Visibility
+		if v.Value == "" || !canSee(v.Visibility) {
+			continue
+		}
+		switch {
+		case a.Multi:
+			list, _ := values[v.Key].([]string)
+			values[v.Key] = append(list, v.Value)
+		case v.Num != nil:
+			values[v.Key] = *v.Num
+		default:
+			values[v.Key] = v.Value
+		}
+	}
+	return values, visibility
+}
@@ -0,0 +1,111 @@
+package attributes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"dating-backend/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		key, raw string
+		want     []string
+		wantErr  bool
+	}{
+		{"height", `180`, []string{"180"}, false},
+		{"height", `90`, nil, true},
+		{"height", `"tall"`, nil, true},
+		{"smoking", `"never"`, []string{"never"}, false},
+		{"smoking", `"always"`, nil, true},
+		{"smoking", `["never"]`, nil, true},
+		{"pets", `["dog", "cat", "dog"]`, []string{"cat", "dog"}, false},
+		{"pets", `"fish"`, []string{"fish"}, false},
+		{"pets", `["unicorn"]`, nil, true},
+		{"pets", `[]`, nil, false},
+		{"occupation", `"  Инженер "`, []string{"Инженер"}, false},
+		{"occupation", `""`, nil, false},
+		{"education", `null`, nil, false},
+	}
+	for _, c := range cases {
+		a, _ := Lookup(c.key)
+		vals, err := a.Parse(json.RawMessage(c.raw))
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s %s: unexpected error %v", c.key, c.raw, err)
+			continue
+		}
+		var got []string
+		for _, v := range vals {
+			got = append(got, v.Value)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %s: got %v, want %v", c.key, c.raw, got, c.want)
+		}
+	}
+
+	a, _ := Lookup("height")
+	if vals, _ := a.Parse(json.RawMessage(`175`)); vals[0].Num == nil || *vals[0].Num != 175 {
+		t.Errorf("expected height stored as a number, got %+v", vals)
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	n := func(v int64) *int64 { return &v }
+	cases := []struct {
+		in      string
+		want    models.AttributeCondition
+		wantErr bool
+	}{
+		{"smoking:never,sometimes", models.AttributeCondition{Key: "smoking", Values: []string{"never", "sometimes"}}, false},
+		{"height:170-190", models.AttributeCondition{Key: "height", Min: n(170), Max: n(190)}, false},
+		{"height:170-", models.AttributeCondition{Key: "height", Min: n(170)}, false},
+		{"height:-190", models.AttributeCondition{Key: "height", Max: n(190)}, false},
+		{"height:180", models.AttributeCondition{Key: "height", Min: n(180), Max: n(180)}, false},
+		{"height:-", models.AttributeCondition{}, true},
+		{"height:tall", models.AttributeCondition{}, true},
+		{"smoking:always", models.AttributeCondition{}, true},
+		{"occupation:engineer", models.AttributeCondition{}, true},
+		{"weight:70", models.AttributeCondition{}, true},
+		{"smoking", models.AttributeCondition{}, true},
+	}
+	for _, c := range cases {
+		got, err := ParseCondition(c.in, false)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: unexpected error %v", c.in, err)
+			continue
+		}
+		if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.in, got, c.want)
+		}
+	}
+	if c, _ := ParseCondition("pets:dog", true); !c.Soft {
+		t.Errorf("expected a soft condition")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	n := int64(180)
+	stored := []models.AttributeValue{
+		{Key: "height", Value: "180", Num: &n, Visibility: Public},
+		{Key: "pets", Value: "cat", Visibility: Public},
+		{Key: "pets", Value: "dog", Visibility: Public},
+		{Key: "religion", Value: "buddhist", Visibility: Matches},
+		{Key: "smoking", Visibility: Hidden},
+		{Key: "retired", Value: "x", Visibility: Public},
+	}
+
+	values, visibility := Profile(stored, func(v string) bool { return v == Public })
+	want := map[string]any{"height": int64(180), "pets": []string{"cat", "dog"}}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+	if len(visibility) != 4 || visibility["smoking"] != Hidden || visibility["religion"] != Matches {
+		t.Errorf("unexpected visibility %v", visibility)
+	}
+
+	values, _ = Profile(stored, func(v string) bool { return v != Hidden })
+	if values["religion"] != "buddhist" {
+		t.Errorf("expected religion shown to matches, got %v", values)
+	}
+}
@@ -0,0 +1,66 @@
+package attributes
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dating-backend/internal/models"
+)
+
+// ParseCondition parses a search condition on an attribute:
+// "smoking:never,sometimes" accepts any of the values, "height:170-190"
+// a range, with either end left open ("height:170-"). soft marks a
+// preference that ranks candidates instead of excluding them. Text
+// attributes can't be searched on.
+func ParseCondition(s string, soft bool) (models.AttributeCondition, error) {
+	key, spec, ok := strings.Cut(s, ":")
+	if !ok || spec == "" {
+		return models.AttributeCondition{}, fmt.Errorf("condition %q must look like key:values", s)
+	}
+	a, found := Lookup(key)
+	if !found {
+		return models.AttributeCondition{}, fmt.Errorf("unknown attribute %q", key)
+	}
+	c := models.AttributeCondition{Key: key, Soft: soft}
+
+	switch a.Kind {
+	case Enum:
+		for _, v := range strings.Split(spec, ",") {
+			if !slices.Contains(a.Values, v) {
+				return c, fmt.Errorf("%s: unknown value %q", key, v)
+			}
+			c.Values = append(c.Values, v)
+		}
+	case Int:
+		lo, hi, ok := strings.Cut(spec, "-")
+		if !ok {
+			lo, hi = spec, spec
+		}
+		var err error
+		if c.Min, err = parseBound(lo); err != nil {
+			return c, fmt.Errorf("%s: invalid range %q", key, spec)
+		}
+		if c.Max, err = parseBound(hi); err != nil {
+			return c, fmt.Errorf("%s: invalid range %q", key, spec)
+		}
+		if c.Min == nil && c.Max == nil {
+			return c, fmt.Errorf("%s: invalid range %q", key, spec)
+		}
+	default:
+		return c, fmt.Errorf("%s can't be searched on", key)
+	}
+	return c, nil
+}
+
+func parseBound(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
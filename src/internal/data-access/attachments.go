@@ -0,0 +1,164 @@
+package data_access
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+// ErrInvalidAttachments is returned by SaveMessage when an attachment id
+// isn't an unsent upload of the sender in the message's chat.
+var ErrInvalidAttachments = errors.New("invalid attachments")
+
+const attachmentColumns = `a.id, a.chat_id, a.uploader_id, a.message_id, a.kind, a.mime, a.size,
+	a.width, a.height, a.blob_key, a.thumb_key, a.created_at`
+
+func scanAttachment(rows *sql.Rows) (models.Attachment, error) {
+	var a models.Attachment
+	var messageID sql.NullInt64
+	err := rows.Scan(&a.ID, &a.ChatID, &a.UploaderID, &messageID, &a.Kind, &a.MIME, &a.Size,
+		&a.Width, &a.Height, &a.Key, &a.ThumbKey, &a.CreatedAt)
+	if messageID.Valid {
+		a.MessageID = &messageID.Int64
+	}
+	return a, err
+}
+
+// CreateAttachment records an uploaded file and fills in its id and
+// created_at.
+func CreateAttachment(a *models.Attachment) error {
+	err := DB.QueryRow(`
+		INSERT INTO attachments (chat_id, uploader_id, kind, mime, size, width, height, blob_key, thumb_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at
+	`, a.ChatID, a.UploaderID, a.Kind, a.MIME, a.Size, a.Width, a.Height, a.Key, a.ThumbKey).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		logging.Log.Errorf("data-access: CreateAttachment error chat=%d uploader=%d: %v", a.ChatID, a.UploaderID, err)
+	}
+	return err
+}
+
+// GetAttachment returns an attachment, or nil if there is none. Files of
+// messages deleted for everyone count as gone.
+func GetAttachment(id int64) (*models.Attachment, error) {
+	rows, err := DB.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		LEFT JOIN messages m ON m.id = a.message_id
+		WHERE a.id = ? AND m.deleted_at IS NULL
+	`, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetAttachment query error id=%d: %v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	a, err := scanAttachment(rows)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetAttachment scan error id=%d: %v", id, err)
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAttachmentsForMessages returns the attachments of the messages, by
+// message id, in upload order.
+func GetAttachmentsForMessages(messageIDs []int64) (map[int64][]models.Attachment, error) {
+	out := map[int64][]models.Attachment{}
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := DB.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.message_id IN (`+placeholders(len(messageIDs))+`)
+		ORDER BY a.id
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetAttachmentsForMessages query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			logging.Log.Errorf("data-access: GetAttachmentsForMessages scan error: %v", err)
+			return nil, err
+		}
+		out[*a.MessageID] = append(out[*a.MessageID], a)
+	}
+	return out, rows.Err()
+}
+
+// linkAttachments attaches the message's uploads to it. Every id must be
+// an upload of the sender into the same chat that no message uses yet.
+func linkAttachments(tx *sql.Tx, msg *models.Message) error {
+	if len(msg.AttachmentIDs) == 0 {
+		return nil
+	}
+	args := []any{msg.ID, msg.SenderID, msg.ChatID}
+	for _, id := range msg.AttachmentIDs {
+		args = append(args, id)
+	}
+	res, err := tx.Exec(`
+		UPDATE attachments SET message_id = ?
+		WHERE uploader_id = ? AND chat_id = ? AND message_id IS NULL
+			AND id IN (`+placeholders(len(msg.AttachmentIDs))+`)
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: linkAttachments error message=%d: %v", msg.ID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != int64(len(msg.AttachmentIDs)) {
+		return ErrInvalidAttachments
+	}
+	return nil
+}
+
+// GetOrphanAttachments returns up to limit uploads older than cutoff that
+// no message was sent with.
+func GetOrphanAttachments(cutoff time.Time, limit int) ([]models.Attachment, error) {
+	rows, err := DB.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.message_id IS NULL AND a.created_at < ?
+		ORDER BY a.created_at
+		LIMIT ?
+	`, sqlTime(cutoff), limit)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetOrphanAttachments query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			logging.Log.Errorf("data-access: GetOrphanAttachments scan error: %v", err)
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// DeleteOrphanAttachment removes an upload's record, unless a message was
+// sent with it in the meantime. deleted reports whether it was removed.
+func DeleteOrphanAttachment(id int64) (deleted bool, err error) {
+	res, err := DB.Exec(`DELETE FROM attachments WHERE id = ? AND message_id IS NULL`, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteOrphanAttachment error id=%d: %v", id, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
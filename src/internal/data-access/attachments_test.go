@@ -0,0 +1,68 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+
+	"dating-backend/internal/models"
+)
+
+func TestAttachments(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    upload := func(chatID, uploaderID int64) int64 {
+        a := &models.Attachment{ChatID: chatID, UploaderID: uploaderID, Kind: "image", MIME: "image/png", Size: 10, Key: "attachments/x.png"}
+        if err := CreateAttachment(a); err != nil { t.Fatalf("create: %v", err) }
+        return a.ID
+    }
+    mine, otherChat, theirs, orphan := upload(1, 1), upload(2, 1), upload(1, 2), upload(1, 1)
+
+    for _, ids := range [][]int64{{otherChat}, {theirs}, {mine, 999}} {
+        msg := &models.Message{ChatID: 1, SenderID: 1, ReceiverID: 2, AttachmentIDs: ids}
+        if _, err := SaveMessage(msg); err != ErrInvalidAttachments {
+            t.Fatalf("expected %v rejected, got %v", ids, err)
+        }
+    }
+    if n := countRows(t, "messages"); n != 0 {
+        t.Fatalf("expected rejected messages rolled back, got %d", n)
+    }
+
+    msg := &models.Message{ChatID: 1, SenderID: 1, ReceiverID: 2, AttachmentIDs: []int64{mine}}
+    if _, err := SaveMessage(msg); err != nil { t.Fatalf("save: %v", err) }
+    again := &models.Message{ChatID: 1, SenderID: 1, ReceiverID: 2, AttachmentIDs: []int64{mine}}
+    if _, err := SaveMessage(again); err != ErrInvalidAttachments {
+        t.Fatalf("expected an attachment sent only once, got %v", err)
+    }
+
+    byMessage, err := GetAttachmentsForMessages([]int64{msg.ID})
+    if err != nil { t.Fatalf("get: %v", err) }
+    if len(byMessage[msg.ID]) != 1 || byMessage[msg.ID][0].ID != mine {
+        t.Fatalf("expected the attachment linked, got %+v", byMessage)
+    }
+
+    DeleteMessage(msg.ID, time.Now())
+    if a, _ := GetAttachment(mine); a != nil {
+        t.Fatalf("expected files of unsent messages gone, got %+v", a)
+    }
+
+    orphans, err := GetOrphanAttachments(time.Now().Add(time.Hour), 10)
+    if err != nil { t.Fatalf("orphans: %v", err) }
+    if len(orphans) != 3 {
+        t.Fatalf("expected the 3 unsent uploads, got %+v", orphans)
+    }
+    if ok, _ := DeleteOrphanAttachment(orphan); !ok {
+        t.Fatalf("expected orphan deleted")
+    }
+    if ok, _ := DeleteOrphanAttachment(mine); ok {
+        t.Fatalf("expected sent attachment kept")
+    }
+}
+
+func countRows(t *testing.T, table string) int {
+    var n int
+    if err := DB.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+        t.Fatalf("count %s: %v", table, err)
+    }
+    return n
+}
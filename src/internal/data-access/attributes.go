@@ -0,0 +1,121 @@
+package data_access
+
+import (
+	"database/sql"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+// SetAttributes replaces the values of the user's attributes listed in
+// values, an empty list clearing one, and records the visibility of the
+// attributes in visibility.
+func SetAttributes(userID int64, values map[string][]models.AttributeValue, visibility map[string]string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: SetAttributes begin tx error user=%d: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setAttributes(tx, userID, values, visibility); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: SetAttributes commit error user=%d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+func setAttributes(tx *sql.Tx, userID int64, values map[string][]models.AttributeValue, visibility map[string]string) error {
+	for key, vis := range visibility {
+		if _, err := tx.Exec(`
+			INSERT INTO user_attributes (user_id, key, visibility) VALUES (?, ?, ?)
+			ON CONFLICT (user_id, key) DO UPDATE SET visibility = excluded.visibility
+		`, userID, key, vis); err != nil {
+			logging.Log.Errorf("data-access: SetAttributes visibility error user=%d key=%s: %v", userID, key, err)
+			return err
+		}
+	}
+	for key, vals := range values {
+		if _, err := tx.Exec(`DELETE FROM user_attribute_values WHERE user_id = ? AND key = ?`, userID, key); err != nil {
+			logging.Log.Errorf("data-access: SetAttributes clear error user=%d key=%s: %v", userID, key, err)
+			return err
+		}
+		for _, v := range vals {
+			if _, err := tx.Exec(`
+				INSERT INTO user_attribute_values (user_id, key, value, num) VALUES (?, ?, ?, ?)
+			`, userID, key, v.Value, v.Num); err != nil {
+				logging.Log.Errorf("data-access: SetAttributes insert error user=%d key=%s: %v", userID, key, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetAttributes returns the stored attributes of the users, by user id,
+// with their visibility. An attribute with a visibility but no value comes
+// with an empty Value.
+func GetAttributes(userIDs []int64) (map[int64][]models.AttributeValue, error) {
+	out := map[int64][]models.AttributeValue{}
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := DB.Query(`
+		SELECT ua.user_id, ua.key, ua.visibility, IFNULL(av.value, ''), av.num
+		FROM user_attributes ua
+		LEFT JOIN user_attribute_values av ON av.user_id = ua.user_id AND av.key = ua.key
+		WHERE ua.user_id IN (`+placeholders(len(userIDs))+`)
+		ORDER BY ua.user_id, ua.key, av.value
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetAttributes query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int64
+		var v models.AttributeValue
+		var num sql.NullInt64
+		if err := rows.Scan(&userID, &v.Key, &v.Visibility, &v.Value, &num); err != nil {
+			logging.Log.Errorf("data-access: GetAttributes scan error: %v", err)
+			return nil, err
+		}
+		if num.Valid {
+			v.Num = &num.Int64
+		}
+		out[userID] = append(out[userID], v)
+	}
+	return out, rows.Err()
+}
+
+// attributeCondition is an SQL expression, true when the candidate u has
+// a public attribute satisfying c. Attributes the user hides can't be
+// searched on, or searches would reveal them.
+func attributeCondition(c models.AttributeCondition) (string, []any) {
+	expr := `EXISTS (SELECT 1 FROM user_attribute_values av
+		JOIN user_attributes ua ON ua.user_id = av.user_id AND ua.key = av.key
+		WHERE av.user_id = u.id AND av.key = ? AND ua.visibility = 'public'`
+	args := []any{c.Key}
+	if len(c.Values) > 0 {
+		expr += ` AND av.value IN (` + placeholders(len(c.Values)) + `)`
+		for _, v := range c.Values {
+			args = append(args, v)
+		}
+	}
+	if c.Min != nil {
+		expr += ` AND av.num >= ?`
+		args = append(args, *c.Min)
+	}
+	if c.Max != nil {
+		expr += ` AND av.num <= ?`
+		args = append(args, *c.Max)
+	}
+	return expr + `)`, args
+}
@@ -0,0 +1,67 @@
+package data_access
+
+import (
+	"strconv"
+	"testing"
+
+	"dating-backend/internal/models"
+)
+
+func TestAttributes(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'a', 'x'), (2, 'b', 'x'), (3, 'c', 'x')`); err != nil {
+        t.Fatalf("insert users: %v", err)
+    }
+    num := func(n int64) *int64 { return &n }
+    set := func(userID int64, height int64, pets []string, vis map[string]string) {
+        values := map[string][]models.AttributeValue{
+            "height": {{Key: "height", Value: strconv.FormatInt(height, 10), Num: num(height)}},
+            "pets":   nil,
+        }
+        for _, p := range pets {
+            values["pets"] = append(values["pets"], models.AttributeValue{Key: "pets", Value: p})
+        }
+        if err := SetAttributes(userID, values, vis); err != nil { t.Fatalf("set attributes: %v", err) }
+    }
+    set(1, 180, []string{"cat", "dog"}, map[string]string{"height": "public", "pets": "public"})
+    set(2, 165, []string{"dog"}, map[string]string{"height": "public", "pets": "hidden"})
+    set(2, 165, []string{"fish"}, map[string]string{"height": "public"})
+    if err := SetAttributes(3, nil, map[string]string{"religion": "matches"}); err != nil { t.Fatalf("set visibility: %v", err) }
+
+    got, err := GetAttributes([]int64{1, 2, 3})
+    if err != nil { t.Fatalf("get attributes: %v", err) }
+    if len(got[1]) != 3 || got[1][0].Key != "height" || *got[1][0].Num != 180 || got[1][1].Value != "cat" || got[1][2].Value != "dog" {
+        t.Fatalf("unexpected attributes of 1: %+v", got[1])
+    }
+    if len(got[2]) != 2 || got[2][1].Value != "fish" || got[2][1].Visibility != "hidden" {
+        t.Fatalf("expected pets replaced and kept hidden: %+v", got[2])
+    }
+    if len(got[3]) != 1 || got[3][0].Value != "" || got[3][0].Visibility != "matches" {
+        t.Fatalf("expected a visibility without a value: %+v", got[3])
+    }
+
+    matching := func(c models.AttributeCondition) []int64 {
+        expr, args := attributeCondition(c)
+        rows, err := DB.Query(`SELECT u.id FROM users u WHERE `+expr+` ORDER BY u.id`, args...)
+        if err != nil { t.Fatalf("condition query: %v", err) }
+        defer rows.Close()
+        var ids []int64
+        for rows.Next() {
+            var id int64
+            rows.Scan(&id)
+            ids = append(ids, id)
+        }
+        return ids
+    }
+    if ids := matching(models.AttributeCondition{Key: "height", Min: num(170)}); len(ids) != 1 || ids[0] != 1 {
+        t.Fatalf("height >= 170: got %v", ids)
+    }
+    if ids := matching(models.AttributeCondition{Key: "height", Min: num(160), Max: num(190)}); len(ids) != 2 {
+        t.Fatalf("height 160-190: got %v", ids)
+    }
+    if ids := matching(models.AttributeCondition{Key: "pets", Values: []string{"dog", "fish"}}); len(ids) != 1 || ids[0] != 1 {
+        t.Fatalf("expected hidden pets not searchable, got %v", ids)
+    }
+}
@@ -9,6 +9,17 @@ import (
 
 var DB *sql.DB
 
+// swipesSchema is shared with the migration that rebuilds the table when
+// the allowed actions change (SQLite can't alter a CHECK constraint).
+const swipesSchema = `(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		target_id INTEGER NOT NULL,
+		action TEXT CHECK(action IN ('like', 'dislike', 'superlike')) NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, target_id)
+	);`
+
 func InitDB() {
 	var err error
 	DB, err = sql.Open("sqlite", "./dating.db")
@@ -33,15 +44,7 @@ func InitDB() {
 		last_active TEXT
 	);`
 	
-	createSwipes := `
-	CREATE TABLE IF NOT EXISTS swipes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		target_id INTEGER NOT NULL,
-		action TEXT CHECK(action IN ('like', 'dislike')) NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(user_id, target_id)
-	);`
+	createSwipes := `CREATE TABLE IF NOT EXISTS swipes ` + swipesSchema
 
 	createSessions := `
 	CREATE TABLE IF NOT EXISTS sessions (
@@ -87,6 +90,244 @@ func InitDB() {
 		max_lon
 	);`
 
+	createUserPassports := `
+	CREATE TABLE IF NOT EXISTS user_passports (
+		user_id INTEGER PRIMARY KEY,
+		city TEXT NOT NULL DEFAULT '',
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);`
+
+	createQuotaEvents := `
+	CREATE TABLE IF NOT EXISTS quota_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_quota_events_key ON quota_events(key, created_at);`
+
+	createUserEntitlements := `
+	CREATE TABLE IF NOT EXISTS user_entitlements (
+		user_id INTEGER NOT NULL,
+		entitlement TEXT NOT NULL,
+		expires_at DATETIME,
+		PRIMARY KEY(user_id, entitlement),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);`
+
+	createMatches := `
+	CREATE TABLE IF NOT EXISTS matches (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user1_id INTEGER NOT NULL,
+		user2_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		source TEXT CHECK(source IN ('like', 'superlike')) NOT NULL DEFAULT 'like',
+		status TEXT CHECK(status IN ('active', 'unmatched', 'expired')) NOT NULL DEFAULT 'active',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user1_id, user2_id),
+		FOREIGN KEY(chat_id) REFERENCES chats(id)
+	);`
+
+	createJobs := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '',
+		unique_key TEXT UNIQUE,
+		run_at DATETIME NOT NULL,
+		locked_until DATETIME,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_run_at ON jobs(run_at);
+	CREATE TABLE IF NOT EXISTS job_keys (
+		key TEXT PRIMARY KEY,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_job_keys_created_at ON job_keys(created_at);
+	CREATE TABLE IF NOT EXISTS dead_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL,
+		max_attempts INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		failed_at DATETIME NOT NULL
+	);`
+
+	// user_events is the per-user realtime event log replayed to clients
+	// that reconnect; event_seqs holds each user's last sequence number so
+	// numbering survives trimming the log, event_acks the last one each
+	// device confirmed.
+	createUserEvents := `
+	CREATE TABLE IF NOT EXISTS event_seqs (
+		user_id INTEGER PRIMARY KEY,
+		last_seq INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS event_acks (
+		user_id INTEGER NOT NULL,
+		device_id TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (user_id, device_id)
+	);
+	CREATE TABLE IF NOT EXISTS user_events (
+		user_id INTEGER NOT NULL,
+		seq INTEGER NOT NULL,
+		payload TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (user_id, seq)
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);`
+
+	// message_edits keeps every replaced version of an edited message for
+	// moderation; message_deletions hides a message from one participant.
+	createMessageHistory := `
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		edited_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id);
+	CREATE TABLE IF NOT EXISTS message_deletions (
+		message_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		deleted_at DATETIME NOT NULL,
+		PRIMARY KEY (message_id, user_id)
+	);`
+
+	// attachments are files uploaded into a chat; message_id is set when a
+	// message is sent with them.
+	createAttachments := `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		uploader_id INTEGER NOT NULL,
+		message_id INTEGER,
+		kind TEXT NOT NULL CHECK(kind IN ('image', 'voice')),
+		mime TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		blob_key TEXT NOT NULL,
+		thumb_key TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (message_id) REFERENCES messages(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_orphans ON attachments(created_at) WHERE message_id IS NULL;`
+
+	// user_photos is the profile gallery, ordered by position; blob_key is
+	// the prefix of the stored sizes of a photo.
+	createUserPhotos := `
+	CREATE TABLE IF NOT EXISTS user_photos (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		blob_key TEXT NOT NULL UNIQUE,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_photos_user ON user_photos(user_id, position);`
+
+	// photo_verifications are selfies users send to get the photo_verified
+	// badge; "pending" ones make up the moderators' review queue.
+	createPhotoVerifications := `
+	CREATE TABLE IF NOT EXISTS photo_verifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		pose TEXT NOT NULL,
+		status TEXT NOT NULL CHECK(status IN ('requested', 'pending', 'approved', 'rejected')),
+		reason TEXT NOT NULL DEFAULT '',
+		selfie_key TEXT NOT NULL DEFAULT '',
+		reviewer_id INTEGER,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		submitted_at DATETIME,
+		reviewed_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_photo_verifications_user ON photo_verifications(user_id, id);
+	CREATE INDEX IF NOT EXISTS idx_photo_verifications_pending ON photo_verifications(id) WHERE status = 'pending';`
+
+	// user_attributes holds who may see each optional profile attribute a
+	// user filled in, user_attribute_values its values (several for
+	// multi-valued ones); the attributes are described by attributes.Schema.
+	createUserAttributes := `
+	CREATE TABLE IF NOT EXISTS user_attributes (
+		user_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		visibility TEXT NOT NULL CHECK(visibility IN ('public', 'matches', 'hidden')),
+		PRIMARY KEY (user_id, key),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	CREATE TABLE IF NOT EXISTS user_attribute_values (
+		user_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		num INTEGER,
+		PRIMARY KEY (user_id, key, value),
+		FOREIGN KEY (user_id, key) REFERENCES user_attributes(user_id, key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_attribute_values_value ON user_attribute_values(key, value);
+	CREATE INDEX IF NOT EXISTS idx_user_attribute_values_num ON user_attribute_values(key, num) WHERE num IS NOT NULL;`
+
+	// interests is the taxonomy admins curate, with a label per locale in
+	// interest_labels; user_interests the ones each user picked.
+	createInterests := `
+	CREATE TABLE IF NOT EXISTS interests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT NOT NULL UNIQUE,
+		category TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS interest_labels (
+		interest_id INTEGER NOT NULL,
+		locale TEXT NOT NULL,
+		label TEXT NOT NULL,
+		PRIMARY KEY (interest_id, locale),
+		FOREIGN KEY (interest_id) REFERENCES interests(id)
+	);
+	CREATE TABLE IF NOT EXISTS user_interests (
+		user_id INTEGER NOT NULL,
+		interest_id INTEGER NOT NULL,
+		PRIMARY KEY (user_id, interest_id),
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (interest_id) REFERENCES interests(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_interests_interest ON user_interests(interest_id, user_id);`
+
+	// prompts are the questions admins offer, user_prompts the answers
+	// users show on their profile as cards
+	createPrompts := `
+	CREATE TABLE IF NOT EXISTS prompts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		text TEXT NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS user_prompts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		prompt_id INTEGER NOT NULL,
+		answer TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, prompt_id),
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (prompt_id) REFERENCES prompts(id)
+	);`
+
 	_, err = DB.Exec(createUsers)
 	if err != nil {
 		logging.Log.Fatalw("failed to exec createUsers", "err", err)
@@ -111,6 +352,59 @@ func InitDB() {
 	if err != nil {
 		logging.Log.Fatalw("failed to exec createUserLocations", "err", err)
 	}
+	_, err = DB.Exec(createUserPassports)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createUserPassports", "err", err)
+	}
+	_, err = DB.Exec(createQuotaEvents)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createQuotaEvents", "err", err)
+	}
+	_, err = DB.Exec(createUserEntitlements)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createUserEntitlements", "err", err)
+	}
+	_, err = DB.Exec(createMatches)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createMatches", "err", err)
+	}
+
+	_, err = DB.Exec(createJobs)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createJobs", "err", err)
+	}
+	_, err = DB.Exec(createUserEvents)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createUserEvents", "err", err)
+	}
+	_, err = DB.Exec(createMessageHistory)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createMessageHistory", "err", err)
+	}
+	_, err = DB.Exec(createAttachments)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createAttachments", "err", err)
+	}
+	_, err = DB.Exec(createUserPhotos)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createUserPhotos", "err", err)
+	}
+	_, err = DB.Exec(createPhotoVerifications)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createPhotoVerifications", "err", err)
+	}
+	_, err = DB.Exec(createUserAttributes)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createUserAttributes", "err", err)
+	}
+	_, err = DB.Exec(createInterests)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createInterests", "err", err)
+	}
+	_, err = DB.Exec(createPrompts)
+	if err != nil {
+		logging.Log.Fatalw("failed to exec createPrompts", "err", err)
+	}
 
 	// Run migrations
 	if err := migrate(DB); err != nil {
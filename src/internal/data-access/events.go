@@ -0,0 +1,155 @@
+package data_access
+
+import (
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"time"
+)
+
+// AppendUserEvent stores an event in the user's log under the next sequence
+// number and returns it. When maxPerUser > 0 the oldest events beyond that
+// many are dropped.
+func AppendUserEvent(userID int64, payload []byte, now time.Time, maxPerUser int) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: AppendUserEvent begin tx error user=%d: %v", userID, err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var seq int64
+	if err := tx.QueryRow(`
+		INSERT INTO event_seqs (user_id, last_seq) VALUES (?, 1)
+		ON CONFLICT(user_id) DO UPDATE SET last_seq = last_seq + 1
+		RETURNING last_seq
+	`, userID).Scan(&seq); err != nil {
+		logging.Log.Errorf("data-access: AppendUserEvent seq error user=%d: %v", userID, err)
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_events (user_id, seq, payload, created_at) VALUES (?, ?, ?, ?)
+	`, userID, seq, string(payload), sqlTime(now)); err != nil {
+		logging.Log.Errorf("data-access: AppendUserEvent insert error user=%d: %v", userID, err)
+		return 0, err
+	}
+
+	if maxPerUser > 0 {
+		if _, err := tx.Exec(`DELETE FROM user_events WHERE user_id = ? AND seq <= ?`,
+			userID, seq-int64(maxPerUser)); err != nil {
+			logging.Log.Errorf("data-access: AppendUserEvent trim error user=%d: %v", userID, err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: AppendUserEvent commit error user=%d: %v", userID, err)
+		return 0, err
+	}
+	return seq, nil
+}
+
+// GetUserEventsSince returns the user's logged events with a sequence number
+// above afterSeq, oldest first. complete is false if some of them were
+// trimmed from the log already, or afterSeq is ahead of the log.
+func GetUserEventsSince(userID, afterSeq int64) (events []models.UserEvent, complete bool, err error) {
+	var lastSeq int64
+	err = DB.QueryRow(`SELECT IFNULL((SELECT last_seq FROM event_seqs WHERE user_id = ?), 0)`, userID).Scan(&lastSeq)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetUserEventsSince seq error user=%d: %v", userID, err)
+		return nil, false, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT seq, payload, created_at FROM user_events
+		WHERE user_id = ? AND seq > ?
+		ORDER BY seq
+	`, userID, afterSeq)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetUserEventsSince query error user=%d: %v", userID, err)
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.UserEvent
+		var payload string
+		if err := rows.Scan(&e.Seq, &payload, &e.CreatedAt); err != nil {
+			logging.Log.Errorf("data-access: GetUserEventsSince scan error user=%d: %v", userID, err)
+			return nil, false, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	// the log is only ever trimmed from the oldest end, so what is left
+	// after afterSeq is all of it only if nothing is missing in between
+	return events, int64(len(events)) == lastSeq-afterSeq, rows.Err()
+}
+
+// RegisterEventDevice records the user's device as a reader of the event
+// log that has the events up to and including seq; a negative seq means
+// every event logged so far. Until it acks more or is pruned as silent, the
+// device holds back trimming by the acks of the user's other devices.
+func RegisterEventDevice(userID int64, deviceID string, seq int64, now time.Time) error {
+	_, err := DB.Exec(`
+		INSERT INTO event_acks (user_id, device_id, seq, updated_at)
+		VALUES (?1, ?2, IIF(?3 < 0, IFNULL((SELECT last_seq FROM event_seqs WHERE user_id = ?1), 0), ?3), ?4)
+		ON CONFLICT (user_id, device_id) DO UPDATE SET
+			seq = MAX(seq, excluded.seq),
+			updated_at = excluded.updated_at
+	`, userID, deviceID, seq, sqlTime(now))
+	if err != nil {
+		logging.Log.Errorf("data-access: RegisterEventDevice error user=%d device=%s: %v", userID, deviceID, err)
+	}
+	return err
+}
+
+// AckUserEvents records that the user's device received the events up to
+// and including seq, and drops the events every registered device of the
+// user has acked.
+func AckUserEvents(userID int64, deviceID string, seq int64, now time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: AckUserEvents begin tx error user=%d: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO event_acks (user_id, device_id, seq, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, device_id) DO UPDATE SET
+			seq = MAX(seq, excluded.seq),
+			updated_at = excluded.updated_at
+	`, userID, deviceID, seq, sqlTime(now)); err != nil {
+		logging.Log.Errorf("data-access: AckUserEvents upsert error user=%d device=%s: %v", userID, deviceID, err)
+		return err
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM user_events
+		WHERE user_id = ?1 AND seq <= (SELECT MIN(seq) FROM event_acks WHERE user_id = ?1)
+	`, userID); err != nil {
+		logging.Log.Errorf("data-access: AckUserEvents exec error user=%d: %v", userID, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: AckUserEvents commit error user=%d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// PruneUserEvents deletes events logged before cutoff and returns how many
+// were removed. Acks of devices silent since cutoff are forgotten too, so
+// they no longer hold back trimming.
+func PruneUserEvents(cutoff time.Time) (int64, error) {
+	if _, err := DB.Exec(`DELETE FROM event_acks WHERE updated_at < ?`, sqlTime(cutoff)); err != nil {
+		logging.Log.Errorf("data-access: PruneUserEvents acks exec error: %v", err)
+		return 0, err
+	}
+	res, err := DB.Exec(`DELETE FROM user_events WHERE created_at < ?`, sqlTime(cutoff))
+	if err != nil {
+		logging.Log.Errorf("data-access: PruneUserEvents exec error: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,105 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserEventLog(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    for i := 1; i <= 4; i++ {
+        seq, err := AppendUserEvent(1, []byte(`{"type":"typing"}`), now.Add(time.Duration(i)*time.Hour), 3)
+        if err != nil { t.Fatalf("append: %v", err) }
+        if seq != int64(i) {
+            t.Fatalf("expected seq %d, got %d", i, seq)
+        }
+    }
+    if seq, _ := AppendUserEvent(2, []byte(`{}`), now, 3); seq != 1 {
+        t.Fatalf("expected sequences per user, got %d", seq)
+    }
+
+    events, complete, err := GetUserEventsSince(1, 0)
+    if err != nil { t.Fatalf("since: %v", err) }
+    if len(events) != 3 || events[0].Seq != 2 || string(events[0].Payload) != `{"type":"typing"}` {
+        t.Fatalf("expected events 2..4 kept under the size cap, got %+v", events)
+    }
+    if complete {
+        t.Fatalf("expected the capped log reported incomplete from seq 0")
+    }
+    if _, complete, _ := GetUserEventsSince(1, 1); !complete {
+        t.Fatalf("expected the log complete after seq 1")
+    }
+    if _, complete, _ := GetUserEventsSince(1, 9); complete {
+        t.Fatalf("expected a seq ahead of the log reported incomplete")
+    }
+
+    // trimmed only up to what every device acked
+    if err := AckUserEvents(1, "laptop", 2, now); err != nil { t.Fatalf("ack: %v", err) }
+    if err := AckUserEvents(1, "phone", 3, now); err != nil { t.Fatalf("ack: %v", err) }
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 2 || events[0].Seq != 3 {
+        t.Fatalf("expected events after the laptop's ack kept, got %+v", events)
+    }
+    AckUserEvents(1, "phone", 1, now)
+    AckUserEvents(1, "laptop", 3, now)
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 1 || events[0].Seq != 4 {
+        t.Fatalf("expected acked events trimmed and acks never going back, got %+v", events)
+    }
+    // numbering continues after the log was emptied
+    AckUserEvents(1, "phone", 4, now)
+    AckUserEvents(1, "laptop", 4, now)
+    if seq, _ := AppendUserEvent(1, []byte(`{}`), now.Add(5*time.Hour), 3); seq != 5 {
+        t.Fatalf("expected seq 5 after trimming, got %d", seq)
+    }
+
+    pruned, err := PruneUserEvents(now.Add(time.Hour))
+    if err != nil { t.Fatalf("prune: %v", err) }
+    if pruned != 1 {
+        t.Fatalf("expected user 2's old event pruned, got %d", pruned)
+    }
+    // a device silent since the cutoff no longer holds back trimming
+    AckUserEvents(1, "phone", 5, now.Add(2*time.Hour))
+    AppendUserEvent(1, []byte(`{}`), now.Add(6*time.Hour), 3)
+    PruneUserEvents(now.Add(time.Hour))
+    AckUserEvents(1, "phone", 5, now.Add(2*time.Hour))
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 1 || events[0].Seq != 6 {
+        t.Fatalf("expected the stale device's ack forgotten, got %+v", events)
+    }
+}
+
+func TestEventAcksWaitForRegisteredDevices(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    AppendUserEvent(1, []byte(`{}`), now, 0)
+    AppendUserEvent(1, []byte(`{}`), now, 0)
+
+    // the phone resumes from the start, the laptop connects afresh at seq 2
+    if err := RegisterEventDevice(1, "phone", 0, now); err != nil { t.Fatalf("register: %v", err) }
+    if err := RegisterEventDevice(1, "laptop", -1, now); err != nil { t.Fatalf("register: %v", err) }
+    AppendUserEvent(1, []byte(`{}`), now, 0)
+
+    // the laptop's ack trims nothing the phone hasn't received
+    if err := AckUserEvents(1, "laptop", 3, now); err != nil { t.Fatalf("ack: %v", err) }
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 3 {
+        t.Fatalf("expected events kept for the silent phone, got %+v", events)
+    }
+    AckUserEvents(1, "phone", 2, now)
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 1 || events[0].Seq != 3 {
+        t.Fatalf("expected events both devices have trimmed, got %+v", events)
+    }
+
+    // registering again never moves a device back
+    RegisterEventDevice(1, "phone", 0, now)
+    AckUserEvents(1, "laptop", 3, now)
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 1 {
+        t.Fatalf("expected event 3 kept until the phone acks it, got %+v", events)
+    }
+    AckUserEvents(1, "phone", 3, now)
+    if events, _, _ := GetUserEventsSince(1, 0); len(events) != 0 {
+        t.Fatalf("expected the log emptied, got %+v", events)
+    }
+}
@@ -0,0 +1,290 @@
+package data_access
+
+import (
+	"database/sql"
+	"errors"
+
+	"dating-backend/internal/interests"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+var (
+	// ErrInterestExists is returned by CreateInterest for a code in use.
+	ErrInterestExists = errors.New("interest exists")
+	// ErrUnknownInterest is returned by SetUserInterests for an id that
+	// isn't in the taxonomy.
+	ErrUnknownInterest = errors.New("unknown interest")
+	// ErrTooManyInterests is returned by SetUserInterests above the limit.
+	ErrTooManyInterests = errors.New("too many interests")
+)
+
+// interestColumns selects an interest i with its label in the locale bound
+// to the first placeholder.
+const interestColumns = `i.id, i.code, i.category, COALESCE(
+		(SELECT label FROM interest_labels WHERE interest_id = i.id AND locale = ?),
+		(SELECT label FROM interest_labels WHERE interest_id = i.id AND locale = '` + interests.DefaultLocale + `'),
+		i.code)`
+
+// GetInterests returns the taxonomy, labelled in the locale, by category
+// and label.
+func GetInterests(locale string) ([]models.Interest, error) {
+	rows, err := DB.Query(`
+		SELECT `+interestColumns+` AS label
+		FROM interests i
+		ORDER BY i.category, label, i.id
+	`, locale)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetInterests query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Interest{}
+	for rows.Next() {
+		var i models.Interest
+		if err := rows.Scan(&i.ID, &i.Code, &i.Category, &i.Label); err != nil {
+			logging.Log.Errorf("data-access: GetInterests scan error: %v", err)
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+// GetInterestLabels returns the labels of every interest, by interest id
+// and locale.
+func GetInterestLabels() (map[int64]map[string]string, error) {
+	rows, err := DB.Query(`SELECT interest_id, locale, label FROM interest_labels`)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetInterestLabels query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]map[string]string{}
+	for rows.Next() {
+		var id int64
+		var locale, label string
+		if err := rows.Scan(&id, &locale, &label); err != nil {
+			logging.Log.Errorf("data-access: GetInterestLabels scan error: %v", err)
+			return nil, err
+		}
+		if out[id] == nil {
+			out[id] = map[string]string{}
+		}
+		out[id][locale] = label
+	}
+	return out, rows.Err()
+}
+
+// CreateInterest adds an interest to the taxonomy with labels by locale.
+func CreateInterest(code, category string, labels map[string]string) (*models.Interest, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: CreateInterest begin tx error: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	i := models.Interest{Code: code, Category: category}
+	err = tx.QueryRow(`
+		INSERT INTO interests (code, category) VALUES (?, ?)
+		ON CONFLICT (code) DO NOTHING
+		RETURNING id
+	`, code, category).Scan(&i.ID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInterestExists
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: CreateInterest insert error code=%s: %v", code, err)
+		return nil, err
+	}
+	if err := setInterestLabels(tx, i.ID, labels); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: CreateInterest commit error code=%s: %v", code, err)
+		return nil, err
+	}
+	return &i, nil
+}
+
+// UpdateInterest moves an interest to another category, unless category
+// is empty, and sets its labels in the given locales, an empty label
+// removing one. It returns false if there is no such interest.
+func UpdateInterest(id int64, category string, labels map[string]string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: UpdateInterest begin tx error id=%d: %v", id, err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE interests SET category = IIF(? = '', category, ?) WHERE id = ?`, category, category, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: UpdateInterest error id=%d: %v", id, err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := setInterestLabels(tx, id, labels); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: UpdateInterest commit error id=%d: %v", id, err)
+		return false, err
+	}
+	return true, nil
+}
+
+func setInterestLabels(tx *sql.Tx, id int64, labels map[string]string) error {
+	for locale, label := range labels {
+		var err error
+		if label == "" {
+			_, err = tx.Exec(`DELETE FROM interest_labels WHERE interest_id = ? AND locale = ?`, id, locale)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO interest_labels (interest_id, locale, label) VALUES (?, ?, ?)
+				ON CONFLICT (interest_id, locale) DO UPDATE SET label = excluded.label
+			`, id, locale, label)
+		}
+		if err != nil {
+			logging.Log.Errorf("data-access: set interest labels error id=%d locale=%s: %v", id, locale, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteInterest removes an interest from the taxonomy and from the
+// profiles that had it. It returns false if there is no such interest.
+func DeleteInterest(id int64) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteInterest begin tx error id=%d: %v", id, err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`DELETE FROM user_interests WHERE interest_id = ?`,
+		`DELETE FROM interest_labels WHERE interest_id = ?`,
+	} {
+		if _, err := tx.Exec(q, id); err != nil {
+			logging.Log.Errorf("data-access: DeleteInterest cleanup error id=%d: %v", id, err)
+			return false, err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM interests WHERE id = ?`, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteInterest error id=%d: %v", id, err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: DeleteInterest commit error id=%d: %v", id, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// SetUserInterests replaces the interests the user picked, at most limit
+// of them.
+func SetUserInterests(userID int64, ids []int64, limit int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: SetUserInterests begin tx error user=%d: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setUserInterests(tx, userID, ids, limit); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: SetUserInterests commit error user=%d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+func setUserInterests(tx *sql.Tx, userID int64, ids []int64, limit int) error {
+	unique := map[int64]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) > limit {
+		return ErrTooManyInterests
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_interests WHERE user_id = ?`, userID); err != nil {
+		logging.Log.Errorf("data-access: SetUserInterests clear error user=%d: %v", userID, err)
+		return err
+	}
+	for id := range unique {
+		res, err := tx.Exec(`
+			INSERT INTO user_interests (user_id, interest_id)
+			SELECT ?, id FROM interests WHERE id = ?
+		`, userID, id)
+		if err != nil {
+			logging.Log.Errorf("data-access: SetUserInterests insert error user=%d: %v", userID, err)
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrUnknownInterest
+		}
+	}
+	return nil
+}
+
+// GetUserInterests returns the interests of the users, by user id,
+// labelled in the locale.
+func GetUserInterests(userIDs []int64, locale string) (map[int64][]models.Interest, error) {
+	out := map[int64][]models.Interest{}
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	args := []any{locale}
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	rows, err := DB.Query(`
+		SELECT ui.user_id, `+interestColumns+` AS label
+		FROM user_interests ui
+		JOIN interests i ON i.id = ui.interest_id
+		WHERE ui.user_id IN (`+placeholders(len(userIDs))+`)
+		ORDER BY ui.user_id, i.category, label, i.id
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetUserInterests query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		var i models.Interest
+		if err := rows.Scan(&userID, &i.ID, &i.Code, &i.Category, &i.Label); err != nil {
+			logging.Log.Errorf("data-access: GetUserInterests scan error: %v", err)
+			return nil, err
+		}
+		out[userID] = append(out[userID], i)
+	}
+	return out, rows.Err()
+}
+
+// interestSimilarity is an SQL expression for the Jaccard similarity of the
+// interests of the candidate u and of the viewer, who picked viewerCount:
+// shared interests over the interests of either, 0 if neither has any.
+func interestSimilarity(viewerID int64, viewerCount int) (string, []any) {
+	return `IFNULL((SELECT COUNT(*) FROM user_interests a
+			JOIN user_interests b ON b.interest_id = a.interest_id AND b.user_id = ?
+			WHERE a.user_id = u.id) * 1.0 / NULLIF(? + (SELECT COUNT(*) FROM user_interests WHERE user_id = u.id)
+			- (SELECT COUNT(*) FROM user_interests a
+			JOIN user_interests b ON b.interest_id = a.interest_id AND b.user_id = ?
+			WHERE a.user_id = u.id), 0), 0)`, []any{viewerID, viewerCount, viewerID}
+}
@@ -0,0 +1,119 @@
+package data_access
+
+import (
+	"testing"
+
+	"dating-backend/internal/models"
+)
+
+func TestInterests(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'a', 'x'), (2, 'b', 'x'), (3, 'c', 'x'), (4, 'd', 'x')`); err != nil {
+        t.Fatalf("insert users: %v", err)
+    }
+    jazz, err := CreateInterest("jazz", "music", map[string]string{"ru": "Джаз", "en": "Jazz"})
+    if err != nil { t.Fatalf("create: %v", err) }
+    hiking, _ := CreateInterest("hiking", "sports", map[string]string{"en": "Hiking"})
+    chess, _ := CreateInterest("chess", "games", nil)
+    if _, err := CreateInterest("jazz", "music", nil); err != ErrInterestExists {
+        t.Fatalf("expected a taken code refused, got %v", err)
+    }
+
+    list, err := GetInterests("de")
+    if err != nil || len(list) != 3 {
+        t.Fatalf("get interests: %+v %v", list, err)
+    }
+    labels := map[string]string{}
+    for _, i := range list {
+        labels[i.Code] = i.Label
+    }
+    if labels["jazz"] != "Джаз" || labels["hiking"] != "hiking" || labels["chess"] != "chess" {
+        t.Fatalf("expected the default locale, then the code: %v", labels)
+    }
+
+    if found, err := UpdateInterest(hiking.ID, "", map[string]string{"ru": "Походы", "en": ""}); !found || err != nil {
+        t.Fatalf("update: %v %v", found, err)
+    }
+    if found, _ := UpdateInterest(99, "music", nil); found {
+        t.Fatalf("expected a missing interest reported")
+    }
+    all, _ := GetInterestLabels()
+    if len(all[hiking.ID]) != 1 || all[hiking.ID]["ru"] != "Походы" {
+        t.Fatalf("unexpected labels %v", all[hiking.ID])
+    }
+
+    if err := SetUserInterests(1, []int64{jazz.ID, hiking.ID, chess.ID, jazz.ID}, 3); err != nil { t.Fatalf("set: %v", err) }
+    if err := SetUserInterests(1, []int64{jazz.ID, hiking.ID, chess.ID, 42}, 5); err != ErrUnknownInterest {
+        t.Fatalf("expected an unknown interest refused, got %v", err)
+    }
+    if err := SetUserInterests(1, []int64{1, 2, 3, 4}, 3); err != ErrTooManyInterests {
+        t.Fatalf("expected the limit enforced, got %v", err)
+    }
+    SetUserInterests(2, []int64{jazz.ID}, 3)
+    SetUserInterests(3, []int64{jazz.ID, hiking.ID, chess.ID}, 3)
+
+    tags, err := GetUserInterests([]int64{1, 2, 4}, "en")
+    if err != nil || len(tags[1]) != 3 || len(tags[2]) != 1 || tags[2][0].Label != "Jazz" || len(tags[4]) != 0 {
+        t.Fatalf("unexpected user interests %+v %v", tags, err)
+    }
+
+    expr, args := interestSimilarity(1, 3)
+    similarity := map[int64]float64{}
+    rows, err := DB.Query(`SELECT u.id, `+expr+` FROM users u`, args...)
+    if err != nil { t.Fatalf("similarity query: %v", err) }
+    for rows.Next() {
+        var id int64
+        var s float64
+        rows.Scan(&id, &s)
+        similarity[id] = s
+    }
+    rows.Close()
+    if similarity[2] != 1.0/3 || similarity[3] != 1 || similarity[4] != 0 {
+        t.Fatalf("unexpected similarity %v", similarity)
+    }
+
+    if found, err := DeleteInterest(jazz.ID); !found || err != nil { t.Fatalf("delete: %v %v", found, err) }
+    if tags, _ := GetUserInterests([]int64{2}, "en"); len(tags[2]) != 0 {
+        t.Fatalf("expected the interest removed from profiles, got %+v", tags[2])
+    }
+}
+
+func TestUpdateProfileIsAllOrNothing(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password, name) VALUES (1, 'a', 'x', 'Anna')`); err != nil {
+        t.Fatalf("insert user: %v", err)
+    }
+    DB.Exec(`INSERT INTO interests (id, code, category) VALUES (1, 'hiking', 'sport'), (2, 'chess', 'games')`)
+    if err := SetUserInterests(1, []int64{1}, 5); err != nil { t.Fatalf("interests: %v", err) }
+
+    // an unknown interest fails the name change saved with it too
+    u, err := GetUserByID(1)
+    if err != nil { t.Fatalf("get user: %v", err) }
+    u.Name = "Anya"
+    err = UpdateProfile(&models.ProfileUpdate{User: u, InterestIDs: &[]int64{2, 99}, InterestLimit: 5})
+    if err != ErrUnknownInterest { t.Fatalf("expected an unknown interest refused, got %v", err) }
+
+    mine, _ := GetUserInterests([]int64{1}, "en")
+    if len(mine[1]) != 1 || mine[1][0].ID != 1 {
+        t.Fatalf("expected interests left as they were, got %+v", mine[1])
+    }
+    if u, _ := GetUserByID(1); u.Name != "Anna" {
+        t.Fatalf("expected the name left as it was, got %q", u.Name)
+    }
+
+    u.Name = "Anya"
+    if err := UpdateProfile(&models.ProfileUpdate{User: u, InterestIDs: &[]int64{2}, InterestLimit: 5}); err != nil {
+        t.Fatalf("update: %v", err)
+    }
+    mine, _ = GetUserInterests([]int64{1}, "en")
+    if len(mine[1]) != 1 || mine[1][0].ID != 2 {
+        t.Fatalf("expected the new interests saved, got %+v", mine[1])
+    }
+    if u, _ := GetUserByID(1); u.Name != "Anya" {
+        t.Fatalf("expected the new name saved, got %q", u.Name)
+    }
+}
@@ -0,0 +1,217 @@
+package data_access
+
+import (
+	"database/sql"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"time"
+)
+
+// JobKeyRetention is how long the unique key of an enqueued job is
+// remembered. It must outlast the jobs themselves, so that an occurrence of
+// a recurring job that already ran isn't enqueued again.
+var JobKeyRetention = 7 * 24 * time.Hour
+
+// EnqueueJob adds a job to the queue and returns its id. A non-empty
+// uniqueKey makes the insert a no-op (returning 0) when a job with the same
+// key was enqueued within JobKeyRetention, even if it has completed since,
+// so recurring jobs aren't scheduled twice.
+func EnqueueJob(j *models.Job, uniqueKey string) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: EnqueueJob begin tx error kind=%s: %v", j.Kind, err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var key any
+	if uniqueKey != "" {
+		key = uniqueKey
+		now := time.Now()
+		if _, err := tx.Exec(`DELETE FROM job_keys WHERE created_at < ?`, sqlTime(now.Add(-JobKeyRetention))); err != nil {
+			logging.Log.Errorf("data-access: EnqueueJob prune keys error kind=%s: %v", j.Kind, err)
+			return 0, err
+		}
+		res, err := tx.Exec(`INSERT OR IGNORE INTO job_keys (key, created_at) VALUES (?, ?)`, uniqueKey, sqlTime(now))
+		if err != nil {
+			logging.Log.Errorf("data-access: EnqueueJob key error kind=%s: %v", j.Kind, err)
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 0, nil
+		}
+	}
+
+	res, err := tx.Exec(`
+		INSERT OR IGNORE INTO jobs (kind, payload, unique_key, run_at, max_attempts)
+		VALUES (?, ?, ?, ?, ?)
+	`, j.Kind, string(j.Payload), key, sqlTime(j.RunAt), j.MaxAttempts)
+	if err != nil {
+		logging.Log.Errorf("data-access: EnqueueJob exec error kind=%s: %v", j.Kind, err)
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: EnqueueJob commit error kind=%s: %v", j.Kind, err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// ClaimJob takes the oldest due job that no other worker holds, hiding it
+// until lockedUntil and counting the attempt. Returns nil if nothing is due.
+func ClaimJob(now, lockedUntil time.Time) (*models.Job, error) {
+	j := &models.Job{}
+	var payload string
+	err := DB.QueryRow(`
+		UPDATE jobs SET locked_until = ?, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE run_at <= ? AND (locked_until IS NULL OR locked_until <= ?)
+			ORDER BY run_at, id LIMIT 1
+		)
+		RETURNING id, kind, payload, run_at, attempts, max_attempts, last_error, created_at
+	`, sqlTime(lockedUntil), sqlTime(now), sqlTime(now)).Scan(&j.ID, &j.Kind, &payload, &j.RunAt,
+		&j.Attempts, &j.MaxAttempts, &j.LastError, &j.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: ClaimJob error: %v", err)
+		return nil, err
+	}
+	if payload != "" {
+		j.Payload = []byte(payload)
+	}
+	return j, nil
+}
+
+// CompleteJob removes a finished job from the queue.
+func CompleteJob(id int64) error {
+	_, err := DB.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: CompleteJob exec error job=%d: %v", id, err)
+	}
+	return err
+}
+
+// RetryJob releases a failed job and schedules its next attempt at runAt.
+func RetryJob(id int64, runAt time.Time, lastError string) error {
+	_, err := DB.Exec(`
+		UPDATE jobs SET run_at = ?, locked_until = NULL, last_error = ? WHERE id = ?
+	`, sqlTime(runAt), lastError, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: RetryJob exec error job=%d: %v", id, err)
+	}
+	return err
+}
+
+// BuryJob moves a job that ran out of attempts to the dead-letter table.
+func BuryJob(id int64, lastError string, now time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: BuryJob begin tx error job=%d: %v", id, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO dead_jobs (kind, payload, attempts, max_attempts, last_error, created_at, failed_at)
+		SELECT kind, payload, attempts, max_attempts, ?, created_at, ? FROM jobs WHERE id = ?
+	`, lastError, sqlTime(now), id); err != nil {
+		logging.Log.Errorf("data-access: BuryJob insert error job=%d: %v", id, err)
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, id); err != nil {
+		logging.Log.Errorf("data-access: BuryJob delete error job=%d: %v", id, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: BuryJob commit error job=%d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetDeadJobs returns dead-lettered jobs, most recent first, with keyset
+// pagination on the id.
+func GetDeadJobs(cursor *int64, limit int) ([]models.Job, error) {
+	query := `
+		SELECT id, kind, payload, attempts, max_attempts, last_error, created_at, failed_at
+		FROM dead_jobs`
+	args := []any{}
+	if cursor != nil {
+		query += " WHERE id < ?"
+		args = append(args, *cursor)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetDeadJobs query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		var j models.Job
+		var payload string
+		var failedAt time.Time
+		if err := rows.Scan(&j.ID, &j.Kind, &payload, &j.Attempts, &j.MaxAttempts,
+			&j.LastError, &j.CreatedAt, &failedAt); err != nil {
+			logging.Log.Errorf("data-access: GetDeadJobs scan error: %v", err)
+			return nil, err
+		}
+		if payload != "" {
+			j.Payload = []byte(payload)
+		}
+		j.FailedAt = &failedAt
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// RequeueDeadJob moves a dead job back to the queue with a fresh set of
+// attempts, due at now. Returns the new job id, or 0 if there was no such
+// dead job.
+func RequeueDeadJob(id int64, now time.Time) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: RequeueDeadJob begin tx error job=%d: %v", id, err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO jobs (kind, payload, run_at, max_attempts)
+		SELECT kind, payload, ?, max_attempts FROM dead_jobs WHERE id = ?
+	`, sqlTime(now), id)
+	if err != nil {
+		logging.Log.Errorf("data-access: RequeueDeadJob insert error job=%d: %v", id, err)
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM dead_jobs WHERE id = ?`, id); err != nil {
+		logging.Log.Errorf("data-access: RequeueDeadJob delete error job=%d: %v", id, err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: RequeueDeadJob commit error job=%d: %v", id, err)
+		return 0, err
+	}
+	return newID, nil
+}
@@ -0,0 +1,73 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+
+	"dating-backend/internal/models"
+)
+
+func TestJobQueue(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    job := &models.Job{Kind: "export", Payload: []byte(`{"user_id":1}`), RunAt: now, MaxAttempts: 2}
+    id, err := EnqueueJob(job, "export:1")
+    if err != nil || id == 0 { t.Fatalf("enqueue: id=%d err=%v", id, err) }
+    if dup, err := EnqueueJob(job, "export:1"); err != nil || dup != 0 {
+        t.Fatalf("expected duplicate key ignored, got id=%d err=%v", dup, err)
+    }
+
+    claimed, err := ClaimJob(now, now.Add(time.Minute))
+    if err != nil { t.Fatalf("claim: %v", err) }
+    if claimed == nil || claimed.ID != id || claimed.Attempts != 1 || string(claimed.Payload) != `{"user_id":1}` {
+        t.Fatalf("unexpected claimed job %+v", claimed)
+    }
+    if again, _ := ClaimJob(now, now.Add(time.Minute)); again != nil {
+        t.Fatalf("expected claimed job hidden, got %+v", again)
+    }
+    if again, _ := ClaimJob(now.Add(time.Minute), now.Add(2*time.Minute)); again == nil || again.Attempts != 2 {
+        t.Fatalf("expected job visible after lock expiry, got %+v", again)
+    }
+
+    if err := BuryJob(id, "boom", now); err != nil { t.Fatalf("bury: %v", err) }
+    dead, err := GetDeadJobs(nil, 10)
+    if err != nil { t.Fatalf("dead: %v", err) }
+    if len(dead) != 1 || dead[0].LastError != "boom" || dead[0].Attempts != 2 {
+        t.Fatalf("unexpected dead jobs %+v", dead)
+    }
+
+    newID, err := RequeueDeadJob(dead[0].ID, now)
+    if err != nil || newID == 0 { t.Fatalf("requeue: id=%d err=%v", newID, err) }
+    claimed, err = ClaimJob(now, now.Add(time.Minute))
+    if err != nil { t.Fatalf("claim: %v", err) }
+    if claimed == nil || claimed.ID != newID || claimed.Attempts != 1 {
+        t.Fatalf("expected requeued job with fresh attempts, got %+v", claimed)
+    }
+    if dead, _ := GetDeadJobs(nil, 10); len(dead) != 0 {
+        t.Fatalf("expected dead letter emptied, got %+v", dead)
+    }
+}
+
+func TestJobKeyOutlivesJob(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    job := &models.Job{Kind: "tick", RunAt: now, MaxAttempts: 1}
+    id, err := EnqueueJob(job, "tick:1741608000")
+    if err != nil || id == 0 { t.Fatalf("enqueue: id=%d err=%v", id, err) }
+    if err := CompleteJob(id); err != nil { t.Fatalf("complete: %v", err) }
+
+    // the occurrence already ran, another worker must not enqueue it again
+    if dup, err := EnqueueJob(job, "tick:1741608000"); err != nil || dup != 0 {
+        t.Fatalf("expected completed key ignored, got id=%d err=%v", dup, err)
+    }
+
+    // keys are forgotten after JobKeyRetention
+    DB.Exec(`UPDATE job_keys SET created_at = ?`, sqlTime(time.Now().Add(-JobKeyRetention-time.Hour)))
+    if again, err := EnqueueJob(job, "tick:1741608000"); err != nil || again == 0 {
+        t.Fatalf("expected expired key enqueued again, got id=%d err=%v", again, err)
+    }
+}
@@ -0,0 +1,152 @@
+package data_access
+
+import (
+	"database/sql"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"dating-backend/internal/utils"
+)
+
+// inboxWhere selects inbound likes the user hasn't answered with a swipe.
+const inboxWhere = `
+	s.target_id = ?
+	AND s.action IN ('like', 'superlike')
+	AND NOT EXISTS (
+		SELECT 1 FROM swipes r WHERE r.user_id = s.target_id AND r.target_id = s.user_id
+	)`
+
+// GetLikesInbox returns inbound likes the user hasn't answered yet, newest
+// first. cursor is the swipe id of the last item of the previous page.
+func GetLikesInbox(userID int64, cursor *int64, limit int) ([]models.LikeInboxItem, error) {
+	query := `
+		SELECT s.id, s.action, s.created_at, s.seen_at IS NOT NULL,
+			u.id, IFNULL(u.name, ''), u.birthday, IFNULL(u.photo_url, ''),
+			IFNULL(s.comment, ''), s.content_type, s.content_id,
+			IFNULL(p.text, ''), IFNULL(up.answer, ''), IFNULL(ph.blob_key, '')
+		FROM swipes s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN user_prompts up ON s.content_type = 'prompt' AND up.id = s.content_id AND up.user_id = s.target_id
+		LEFT JOIN prompts p ON p.id = up.prompt_id
+		LEFT JOIN user_photos ph ON s.content_type = 'photo' AND ph.id = s.content_id AND ph.user_id = s.target_id
+		WHERE` + inboxWhere
+	args := []any{userID}
+	if cursor != nil {
+		query += " AND s.id < ?"
+		args = append(args, *cursor)
+	}
+	query += " ORDER BY s.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetLikesInbox query error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.LikeInboxItem{}
+	for rows.Next() {
+		var it models.LikeInboxItem
+		var b models.SQLiteDate
+		var contentType sql.NullString
+		var contentID sql.NullInt64
+		var c models.LikedContent
+		var photoKey string
+		if err := rows.Scan(&it.SwipeID, &it.Action, &it.CreatedAt, &it.Seen,
+			&it.User.ID, &it.User.Name, &b, &it.User.PhotoURL,
+			&it.Comment, &contentType, &contentID, &c.Question, &c.Answer, &photoKey); err != nil {
+			logging.Log.Errorf("data-access: GetLikesInbox scan error user=%d: %v", userID, err)
+			return nil, err
+		}
+		if !b.Time.IsZero() {
+			it.User.Age = utils.GetAge(&b.Time)
+		}
+		// content the user removed since is left out
+		if photoKey != "" {
+			c.PhotoURL = models.PhotoURL(photoKey, models.PrimaryPhotoVariant)
+		}
+		if contentType.Valid && (c.Answer != "" || c.PhotoURL != "") {
+			c.Type, c.ID = contentType.String, contentID.Int64
+			it.Content = &c
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// CountLikesInbox returns the number of unanswered inbound likes and how
+// many of them the user hasn't seen yet.
+func CountLikesInbox(userID int64) (int, int, error) {
+	var total, unseen int
+	err := DB.QueryRow(`
+		SELECT COUNT(*), IFNULL(SUM(s.seen_at IS NULL), 0)
+		FROM swipes s
+		WHERE`+inboxWhere, userID).Scan(&total, &unseen)
+	if err != nil {
+		logging.Log.Errorf("data-access: CountLikesInbox error user=%d: %v", userID, err)
+		return 0, 0, err
+	}
+	return total, unseen, nil
+}
+
+// MarkLikesSeen marks inbound likes as seen. With no ids every inbound like
+// of the user is marked.
+func MarkLikesSeen(userID int64, swipeIDs []int64) error {
+	query := `UPDATE swipes SET seen_at = datetime('now')
+		WHERE target_id = ? AND seen_at IS NULL`
+	args := []any{userID}
+	if len(swipeIDs) > 0 {
+		query += " AND id IN ("
+		for i, id := range swipeIDs {
+			if i > 0 {
+				query += ","
+			}
+			query += "?"
+			args = append(args, id)
+		}
+		query += ")"
+	}
+
+	_, err := DB.Exec(query, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: MarkLikesSeen error user=%d: %v", userID, err)
+	}
+	return err
+}
+
+// GetProfileSummary returns the compact profile of a user.
+func GetProfileSummary(userID int64) (*models.ProfileSummary, error) {
+	p := &models.ProfileSummary{}
+	var b models.SQLiteDate
+	err := DB.QueryRow(`
+		SELECT id, IFNULL(name, ''), birthday, IFNULL(photo_url, '')
+		FROM users WHERE id = ?
+	`, userID).Scan(&p.ID, &p.Name, &b, &p.PhotoURL)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetProfileSummary error user=%d: %v", userID, err)
+		return nil, err
+	}
+	if !b.Time.IsZero() {
+		p.Age = utils.GetAge(&b.Time)
+	}
+	return p, nil
+}
+
+// HasEntitlement reports whether the user holds a non-expired entitlement
+// such as "see_likes".
+func HasEntitlement(userID int64, entitlement string) (bool, error) {
+	var one int
+	err := DB.QueryRow(`
+		SELECT 1 FROM user_entitlements
+		WHERE user_id = ? AND entitlement = ?
+			AND (expires_at IS NULL OR expires_at > datetime('now'))
+	`, userID, entitlement).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: HasEntitlement error user=%d entitlement=%s: %v", userID, entitlement, err)
+		return false, err
+	}
+	return true, nil
+}
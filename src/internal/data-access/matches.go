@@ -0,0 +1,245 @@
+package data_access
+
+import (
+	"database/sql"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"dating-backend/internal/utils"
+	"time"
+)
+
+// CreateMatch records a match between two users for the given chat. An
+// expired match is reactivated if rematchExpired is set; an unmatched one
+// never is. Otherwise the existing match is returned unchanged.
+// Returns the match and whether it was created or reactivated now.
+func CreateMatch(userA, userB, chatID int64, source string, rematchExpired bool) (*models.Match, bool, error) {
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+
+	res, err := DB.Exec(`
+		INSERT INTO matches (user1_id, user2_id, chat_id, source)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user1_id, user2_id) DO UPDATE SET
+			status = 'active',
+			source = excluded.source,
+			chat_id = excluded.chat_id,
+			created_at = datetime('now'),
+			updated_at = datetime('now'),
+			warned_at = NULL
+		WHERE matches.status = 'expired' AND ?
+	`, userA, userB, chatID, source, rematchExpired)
+	if err != nil {
+		logging.Log.Errorf("data-access: CreateMatch exec error userA=%d userB=%d: %v", userA, userB, err)
+		return nil, false, err
+	}
+	n, _ := res.RowsAffected()
+
+	m := &models.Match{}
+	err = DB.QueryRow(`
+		SELECT id, chat_id, source, status, created_at
+		FROM matches WHERE user1_id = ? AND user2_id = ?
+	`, userA, userB).Scan(&m.ID, &m.ChatID, &m.Source, &m.Status, &m.CreatedAt)
+	if err != nil {
+		logging.Log.Errorf("data-access: CreateMatch select error userA=%d userB=%d: %v", userA, userB, err)
+		return nil, false, err
+	}
+	return m, n > 0, nil
+}
+
+// GetMatchesForUser returns the user's active matches, newest first, with
+// the other user's profile. state "new" keeps matches without messages,
+// "active" keeps those with a conversation; empty returns both.
+func GetMatchesForUser(userID int64, state string) ([]models.Match, error) {
+	query := `
+		SELECT * FROM (
+			SELECT m.id, m.chat_id, m.source, m.status, m.created_at,
+				u.id, IFNULL(u.name, ''), u.birthday, IFNULL(u.photo_url, ''),
+				(SELECT MAX(created_at) FROM messages WHERE chat_id = m.chat_id) AS last_message_time
+			FROM matches m
+			JOIN users u ON u.id = CASE WHEN m.user1_id = ? THEN m.user2_id ELSE m.user1_id END
+			WHERE (m.user1_id = ? OR m.user2_id = ?) AND m.status = 'active'
+		) sub`
+	switch state {
+	case "new":
+		query += " WHERE last_message_time IS NULL"
+	case "active":
+		query += " WHERE last_message_time IS NOT NULL"
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := DB.Query(query, userID, userID, userID)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetMatchesForUser query error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []models.Match{}
+	for rows.Next() {
+		var m models.Match
+		var b models.SQLiteDate
+		var last sql.NullString
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Source, &m.Status, &m.CreatedAt,
+			&m.User.ID, &m.User.Name, &b, &m.User.PhotoURL, &last); err != nil {
+			logging.Log.Errorf("data-access: GetMatchesForUser scan error user=%d: %v", userID, err)
+			return nil, err
+		}
+		if !b.Time.IsZero() {
+			m.User.Age = utils.GetAge(&b.Time)
+		}
+		if last.Valid {
+			t, err := time.Parse("2006-01-02 15:04:05", last.String)
+			if err != nil {
+				logging.Log.Errorf("data-access: GetMatchesForUser parse time error match=%d: %v", m.ID, err)
+				return nil, err
+			}
+			m.HasMessages = true
+			m.LastMessageTime = &t
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// Unmatch marks an active match of the user as unmatched and returns the
+// match with the other user's id, or nil if there was nothing to unmatch.
+// The pair's likes turn into dislikes, so neither meets the other again in
+// discovery and a new like can't bring the match back.
+func Unmatch(matchID, userID int64) (*models.Match, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: Unmatch begin tx error match=%d user=%d: %v", matchID, userID, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE matches SET status = 'unmatched', updated_at = datetime('now')
+		WHERE id = ? AND (user1_id = ? OR user2_id = ?) AND status = 'active'
+	`, matchID, userID, userID)
+	if err != nil {
+		logging.Log.Errorf("data-access: Unmatch exec error match=%d user=%d: %v", matchID, userID, err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+
+	m := &models.Match{}
+	err = tx.QueryRow(`
+		SELECT id, chat_id, source, status, created_at,
+			CASE WHEN user1_id = ? THEN user2_id ELSE user1_id END
+		FROM matches WHERE id = ?
+	`, userID, matchID).Scan(&m.ID, &m.ChatID, &m.Source, &m.Status, &m.CreatedAt, &m.User.ID)
+	if err != nil {
+		logging.Log.Errorf("data-access: Unmatch select error match=%d: %v", matchID, err)
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE swipes SET action = 'dislike', content_type = NULL, content_id = NULL, comment = NULL
+		WHERE (user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?)
+	`, userID, m.User.ID, m.User.ID, userID); err != nil {
+		logging.Log.Errorf("data-access: Unmatch swipes error match=%d: %v", matchID, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: Unmatch commit error match=%d: %v", matchID, err)
+		return nil, err
+	}
+	return m, nil
+}
+
+// expiringWhere selects active matches nobody has written in yet.
+const expiringWhere = `
+	status = 'active'
+	AND NOT EXISTS (SELECT 1 FROM messages WHERE chat_id = matches.chat_id)`
+
+// GetMatchesToWarn returns silent matches created at or before createdBefore
+// whose users haven't been warned about the upcoming expiry yet.
+func GetMatchesToWarn(createdBefore time.Time) ([]models.MatchPair, error) {
+	rows, err := DB.Query(`
+		SELECT id, chat_id, user1_id, user2_id, created_at FROM matches
+		WHERE `+expiringWhere+` AND warned_at IS NULL AND created_at <= ?
+	`, sqlTime(createdBefore))
+	if err != nil {
+		logging.Log.Errorf("data-access: GetMatchesToWarn query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMatchPairs(rows)
+}
+
+// MarkMatchWarned records that the pair was warned about the expiry.
+func MarkMatchWarned(matchID int64, now time.Time) error {
+	_, err := DB.Exec(`UPDATE matches SET warned_at = ? WHERE id = ?`, sqlTime(now), matchID)
+	if err != nil {
+		logging.Log.Errorf("data-access: MarkMatchWarned exec error match=%d: %v", matchID, err)
+	}
+	return err
+}
+
+// ExpireMatches marks silent matches created at or before createdBefore as
+// expired and returns them. With rematch set the pair's swipes on each other
+// are removed so they can meet again in discovery; otherwise the swipes stay
+// and the pair is kept apart for good.
+func ExpireMatches(createdBefore time.Time, now time.Time, rematch bool) ([]models.MatchPair, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: ExpireMatches begin tx error: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, chat_id, user1_id, user2_id, created_at FROM matches
+		WHERE `+expiringWhere+` AND created_at <= ?
+	`, sqlTime(createdBefore))
+	if err != nil {
+		logging.Log.Errorf("data-access: ExpireMatches query error: %v", err)
+		return nil, err
+	}
+	pairs, err := scanMatchPairs(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pairs {
+		if _, err := tx.Exec(`
+			UPDATE matches SET status = 'expired', updated_at = ? WHERE id = ?
+		`, sqlTime(now), p.ID); err != nil {
+			logging.Log.Errorf("data-access: ExpireMatches update error match=%d: %v", p.ID, err)
+			return nil, err
+		}
+		if !rematch {
+			continue
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM swipes
+			WHERE (user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?)
+		`, p.User1ID, p.User2ID, p.User2ID, p.User1ID); err != nil {
+			logging.Log.Errorf("data-access: ExpireMatches delete swipes error match=%d: %v", p.ID, err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: ExpireMatches commit error: %v", err)
+		return nil, err
+	}
+	return pairs, nil
+}
+
+func scanMatchPairs(rows *sql.Rows) ([]models.MatchPair, error) {
+	var pairs []models.MatchPair
+	for rows.Next() {
+		var p models.MatchPair
+		if err := rows.Scan(&p.ID, &p.ChatID, &p.User1ID, &p.User2ID, &p.CreatedAt); err != nil {
+			logging.Log.Errorf("data-access: scan match pair error: %v", err)
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
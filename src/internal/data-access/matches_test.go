@@ -0,0 +1,106 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireMatches(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    created := sqlTime(now.Add(-4 * 24 * time.Hour))
+
+    // 1-2 never wrote, 3-4 did
+    for _, pair := range [][2]int64{{1, 2}, {3, 4}} {
+        if err := UpsertSwipe(pair[0], pair[1], "like"); err != nil { t.Fatalf("upsert: %v", err) }
+        if err := UpsertSwipe(pair[1], pair[0], "like"); err != nil { t.Fatalf("upsert: %v", err) }
+        _, chatID, err := CreateOrGetChat(pair[0], pair[1])
+        if err != nil { t.Fatalf("chat: %v", err) }
+        if _, _, err := CreateMatch(pair[0], pair[1], chatID, "like", true); err != nil { t.Fatalf("match: %v", err) }
+    }
+    if _, err := DB.Exec(`UPDATE matches SET created_at = ?`, created); err != nil { t.Fatalf("backdate: %v", err) }
+    if _, err := DB.Exec(`INSERT INTO messages (chat_id, sender_id, receiver_id, content) VALUES (2, 3, 4, 'hi')`); err != nil {
+        t.Fatalf("message: %v", err)
+    }
+
+    warn, err := GetMatchesToWarn(now.Add(-3 * 24 * time.Hour))
+    if err != nil { t.Fatalf("warn: %v", err) }
+    if len(warn) != 1 || warn[0].User1ID != 1 || warn[0].User2ID != 2 {
+        t.Fatalf("expected only the silent match to be warned, got %+v", warn)
+    }
+    if err := MarkMatchWarned(warn[0].ID, now); err != nil { t.Fatalf("mark warned: %v", err) }
+    warn, err = GetMatchesToWarn(now.Add(-3 * 24 * time.Hour))
+    if err != nil { t.Fatalf("warn: %v", err) }
+    if len(warn) != 0 {
+        t.Fatalf("expected no repeated warning, got %+v", warn)
+    }
+
+    // not old enough yet
+    expired, err := ExpireMatches(now.Add(-5 * 24 * time.Hour), now, true)
+    if err != nil { t.Fatalf("expire: %v", err) }
+    if len(expired) != 0 {
+        t.Fatalf("expected nothing expired, got %+v", expired)
+    }
+
+    expired, err = ExpireMatches(now.Add(-3 * 24 * time.Hour), now, true)
+    if err != nil { t.Fatalf("expire: %v", err) }
+    if len(expired) != 1 || expired[0].User1ID != 1 {
+        t.Fatalf("expected the silent match expired, got %+v", expired)
+    }
+    if liked, _ := HasLiked(1, 2); liked {
+        t.Fatalf("expected swipes removed so the pair can rematch")
+    }
+
+    m, created2, err := CreateMatch(1, 2, expired[0].ChatID, "like", false)
+    if err != nil { t.Fatalf("match: %v", err) }
+    if created2 || m.Status != "expired" {
+        t.Fatalf("expected expired match kept without rematch, got %+v created=%v", m, created2)
+    }
+    m, created2, err = CreateMatch(1, 2, expired[0].ChatID, "like", true)
+    if err != nil { t.Fatalf("match: %v", err) }
+    if !created2 || m.Status != "active" {
+        t.Fatalf("expected rematch to reactivate, got %+v created=%v", m, created2)
+    }
+
+    // the rematch starts a fresh expiry cycle, warning included
+    if _, err := DB.Exec(`UPDATE matches SET created_at = ? WHERE id = ?`, created, m.ID); err != nil { t.Fatalf("backdate: %v", err) }
+    warn, err = GetMatchesToWarn(now.Add(-3 * 24 * time.Hour))
+    if err != nil { t.Fatalf("warn: %v", err) }
+    if len(warn) != 1 || warn[0].ID != m.ID {
+        t.Fatalf("expected the rematched pair warned again, got %+v", warn)
+    }
+}
+
+func TestUnmatchKeepsPairApart(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if err := UpsertSwipe(1, 2, "like"); err != nil { t.Fatalf("upsert: %v", err) }
+    if err := UpsertSwipe(2, 1, "like"); err != nil { t.Fatalf("upsert: %v", err) }
+    _, chatID, err := CreateOrGetChat(1, 2)
+    if err != nil { t.Fatalf("chat: %v", err) }
+    m, _, err := CreateMatch(1, 2, chatID, "like", true)
+    if err != nil { t.Fatalf("match: %v", err) }
+
+    um, err := Unmatch(m.ID, 1)
+    if err != nil { t.Fatalf("unmatch: %v", err) }
+    if um == nil || um.User.ID != 2 {
+        t.Fatalf("expected match with user 2 unmatched, got %+v", um)
+    }
+    if liked, _ := HasLiked(2, 1); liked {
+        t.Fatalf("expected the other side's like dropped on unmatch")
+    }
+
+    // re-like: no mutual like, and the match itself stays unmatched
+    if err := UpsertSwipe(1, 2, "like"); err != nil { t.Fatalf("upsert: %v", err) }
+    if liked, _ := HasLiked(2, 1); liked {
+        t.Fatalf("expected no mutual like after re-like")
+    }
+    m, created, err := CreateMatch(1, 2, chatID, "like", true)
+    if err != nil { t.Fatalf("match: %v", err) }
+    if created || m.Status != "unmatched" {
+        t.Fatalf("expected unmatched pair kept apart, got %+v created=%v", m, created)
+    }
+}
@@ -1,23 +1,88 @@
 package data_access
 
 import (
+	"database/sql"
 	"dating-backend/internal/logging"
 	"dating-backend/internal/models"
 	"time"
 )
 
-// SaveMessage persists a message and returns the new message id.
-// The database sets the created_at timestamp.
-func SaveMessage(msg *models.Message) (int64, error) {
-	res, err := DB.Exec(`
-		INSERT INTO messages (chat_id, sender_id, receiver_id, content, is_read, created_at)
-		VALUES (?, ?, ?, ?, 0, datetime('now'))
-	`, msg.ChatID, msg.SenderID, msg.ReceiverID, msg.Content)
+// SaveMessage persists a message and fills in its id and created_at, which
+// the database sets, and links the uploads listed in AttachmentIDs to it
+// (ErrInvalidAttachments if one can't be). If the sender already sent a
+// message with the same ClientID, nothing is stored: msg is overwritten
+// with the earlier message and created is false.
+func SaveMessage(msg *models.Message) (created bool, err error) {
+	var clientID any
+	if msg.ClientID != "" {
+		clientID = msg.ClientID
+	}
+	tx, err := DB.Begin()
 	if err != nil {
+		logging.Log.Errorf("data-access: SaveMessage begin tx error chat=%d sender=%d: %v", msg.ChatID, msg.SenderID, err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO messages (chat_id, sender_id, receiver_id, content, is_read, created_at, client_id)
+		VALUES (?, ?, ?, ?, 0, datetime('now'), ?)
+		ON CONFLICT (sender_id, client_id) WHERE client_id IS NOT NULL DO NOTHING
+		RETURNING id, created_at
+	`, msg.ChatID, msg.SenderID, msg.ReceiverID, msg.Content, clientID).Scan(&msg.ID, &msg.CreatedAt)
+	if err == nil {
+		if err := linkAttachments(tx, msg); err != nil {
+			return false, err
+		}
+		if err := tx.Commit(); err != nil {
+			logging.Log.Errorf("data-access: SaveMessage commit error chat=%d sender=%d: %v", msg.ChatID, msg.SenderID, err)
+			return false, err
+		}
+		return true, nil
+	}
+	if err != sql.ErrNoRows {
 		logging.Log.Errorf("data-access: SaveMessage exec error chat=%d sender=%d receiver=%d: %v", msg.ChatID, msg.SenderID, msg.ReceiverID, err)
-		return 0, err
+		return false, err
 	}
-	return res.LastInsertId()
+
+	err = tx.QueryRow(`
+		SELECT id, chat_id, receiver_id, content, read_at IS NOT NULL, created_at
+		FROM messages WHERE sender_id = ? AND client_id = ?
+	`, msg.SenderID, msg.ClientID).Scan(&msg.ID, &msg.ChatID, &msg.ReceiverID, &msg.Content, &msg.IsRead, &msg.CreatedAt)
+	if err != nil {
+		logging.Log.Errorf("data-access: SaveMessage lookup error sender=%d client_id=%s: %v", msg.SenderID, msg.ClientID, err)
+		return false, err
+	}
+	msg.AttachmentIDs = nil
+	return false, nil
+}
+
+// IsChatParticipant reports whether the user is one of the two people in
+// the chat and the chat is still open: its match, if any, is active.
+func IsChatParticipant(chatID, userID int64) (bool, error) {
+	peerID, err := GetChatPeer(chatID, userID)
+	return peerID != 0, err
+}
+
+// GetChatPeer returns the other person in the chat, or 0 unless the user
+// is a participant of the chat and it is still open, like
+// IsChatParticipant.
+func GetChatPeer(chatID, userID int64) (int64, error) {
+	var peerID int64
+	err := DB.QueryRow(`
+		SELECT IIF(c.user1_id = ?2, c.user2_id, c.user1_id)
+		FROM chats c
+		LEFT JOIN matches mt ON mt.chat_id = c.id
+		WHERE c.id = ?1 AND (c.user1_id = ?2 OR c.user2_id = ?2)
+			AND (mt.status IS NULL OR mt.status = 'active')
+	`, chatID, userID).Scan(&peerID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: GetChatPeer error chat=%d user=%d: %v", chatID, userID, err)
+	}
+	return peerID, err
 }
 
 // CreateOrGetChat returns whether a new chat was created, the chat id and
@@ -68,6 +133,10 @@ func CreateOrGetChat(userA, userB int64) (bool, int64, error) {
 
 // GetChatsForUser returns chat list for a given user. The returned Chat
 // includes computed fields such as LastMessage and LastMessageTime if any.
+// Chats of matches that are no longer active are left out. Messages the
+// user deleted for themselves don't count as the last message. IsRead
+// tells whether the user read the last message; their own last message
+// counts as read, as the other side's reading shows only in read_at.
 func GetChatsForUser(userID int64) ([]models.Chat, error) {
 	rows, err := DB.Query(`
 		SELECT 
@@ -76,22 +145,28 @@ func GetChatsForUser(userID int64) ([]models.Chat, error) {
 		c.user2_id, 
 		c.created_at, 
 		IFNULL(m.last_message, '') AS last_message, 
+		IFNULL(m.last_message_deleted, 0) AS last_message_deleted,
 		IFNULL(m.last_message_time, '') AS last_message_time,
 		IFNULL(m.last_message_user, 0) AS last_message_user,
-		m.is_read
+		IFNULL(m.is_read, 1) AS is_read
 		FROM chats c
 		LEFT JOIN (
 			SELECT 
 			chat_id, 
-			content AS last_message, 
+			CASE WHEN deleted_at IS NULL THEN content ELSE '' END AS last_message, 
+			deleted_at IS NOT NULL AS last_message_deleted,
 			sender_id AS last_message_user,
-			MAX(created_at) AS last_message_time,
-			is_read
+			datetime(created_at) AS last_message_time,
+			IIF(sender_id = ?, 1, is_read) AS is_read,
+			MAX(id)
 			FROM messages
+			WHERE NOT `+hiddenFor+`
 			GROUP BY chat_id
 		) m ON c.id = m.chat_id
-		WHERE c.user1_id = ? OR c.user2_id = ?
-	`, userID, userID)
+		LEFT JOIN matches mt ON mt.chat_id = c.id
+		WHERE (c.user1_id = ? OR c.user2_id = ?)
+			AND (mt.status IS NULL OR mt.status = 'active')
+	`, userID, userID, userID, userID)
 	if err != nil {
  		logging.Log.Errorf("data-access: GetChatsForUser query error user=%d: %v", userID, err)
 		return nil, err
@@ -103,13 +178,10 @@ func GetChatsForUser(userID int64) ([]models.Chat, error) {
 		var c models.Chat
 		var lastMessageTimeStr string
  			if err := rows.Scan(&c.ID, &c.User1ID, &c.User2ID, &c.CreatedAt, &c.LastMessage,
- 				&lastMessageTimeStr, &c.LastMessageUser, &c.IsRead); err != nil {
+ 				&c.LastMessageDeleted, &lastMessageTimeStr, &c.LastMessageUser, &c.IsRead); err != nil {
  				logging.Log.Errorf("data-access: GetChatsForUser scan error user=%d: %v", userID, err)
  				return nil, err
  			}
-		if c.LastMessageUser == userID || c.LastMessageUser == 0 {
-			c.IsRead = true
-		}
 		if lastMessageTimeStr != "" {
 			parsedTime, err := time.Parse("2006-01-02 15:04:05", lastMessageTimeStr)
  				if err != nil {
@@ -127,22 +199,23 @@ func GetChatsForUser(userID int64) ([]models.Chat, error) {
 // pagination. If both beforeID and afterID are nil the function returns
 // the most recent `limit` messages. If beforeID is provided it returns
 // older messages (IDs < beforeID), if afterID is provided it returns
-// newer messages (IDs > afterID).
-func GetMessagesForChat(chatID int64, beforeID, afterID *int64, limit int) ([]models.Message, error) {
+// newer messages (IDs > afterID). Messages userID deleted for themselves
+// are skipped.
+func GetMessagesForChat(chatID, userID int64, beforeID, afterID *int64, limit int) ([]models.Message, error) {
 	// Case 1: First load — get LAST MESSAGES
 	if beforeID == nil && afterID == nil {
 		query := `
 			SELECT * FROM (
-				SELECT id, sender_id, receiver_id, content, is_read, created_at
+				SELECT `+messageColumns+`
 				FROM messages
-				WHERE chat_id = ?
+				WHERE chat_id = ? AND NOT `+hiddenFor+`
 				ORDER BY id DESC
 				LIMIT ?
 			) sub
 			ORDER BY id ASC
 		`
 
-		rows, err := DB.Query(query, chatID, limit)
+		rows, err := DB.Query(query, userID, chatID, userID, limit)
  		if err != nil {
  			logging.Log.Errorf("data-access: GetMessagesForChat query error chat=%d: %v", chatID, err)
  			return nil, err
@@ -152,7 +225,7 @@ func GetMessagesForChat(chatID int64, beforeID, afterID *int64, limit int) ([]mo
 		var msgs []models.Message
 		for rows.Next() {
 			var m models.Message
- 				if err := rows.Scan(&m.ID, &m.SenderID, &m.ReceiverID, &m.Content, &m.IsRead, &m.CreatedAt); err != nil {
+ 				if err := scanMessage(rows, &m); err != nil {
  						logging.Log.Errorf("data-access: GetMessagesForChat scan error chat=%d: %v", chatID, err)
  						return nil, err
  						}
@@ -163,11 +236,11 @@ func GetMessagesForChat(chatID int64, beforeID, afterID *int64, limit int) ([]mo
 
 	// ✅ Case 2/3: old or new messages
 	query := `
-		SELECT id, sender_id, receiver_id, content, is_read, created_at
+		SELECT `+messageColumns+`
 		FROM messages
-		WHERE chat_id = ?
+		WHERE chat_id = ? AND NOT `+hiddenFor+`
 	`
-	args := []interface{}{chatID}
+	args := []interface{}{userID, chatID, userID}
 
 	if beforeID != nil {
 		query += " AND id < ?"
@@ -205,7 +278,7 @@ func GetMessagesForChat(chatID int64, beforeID, afterID *int64, limit int) ([]mo
 	var msgs []models.Message
 	for rows.Next() {
 		var m models.Message
-		if err := rows.Scan(&m.ID, &m.SenderID, &m.ReceiverID, &m.Content, &m.IsRead, &m.CreatedAt); err != nil {
+		if err := scanMessage(rows, &m); err != nil {
 			return nil, err
 		}
 		msgs = append(msgs, m)
@@ -214,38 +287,226 @@ func GetMessagesForChat(chatID int64, beforeID, afterID *int64, limit int) ([]mo
 	return msgs, nil
 }
 
-// MarkMessagesAsReadForChat marks unread messages in a chat as read for the
-// given receiver. Returns true on success.
-func MarkMessagesAsReadForChat(chatID int64, userID int64) (bool, error) {
-	_, err := DB.Exec(`
-		UPDATE messages SET is_read = 1
-		WHERE chat_id = ? AND receiver_id = ? AND is_read = 0
-	`, chatID, userID)
- 	if err != nil {
- 		logging.Log.Errorf("data-access: MarkMessagesAsReadForChat exec error chat=%d user=%d: %v", chatID, userID, err)
- 		return false, err
- 	}
+// messageColumns selects a message for scanMessage, as seen by the user
+// bound to its first placeholder. Messages deleted for everyone come back
+// as tombstones, without content.
+const messageColumns = `id, chat_id, sender_id, receiver_id,
+	CASE WHEN deleted_at IS NULL THEN content ELSE '' END,
+	` + isReadFor + `, created_at, delivered_at, read_at, edited_at, deleted_at`
+
+// isReadFor is is_read as seen by the user bound to its placeholder. The
+// receiver sees whether they read the message; the sender only sees it
+// read through the read receipt, which stays empty if the receiver hides
+// read receipts.
+const isReadFor = `IIF(sender_id = ?, read_at IS NOT NULL, is_read)`
+
+// hiddenFor matches messages the user bound to its parameter deleted for
+// themselves.
+const hiddenFor = `EXISTS (SELECT 1 FROM message_deletions d WHERE d.message_id = messages.id AND d.user_id = ?)`
+
+// scanMessage scans a row selected with messageColumns.
+func scanMessage(rows *sql.Rows, m *models.Message) error {
+	var deliveredAt, readAt, editedAt, deletedAt sql.NullTime
+	if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.ReceiverID, &m.Content, &m.IsRead, &m.CreatedAt,
+		&deliveredAt, &readAt, &editedAt, &deletedAt); err != nil {
+		return err
+	}
+	m.DeliveredAt = nullTime(deliveredAt)
+	m.ReadAt = nullTime(readAt)
+	m.EditedAt = nullTime(editedAt)
+	m.DeletedAt = nullTime(deletedAt)
+	return nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// GetMessage returns a message as seen by viewerID with its stored
+// content, even if it was deleted, or nil if there is no such message.
+func GetMessage(id, viewerID int64) (*models.Message, error) {
+	rows, err := DB.Query(`
+		SELECT id, chat_id, sender_id, receiver_id, content, `+isReadFor+`, created_at, delivered_at, read_at, edited_at, deleted_at
+		FROM messages WHERE id = ?
+	`, viewerID, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetMessage query error id=%d: %v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var m models.Message
+	if err := scanMessage(rows, &m); err != nil {
+		logging.Log.Errorf("data-access: GetMessage scan error id=%d: %v", id, err)
+		return nil, err
+	}
+	return &m, nil
+}
+
+// EditMessage replaces the content of a message that isn't deleted and
+// keeps the previous version in message_edits. updated is false if the
+// message is gone or was deleted.
+func EditMessage(id int64, content string, now time.Time) (updated bool, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: EditMessage begin tx error id=%d: %v", id, err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO message_edits (message_id, content, edited_at)
+		SELECT id, content, ? FROM messages WHERE id = ? AND deleted_at IS NULL
+	`, sqlTime(now), id); err != nil {
+		logging.Log.Errorf("data-access: EditMessage history error id=%d: %v", id, err)
+		return false, err
+	}
+	res, err := tx.Exec(`
+		UPDATE messages SET content = ?, edited_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, content, sqlTime(now), id)
+	if err != nil {
+		logging.Log.Errorf("data-access: EditMessage update error id=%d: %v", id, err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: EditMessage commit error id=%d: %v", id, err)
+		return false, err
+	}
 	return true, nil
 }
 
-// MarkMessagesAsRead marks messages identified by ids as read. Returns true
-// on success.
-func MarkMessagesAsRead(MessageIDs []int64) (bool, error) {
-	query := "UPDATE messages SET is_read = TRUE WHERE id IN ("
-	args := make([]interface{}, len(MessageIDs))
-	for i, id := range MessageIDs {
-		if i > 0 {
-			query += ","
+// GetMessageEdits returns the replaced versions of a message, oldest
+// first.
+func GetMessageEdits(id int64) ([]models.MessageEdit, error) {
+	rows, err := DB.Query(`
+		SELECT content, edited_at FROM message_edits
+		WHERE message_id = ? ORDER BY id
+	`, id)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetMessageEdits query error id=%d: %v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []models.MessageEdit{}
+	for rows.Next() {
+		var e models.MessageEdit
+		if err := rows.Scan(&e.Content, &e.EditedAt); err != nil {
+			logging.Log.Errorf("data-access: GetMessageEdits scan error id=%d: %v", id, err)
+			return nil, err
 		}
-		query += "?"
-		args[i] = id
+		edits = append(edits, e)
 	}
-	query += ")"
+	return edits, rows.Err()
+}
 
-	_, err := DB.Exec(query, args...)
- 	if err != nil {
- 		logging.Log.Errorf("data-access: MarkMessagesAsRead exec error ids=%v: %v", MessageIDs, err)
- 		return false, err
- 	}
-	return true, nil
-}
\ No newline at end of file
+// DeleteMessage unsends a message for everyone. The row stays as a
+// tombstone and keeps its content for moderation. deleted is false if the
+// message was already deleted.
+func DeleteMessage(id int64, now time.Time) (deleted bool, err error) {
+	res, err := DB.Exec(`UPDATE messages SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, sqlTime(now), id)
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteMessage exec error id=%d: %v", id, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteMessageForUser hides a message from one participant only.
+func DeleteMessageForUser(id, userID int64, now time.Time) error {
+	_, err := DB.Exec(`
+		INSERT OR IGNORE INTO message_deletions (message_id, user_id, deleted_at)
+		VALUES (?, ?, ?)
+	`, id, userID, sqlTime(now))
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteMessageForUser exec error id=%d user=%d: %v", id, userID, err)
+	}
+	return err
+}
+
+// MarkMessagesDelivered records that receiverID's device got the messages.
+// Only messages addressed to receiverID and not delivered before are
+// updated; they are returned with id, chat and sender filled in so the
+// senders can be told.
+func MarkMessagesDelivered(receiverID int64, messageIDs []int64, now time.Time) ([]models.Message, error) {
+	args := []any{sqlTime(now), receiverID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	rows, err := DB.Query(`
+		UPDATE messages SET delivered_at = ?
+		WHERE receiver_id = ? AND delivered_at IS NULL AND id IN (`+placeholders(len(messageIDs))+`)
+		RETURNING id, chat_id, sender_id
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: MarkMessagesDelivered exec error receiver=%d ids=%v: %v", receiverID, messageIDs, err)
+		return nil, err
+	}
+	return scanReceipts(rows, receiverID)
+}
+
+// MarkMessagesAsReadForChat marks the unread messages userID received in a
+// chat as read and returns them. read_at, the read receipt, is only set if
+// receipt is true; messages read count as delivered as well.
+func MarkMessagesAsReadForChat(chatID int64, userID int64, now time.Time, receipt bool) ([]models.Message, error) {
+	rows, err := DB.Query(`
+		UPDATE messages SET is_read = 1,
+			delivered_at = IFNULL(delivered_at, ?1),
+			read_at = CASE WHEN ?2 THEN ?1 END
+		WHERE chat_id = ?3 AND receiver_id = ?4 AND is_read = 0
+		RETURNING id, chat_id, sender_id
+	`, sqlTime(now), receipt, chatID, userID)
+	if err != nil {
+		logging.Log.Errorf("data-access: MarkMessagesAsReadForChat exec error chat=%d user=%d: %v", chatID, userID, err)
+		return nil, err
+	}
+	return scanReceipts(rows, userID)
+}
+
+// MarkMessagesAsRead marks the listed messages as read, like
+// MarkMessagesAsReadForChat. Ids of messages userID didn't receive, or has
+// read already, are ignored.
+func MarkMessagesAsRead(userID int64, messageIDs []int64, now time.Time, receipt bool) ([]models.Message, error) {
+	args := []any{sqlTime(now), receipt, userID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	rows, err := DB.Query(`
+		UPDATE messages SET is_read = 1,
+			delivered_at = IFNULL(delivered_at, ?1),
+			read_at = CASE WHEN ?2 THEN ?1 END
+		WHERE receiver_id = ?3 AND is_read = 0 AND id IN (`+placeholders(len(messageIDs))+`)
+		RETURNING id, chat_id, sender_id
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: MarkMessagesAsRead exec error user=%d ids=%v: %v", userID, messageIDs, err)
+		return nil, err
+	}
+	return scanReceipts(rows, userID)
+}
+
+func scanReceipts(rows *sql.Rows, receiverID int64) ([]models.Message, error) {
+	defer rows.Close()
+	var msgs []models.Message
+	for rows.Next() {
+		m := models.Message{ReceiverID: receiverID}
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID); err != nil {
+			logging.Log.Errorf("data-access: receipts scan error receiver=%d: %v", receiverID, err)
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
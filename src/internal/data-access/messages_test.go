@@ -0,0 +1,190 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+
+	"dating-backend/internal/models"
+)
+
+func TestSaveMessageIdempotent(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    msg := &models.Message{ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "hi", ClientID: "c1"}
+    created, err := SaveMessage(msg)
+    if err != nil || !created {
+        t.Fatalf("expected message created, created=%v err=%v", created, err)
+    }
+    if msg.ID == 0 || msg.CreatedAt.IsZero() {
+        t.Fatalf("expected id and created_at filled in, got %+v", msg)
+    }
+
+    retry := &models.Message{ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "hi again", ClientID: "c1"}
+    created, err = SaveMessage(retry)
+    if err != nil || created {
+        t.Fatalf("expected resend to be ignored, created=%v err=%v", created, err)
+    }
+    if retry.ID != msg.ID || retry.Content != "hi" || !retry.CreatedAt.Equal(msg.CreatedAt) {
+        t.Fatalf("expected the stored message back, got %+v", retry)
+    }
+
+    // client ids are per sender, and messages without one never collide
+    for _, m := range []*models.Message{
+        {ChatID: 1, SenderID: 2, ReceiverID: 1, Content: "yo", ClientID: "c1"},
+        {ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "a"},
+        {ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "a"},
+    } {
+        if created, err := SaveMessage(m); err != nil || !created {
+            t.Fatalf("expected %+v created, created=%v err=%v", m, created, err)
+        }
+    }
+}
+
+func TestMessageReceipts(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    var ids []int64
+    for _, m := range []*models.Message{
+        {ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "a"},
+        {ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "b"},
+        {ChatID: 1, SenderID: 2, ReceiverID: 1, Content: "c"},
+    } {
+        if _, err := SaveMessage(m); err != nil { t.Fatalf("save: %v", err) }
+        ids = append(ids, m.ID)
+    }
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+    // only the receiver can mark a message, and only once
+    if got, err := MarkMessagesDelivered(1, ids[:1], now); err != nil || len(got) != 0 {
+        t.Fatalf("expected sender unable to mark delivered, got %+v err=%v", got, err)
+    }
+    got, err := MarkMessagesDelivered(2, ids[:1], now)
+    if err != nil || len(got) != 1 || got[0].SenderID != 1 || got[0].ChatID != 1 {
+        t.Fatalf("expected receipt for the sender, got %+v err=%v", got, err)
+    }
+    if got, _ := MarkMessagesDelivered(2, ids[:1], now.Add(time.Minute)); len(got) != 0 {
+        t.Fatalf("expected delivery recorded once, got %+v", got)
+    }
+
+    got, err = MarkMessagesAsRead(2, ids, now.Add(time.Hour), false)
+    if err != nil || len(got) != 2 {
+        t.Fatalf("expected the two received messages read, got %+v err=%v", got, err)
+    }
+    if got, _ := MarkMessagesAsReadForChat(1, 1, now.Add(time.Hour), true); len(got) != 1 || got[0].ID != ids[2] {
+        t.Fatalf("expected user 1's received message read, got %+v", got)
+    }
+
+    msgs, err := GetMessagesForChat(1, 1, nil, nil, 10)
+    if err != nil { t.Fatalf("get messages: %v", err) }
+    if msgs[0].DeliveredAt == nil || !msgs[0].DeliveredAt.Equal(now) || msgs[0].ReadAt != nil || msgs[0].IsRead {
+        t.Fatalf("expected the sender not to see a read without receipt, and first delivery kept, got %+v", msgs[0])
+    }
+    if !msgs[2].IsRead {
+        t.Fatalf("expected the sender to see a read with receipt, got %+v", msgs[2])
+    }
+    if m, _ := GetMessage(ids[0], 1); m == nil || m.IsRead {
+        t.Fatalf("expected the sender not to see a read without receipt, got %+v", m)
+    }
+    if m, _ := GetMessage(ids[0], 2); m == nil || !m.IsRead {
+        t.Fatalf("expected the receiver to see their read, got %+v", m)
+    }
+    DB.Exec(`INSERT INTO chats (user1_id, user2_id) VALUES (1, 2)`)
+    for _, user := range []int64{1, 2} {
+        chats, err := GetChatsForUser(user)
+        if err != nil || len(chats) != 1 || !chats[0].IsRead {
+            t.Fatalf("expected user %d's chat read, got %+v err=%v", user, chats, err)
+        }
+    }
+    if msgs[1].DeliveredAt == nil || !msgs[1].DeliveredAt.Equal(now.Add(time.Hour)) {
+        t.Fatalf("expected reading to count as delivery, got %+v", msgs[1])
+    }
+    if msgs[2].ReadAt == nil || !msgs[2].ReadAt.Equal(now.Add(time.Hour)) {
+        t.Fatalf("expected read receipt stored, got %+v", msgs[2])
+    }
+}
+
+func TestEditAndDeleteMessages(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    DB.Exec(`INSERT INTO chats (user1_id, user2_id) VALUES (1, 2)`)
+    first := &models.Message{ChatID: 1, SenderID: 1, ReceiverID: 2, Content: "helo"}
+    last := &models.Message{ChatID: 1, SenderID: 2, ReceiverID: 1, Content: "hi"}
+    SaveMessage(first)
+    SaveMessage(last)
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+    if ok, err := EditMessage(first.ID, "hello", now); err != nil || !ok {
+        t.Fatalf("expected edit, ok=%v err=%v", ok, err)
+    }
+    EditMessage(first.ID, "hello!", now.Add(time.Minute))
+    edits, err := GetMessageEdits(first.ID)
+    if err != nil { t.Fatalf("edits: %v", err) }
+    if len(edits) != 2 || edits[0].Content != "helo" || edits[1].Content != "hello" {
+        t.Fatalf("expected replaced versions kept in order, got %+v", edits)
+    }
+
+    if ok, _ := DeleteMessage(last.ID, now); !ok {
+        t.Fatalf("expected message deleted for everyone")
+    }
+    if ok, _ := DeleteMessage(last.ID, now); ok {
+        t.Fatalf("expected second delete to be a no-op")
+    }
+    if ok, _ := EditMessage(last.ID, "changed", now); ok {
+        t.Fatalf("expected deleted message not editable")
+    }
+    if m, _ := GetMessage(last.ID, 1); m == nil || m.Content != "hi" || m.DeletedAt == nil {
+        t.Fatalf("expected content kept for moderation, got %+v", m)
+    }
+
+    msgs, _ := GetMessagesForChat(1, 1, nil, nil, 10)
+    if len(msgs) != 2 || msgs[0].Content != "hello!" || msgs[0].EditedAt == nil {
+        t.Fatalf("expected edited message, got %+v", msgs)
+    }
+    if msgs[1].Content != "" || msgs[1].DeletedAt == nil {
+        t.Fatalf("expected tombstone, got %+v", msgs[1])
+    }
+    chats, _ := GetChatsForUser(1)
+    if len(chats) != 1 || !chats[0].LastMessageDeleted || chats[0].LastMessage != "" {
+        t.Fatalf("expected tombstone preview, got %+v", chats)
+    }
+
+    // deleted for user 2 only
+    DeleteMessageForUser(last.ID, 2, now)
+    if msgs, _ := GetMessagesForChat(1, 2, nil, nil, 10); len(msgs) != 1 {
+        t.Fatalf("expected message hidden from user 2, got %+v", msgs)
+    }
+    if msgs, _ := GetMessagesForChat(1, 1, nil, nil, 10); len(msgs) != 2 {
+        t.Fatalf("expected message still shown to user 1, got %+v", msgs)
+    }
+    chats, _ = GetChatsForUser(2)
+    if len(chats) != 1 || chats[0].LastMessage != "hello!" {
+        t.Fatalf("expected preview to skip the hidden message, got %+v", chats)
+    }
+}
+
+func TestGetChatPeer(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    _, chatID, err := CreateOrGetChat(2, 1)
+    if err != nil { t.Fatalf("chat: %v", err) }
+    if peer, err := GetChatPeer(chatID, 1); err != nil || peer != 2 {
+        t.Fatalf("expected user 2 as peer of 1, got %d err=%v", peer, err)
+    }
+    if peer, _ := GetChatPeer(chatID, 2); peer != 1 {
+        t.Fatalf("expected user 1 as peer of 2, got %d", peer)
+    }
+    if peer, _ := GetChatPeer(chatID, 3); peer != 0 {
+        t.Fatalf("expected no peer for an outsider, got %d", peer)
+    }
+
+    m, _, err := CreateMatch(1, 2, chatID, "like", true)
+    if err != nil { t.Fatalf("match: %v", err) }
+    if _, err := Unmatch(m.ID, 1); err != nil { t.Fatalf("unmatch: %v", err) }
+    if peer, _ := GetChatPeer(chatID, 1); peer != 0 {
+        t.Fatalf("expected no peer once unmatched, got %d", peer)
+    }
+}
@@ -4,36 +4,258 @@ import (
 	"database/sql"
 	"dating-backend/internal/logging"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// addedColumns lists columns introduced after the initial schema. Each one
+// is added with ALTER TABLE when missing from an existing database.
+var addedColumns = []struct {
+	table, name, ddl string
+}{
+	{"users", "birthday", `ALTER TABLE users ADD COLUMN birthday TEXT;`},
+	{"users", "timezone", `ALTER TABLE users ADD COLUMN timezone TEXT;`},
+	{"swipes", "seen_at", `ALTER TABLE swipes ADD COLUMN seen_at DATETIME;`},
+	{"matches", "warned_at", `ALTER TABLE matches ADD COLUMN warned_at DATETIME;`},
+	{"messages", "client_id", `ALTER TABLE messages ADD COLUMN client_id TEXT;`},
+	{"users", "hide_online", `ALTER TABLE users ADD COLUMN hide_online BOOLEAN NOT NULL DEFAULT 0;`},
+	{"messages", "delivered_at", `ALTER TABLE messages ADD COLUMN delivered_at DATETIME;`},
+	{"messages", "read_at", `ALTER TABLE messages ADD COLUMN read_at DATETIME;`},
+	{"users", "hide_read_receipts", `ALTER TABLE users ADD COLUMN hide_read_receipts BOOLEAN NOT NULL DEFAULT 0;`},
+	{"messages", "edited_at", `ALTER TABLE messages ADD COLUMN edited_at DATETIME;`},
+	{"messages", "deleted_at", `ALTER TABLE messages ADD COLUMN deleted_at DATETIME;`},
+	{"users", "photo_verified", `ALTER TABLE users ADD COLUMN photo_verified BOOLEAN NOT NULL DEFAULT 0;`},
+	{"swipes", "content_type", `ALTER TABLE swipes ADD COLUMN content_type TEXT;`},
+	{"swipes", "content_id", `ALTER TABLE swipes ADD COLUMN content_id INTEGER;`},
+	{"swipes", "comment", `ALTER TABLE swipes ADD COLUMN comment TEXT;`},
+}
+
+// indexes are (re)created after the tables are migrated, since rebuilding a
+// table drops its indexes.
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_swipes_target ON swipes(target_id, action, id);`,
+	`CREATE INDEX IF NOT EXISTS idx_matches_status ON matches(status, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_users_last_active ON users(last_active);`,
+	// access_token and refresh_token lookups use their UNIQUE indexes;
+	// this one serves expiry pruning
+	`CREATE INDEX IF NOT EXISTS idx_sessions_refresh_expires ON sessions(refresh_expires);`,
+	// client-generated ids make resending a message idempotent
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_id ON messages(sender_id, client_id) WHERE client_id IS NOT NULL;`,
+}
+
 func migrate(db *sql.DB) error {
-	// Check if 'birthday' column exists in 'users' table
-	rows, err := db.Query(`PRAGMA table_info(users);`)
+	if err := migrateSwipeActions(db); err != nil {
+		return err
+	}
+
+	for _, c := range addedColumns {
+		exists, err := hasColumn(db, c.table, c.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		logging.Log.Infow("migrate: adding column", "table", c.table, "column", c.name)
+		if _, err := db.Exec(c.ddl); err != nil {
+			return fmt.Errorf("failed to add %s.%s column: %w", c.table, c.name, err)
+		}
+	}
+
+	if err := normalizeSessionTimes(db); err != nil {
+		return err
+	}
+
+	for _, stmt := range indexes {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	for _, m := range oneOffMigrations {
+		if err := runOnce(db, m.name, m.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oneOffMigrations are data migrations that run once per database. Each
+// one is recorded in schema_migrations in the same transaction as its
+// changes.
+var oneOffMigrations = []struct {
+	name string
+	run  func(tx *sql.Tx) error
+}{
+	{"backfill_matches", backfillMatches},
+}
+
+// runOnce applies the named migration unless schema_migrations already has
+// it.
+func runOnce(db *sql.DB, name string, run func(tx *sql.Tx) error) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at DATETIME NOT NULL
+	);`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	var applied bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = ?)`, name).Scan(&applied); err != nil {
+		return fmt.Errorf("failed to check migration %s: %w", name, err)
+	}
+	if applied {
+		return nil
+	}
+	if err := run(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (name, applied_at) VALUES (?, ?)`, name, sqlTime(time.Now())); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", name, err)
+	}
+	return tx.Commit()
+}
+
+// normalizeSessionTimes rewrites session expiries stored as Go time strings
+// ("2025-01-02 15:04:05.123 +0300 MSK m=+0.1") in the canonical UTC form,
+// so that they compare correctly in SQL.
+func normalizeSessionTimes(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT id, access_expires, refresh_expires FROM sessions
+		WHERE length(access_expires) != 19 OR length(refresh_expires) != 19
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read session expiries: %w", err)
+	}
+	type expiry struct {
+		id              int64
+		access, refresh time.Time
+	}
+	var fix []expiry
+	for rows.Next() {
+		var e expiry
+		if err := rows.Scan(&e.id, &e.access, &e.refresh); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to parse session expiries: %w", err)
+		}
+		fix = append(fix, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range fix {
+		if _, err := db.Exec(`UPDATE sessions SET access_expires = ?, refresh_expires = ? WHERE id = ?`,
+			sqlTime(e.access), sqlTime(e.refresh), e.id); err != nil {
+			return fmt.Errorf("failed to normalize session %d: %w", e.id, err)
+		}
+	}
+	if len(fix) > 0 {
+		logging.Log.Infow("migrate: normalized session expiries", "count", len(fix))
+	}
+	return nil
+}
+
+// backfillMatches creates match records for chats made before matches were
+// tracked, and drops the synthetic "It's a match!" messages (sender 0)
+// those chats were seeded with.
+func backfillMatches(tx *sql.Tx) error {
+	res, err := tx.Exec(`
+		INSERT OR IGNORE INTO matches (user1_id, user2_id, chat_id, created_at, updated_at)
+		SELECT user1_id, user2_id, id, created_at, created_at FROM chats
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to backfill matches: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logging.Log.Infow("migrate: backfilled matches from chats", "count", n)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM messages WHERE sender_id = 0`); err != nil {
+		return fmt.Errorf("failed to remove synthetic match messages: %w", err)
+	}
+
+	return nil
+}
+
+// ClearExternalPhotoURLs drops the photo URLs clients used to set to any
+// address. photo_url now always points at the primary photo of the
+// gallery, so users without gallery photos have none. Legacy URLs are
+// still served until then, which is why this is not part of migrate: the
+// operator runs it once, after users had a chance to upload their photos.
+func ClearExternalPhotoURLs() error {
+	res, err := DB.Exec(`
+		UPDATE users SET photo_url = NULL
+		WHERE photo_url IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM user_photos p WHERE p.user_id = users.id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to clear external photo urls: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logging.Log.Infow("migrate: cleared photo urls of users without gallery photos", "count", n)
+	}
+	return nil
+}
+
+// hasColumn checks whether table already has the named column.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(`PRAGMA table_info(` + table + `);`)
+	if err != nil {
+		return false, err
+	}
 	defer rows.Close()
 
-	hasBirthday := false
 	for rows.Next() {
 		var cid int
 		var name, ctype string
 		var notnull, pk int
 		var dflt sql.NullString
 		_ = rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
-		if name == "birthday" {
-			hasBirthday = true
-			break
+		if name == column {
+			return true, nil
 		}
 	}
+	return false, rows.Err()
+}
 
-	if !hasBirthday {
-		logging.Log.Infow("migrate: adding 'birthday' column")
-		_, err = db.Exec(`ALTER TABLE users ADD COLUMN birthday TEXT;`)
-		if err != nil {
-			return fmt.Errorf("failed to add birthday column: %w", err)
-		}
+// migrateSwipeActions rebuilds the swipes table created before 'superlike'
+// was an allowed action, keeping ids and timestamps.
+func migrateSwipeActions(db *sql.DB) error {
+	var ddl string
+	err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'swipes'`).Scan(&ddl)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(ddl, "'superlike'") {
+		return nil
 	}
 
-	return nil
-}
\ No newline at end of file
+	logging.Log.Infow("migrate: rebuilding swipes table for 'superlike' action")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		`CREATE TABLE swipes_new ` + swipesSchema,
+		`INSERT INTO swipes_new (id, user_id, target_id, action, created_at)
+			SELECT id, user_id, target_id, action, created_at FROM swipes;`,
+		`DROP TABLE swipes;`,
+		`ALTER TABLE swipes_new RENAME TO swipes;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to rebuild swipes table: %w", err)
+		}
+	}
+	return tx.Commit()
+}
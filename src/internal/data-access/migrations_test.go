@@ -0,0 +1,37 @@
+package data_access
+
+import (
+    "testing"
+
+    "dating-backend/internal/logging"
+
+    "go.uber.org/zap"
+)
+
+func TestBackfillMatchesRunsOnce(t *testing.T) {
+    teardown := setupInMemoryDB(t)
+    defer teardown()
+    logging.Log = zap.NewNop().Sugar()
+
+    if _, err := DB.Exec(`INSERT INTO chats (user1_id, user2_id) VALUES (1, 2)`); err != nil { t.Fatalf("insert chat: %v", err) }
+    if _, err := DB.Exec(`INSERT INTO messages (chat_id, sender_id, receiver_id, content) VALUES (1, 0, 1, 'It''s a match!')`); err != nil { t.Fatalf("insert message: %v", err) }
+    if err := migrate(DB); err != nil { t.Fatalf("migrate: %v", err) }
+
+    var matches, messages int
+    if err := DB.QueryRow(`SELECT COUNT(*) FROM matches`).Scan(&matches); err != nil { t.Fatalf("count matches: %v", err) }
+    if err := DB.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&messages); err != nil { t.Fatalf("count messages: %v", err) }
+    if matches != 1 || messages != 0 {
+        t.Fatalf("after first migrate: %d matches, %d messages, want 1 and 0", matches, messages)
+    }
+
+    // a restart leaves data written since the backfill alone
+    if _, err := DB.Exec(`INSERT INTO chats (user1_id, user2_id) VALUES (3, 4)`); err != nil { t.Fatalf("insert chat: %v", err) }
+    if _, err := DB.Exec(`INSERT INTO messages (chat_id, sender_id, receiver_id, content) VALUES (2, 0, 3, 'system')`); err != nil { t.Fatalf("insert message: %v", err) }
+    if err := migrate(DB); err != nil { t.Fatalf("second migrate: %v", err) }
+
+    if err := DB.QueryRow(`SELECT COUNT(*) FROM matches`).Scan(&matches); err != nil { t.Fatalf("count matches: %v", err) }
+    if err := DB.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&messages); err != nil { t.Fatalf("count messages: %v", err) }
+    if matches != 1 || messages != 1 {
+        t.Fatalf("after second migrate: %d matches, %d messages, want 1 and 1", matches, messages)
+    }
+}
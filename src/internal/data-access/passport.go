@@ -0,0 +1,54 @@
+package data_access
+
+import (
+	"database/sql"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"time"
+)
+
+// sqlTime formats t the same way SQLite's CURRENT_TIMESTAMP does, so values
+// written from Go compare correctly with datetime('now') in queries.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// SetPassport creates or replaces the user's passport location.
+func SetPassport(userID int64, p *models.Passport) error {
+	_, err := DB.Exec(`
+		INSERT OR REPLACE INTO user_passports (user_id, city, latitude, longitude, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, datetime('now'))
+	`, userID, p.City, p.Latitude, p.Longitude, sqlTime(p.ExpiresAt))
+	if err != nil {
+		logging.Log.Errorf("data-access: SetPassport error user=%d: %v", userID, err)
+	}
+	return err
+}
+
+// GetActivePassport returns the user's passport if it has not expired yet,
+// or nil when the user is at home.
+func GetActivePassport(userID int64) (*models.Passport, error) {
+	p := &models.Passport{}
+	err := DB.QueryRow(`
+		SELECT city, latitude, longitude, expires_at, created_at
+		FROM user_passports
+		WHERE user_id = ? AND expires_at > datetime('now')
+	`, userID).Scan(&p.City, &p.Latitude, &p.Longitude, &p.ExpiresAt, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: GetActivePassport error user=%d: %v", userID, err)
+		return nil, err
+	}
+	return p, nil
+}
+
+// ClearPassport removes the user's passport, returning them home.
+func ClearPassport(userID int64) error {
+	_, err := DB.Exec(`DELETE FROM user_passports WHERE user_id = ?`, userID)
+	if err != nil {
+		logging.Log.Errorf("data-access: ClearPassport error user=%d: %v", userID, err)
+	}
+	return err
+}
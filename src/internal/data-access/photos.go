@@ -0,0 +1,269 @@
+package data_access
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+// ErrTooManyPhotos is returned by AddPhoto when the gallery is full.
+var ErrTooManyPhotos = errors.New("too many photos")
+
+const photoColumns = `id, user_id, position, blob_key, width, height, created_at`
+
+func scanPhoto(rows *sql.Rows) (userID int64, p models.Photo, err error) {
+	err = rows.Scan(&p.ID, &userID, &p.Position, &p.Key, &p.Width, &p.Height, &p.CreatedAt)
+	p.Primary = p.Position == 0
+	p.FillURLs()
+	return userID, p, err
+}
+
+// AddPhoto appends a photo to the user's gallery, unless it already holds
+// limit photos, and fills in its id, position and created_at. The first
+// photo becomes the primary one. The photo_verified badge is dropped, as
+// the selfie wasn't checked against the new photo.
+func AddPhoto(userID int64, p *models.Photo, limit int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: AddPhoto begin tx error user=%d: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO user_photos (user_id, position, blob_key, width, height)
+		SELECT ?1, COUNT(*), ?2, ?3, ?4 FROM user_photos WHERE user_id = ?1
+		HAVING COUNT(*) < ?5
+		RETURNING id, position, created_at
+	`, userID, p.Key, p.Width, p.Height, limit).Scan(&p.ID, &p.Position, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrTooManyPhotos
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: AddPhoto insert error user=%d: %v", userID, err)
+		return err
+	}
+	p.Primary = p.Position == 0
+	if _, err := tx.Exec(`UPDATE users SET photo_verified = 0 WHERE id = ?`, userID); err != nil {
+		logging.Log.Errorf("data-access: AddPhoto unverify error user=%d: %v", userID, err)
+		return err
+	}
+	if err := syncPrimaryPhoto(tx, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: AddPhoto commit error user=%d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// GetPhotos returns the user's gallery in order.
+func GetPhotos(userID int64) ([]models.Photo, error) {
+	byUser, err := GetPhotosForUsers([]int64{userID})
+	if err != nil {
+		return nil, err
+	}
+	return byUser[userID], nil
+}
+
+// GetPhotosForUsers returns the galleries of the users, by user id, in
+// order.
+func GetPhotosForUsers(userIDs []int64) (map[int64][]models.Photo, error) {
+	out := map[int64][]models.Photo{}
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := DB.Query(`
+		SELECT `+photoColumns+`
+		FROM user_photos
+		WHERE user_id IN (`+placeholders(len(userIDs))+`)
+		ORDER BY user_id, position
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetPhotosForUsers query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		userID, p, err := scanPhoto(rows)
+		if err != nil {
+			logging.Log.Errorf("data-access: GetPhotosForUsers scan error: %v", err)
+			return nil, err
+		}
+		out[userID] = append(out[userID], p)
+	}
+	return out, rows.Err()
+}
+
+// ReorderPhotos puts the user's gallery in the given order, whose first
+// photo becomes the primary one. ids must list every photo of the gallery
+// exactly once; ok is false otherwise.
+func ReorderPhotos(userID int64, ids []int64) (ok bool, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: ReorderPhotos begin tx error user=%d: %v", userID, err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	current, err := photoOrder(tx, userID)
+	if err != nil {
+		return false, err
+	}
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	slices.Sort(current)
+	if !slices.Equal(sorted, current) {
+		return false, nil
+	}
+	if err := writePhotoOrder(tx, userID, ids); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: ReorderPhotos commit error user=%d: %v", userID, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// SetPrimaryPhoto moves a photo of the user to the front of the gallery,
+// keeping the order of the others. found is false if the user has no such
+// photo.
+func SetPrimaryPhoto(userID, photoID int64) (found bool, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: SetPrimaryPhoto begin tx error user=%d: %v", userID, err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ids, err := photoOrder(tx, userID)
+	if err != nil {
+		return false, err
+	}
+	i := slices.Index(ids, photoID)
+	if i < 0 {
+		return false, nil
+	}
+	ids = append([]int64{photoID}, slices.Delete(ids, i, i+1)...)
+	if err := writePhotoOrder(tx, userID, ids); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: SetPrimaryPhoto commit error user=%d: %v", userID, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// DeletePhoto removes a photo from the user's gallery and closes the gap
+// it leaves. It returns the removed photo, whose files the caller deletes,
+// or nil if the user has no such photo.
+func DeletePhoto(userID, photoID int64) (*models.Photo, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: DeletePhoto begin tx error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var p models.Photo
+	err = tx.QueryRow(`
+		DELETE FROM user_photos WHERE id = ? AND user_id = ?
+		RETURNING id, position, blob_key, width, height, created_at
+	`, photoID, userID).Scan(&p.ID, &p.Position, &p.Key, &p.Width, &p.Height, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: DeletePhoto error user=%d photo=%d: %v", userID, photoID, err)
+		return nil, err
+	}
+
+	ids, err := photoOrder(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePhotoOrder(tx, userID, ids); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: DeletePhoto commit error user=%d: %v", userID, err)
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PhotoExists reports whether a gallery photo with the blob key prefix
+// exists, so files of removed photos are no longer served.
+func PhotoExists(key string) (bool, error) {
+	var exists bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_photos WHERE blob_key = ?)`, key).Scan(&exists)
+	if err != nil {
+		logging.Log.Errorf("data-access: PhotoExists error key=%s: %v", key, err)
+	}
+	return exists, err
+}
+
+// photoOrder returns the ids of the user's photos in gallery order.
+func photoOrder(tx *sql.Tx, userID int64) ([]int64, error) {
+	rows, err := tx.Query(`SELECT id FROM user_photos WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		logging.Log.Errorf("data-access: photoOrder query error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// writePhotoOrder numbers the user's photos in the order of ids and points
+// users.photo_url at the new primary photo.
+func writePhotoOrder(tx *sql.Tx, userID int64, ids []int64) error {
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE user_photos SET position = ? WHERE id = ? AND user_id = ?`, i, id, userID); err != nil {
+			logging.Log.Errorf("data-access: writePhotoOrder error user=%d photo=%d: %v", userID, id, err)
+			return err
+		}
+	}
+	return syncPrimaryPhoto(tx, userID)
+}
+
+// syncPrimaryPhoto keeps users.photo_url, which profile summaries and
+// lists read, pointing at the primary photo, or NULL without photos. A new
+// primary photo drops the photo_verified badge.
+func syncPrimaryPhoto(tx *sql.Tx, userID int64) error {
+	var key sql.NullString
+	err := tx.QueryRow(`SELECT blob_key FROM user_photos WHERE user_id = ? ORDER BY position LIMIT 1`, userID).Scan(&key)
+	if err != nil && err != sql.ErrNoRows {
+		logging.Log.Errorf("data-access: syncPrimaryPhoto query error user=%d: %v", userID, err)
+		return err
+	}
+	var url any
+	if key.Valid {
+		url = models.PhotoURL(key.String, models.PrimaryPhotoVariant)
+	}
+	if _, err := tx.Exec(`
+		UPDATE users SET photo_url = ?1, photo_verified = photo_verified AND photo_url IS ?1
+		WHERE id = ?2
+	`, url, userID); err != nil {
+		logging.Log.Errorf("data-access: syncPrimaryPhoto update error user=%d: %v", userID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package data_access
+
+import (
+	"testing"
+
+	"dating-backend/internal/models"
+)
+
+func TestPhotoGallery(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password, photo_url) VALUES (1, 'a', 'x', 'http://evil.example/track.gif'), (2, 'b', 'x', NULL)`); err != nil {
+        t.Fatalf("insert users: %v", err)
+    }
+    photoURL := func() string {
+        var url *string
+        DB.QueryRow(`SELECT photo_url FROM users WHERE id = 1`).Scan(&url)
+        if url == nil { return "" }
+        return *url
+    }
+    add := func(key string) int64 {
+        p := &models.Photo{Key: key, Width: 10, Height: 10}
+        if err := AddPhoto(1, p, 3); err != nil { t.Fatalf("add %s: %v", key, err) }
+        return p.ID
+    }
+    first, second, third := add("photos/a"), add("photos/b"), add("photos/c")
+    if err := AddPhoto(1, &models.Photo{Key: "photos/d"}, 3); err != ErrTooManyPhotos {
+        t.Fatalf("expected a full gallery, got %v", err)
+    }
+    if got := photoURL(); got != models.PhotoURL("photos/a", models.PrimaryPhotoVariant) {
+        t.Fatalf("expected photo_url of the first photo, got %q", got)
+    }
+
+    order := func() []int64 {
+        photos, err := GetPhotos(1)
+        if err != nil { t.Fatalf("get: %v", err) }
+        var ids []int64
+        for i, p := range photos {
+            if p.Position != i || p.Primary != (i == 0) || p.URLs["small"] == "" {
+                t.Fatalf("unexpected photo %+v at %d", p, i)
+            }
+            ids = append(ids, p.ID)
+        }
+        return ids
+    }
+
+    for _, bad := range [][]int64{{first, second}, {first, second, second}, {first, second, 99}} {
+        if ok, _ := ReorderPhotos(1, bad); ok {
+            t.Fatalf("expected %v rejected", bad)
+        }
+    }
+    if ok, err := ReorderPhotos(1, []int64{third, first, second}); !ok || err != nil {
+        t.Fatalf("reorder: %v %v", ok, err)
+    }
+    if got := order(); got[0] != third || got[1] != first || got[2] != second {
+        t.Fatalf("unexpected order %v", got)
+    }
+
+    if found, _ := SetPrimaryPhoto(2, second); found {
+        t.Fatalf("expected another user's photo not found")
+    }
+    if found, err := SetPrimaryPhoto(1, second); !found || err != nil {
+        t.Fatalf("set primary: %v %v", found, err)
+    }
+    if got := order(); got[0] != second || got[1] != third || got[2] != first {
+        t.Fatalf("unexpected order %v", got)
+    }
+    if got := photoURL(); got != models.PhotoURL("photos/b", models.PrimaryPhotoVariant) {
+        t.Fatalf("expected photo_url to follow the primary photo, got %q", got)
+    }
+
+    if p, _ := DeletePhoto(2, second); p != nil {
+        t.Fatalf("expected another user's photo kept")
+    }
+    p, err := DeletePhoto(1, second)
+    if err != nil || p == nil || p.Key != "photos/b" {
+        t.Fatalf("delete: %+v %v", p, err)
+    }
+    if got := order(); len(got) != 2 || got[0] != third {
+        t.Fatalf("expected the next photo to become primary, got %v", got)
+    }
+    if ok, _ := PhotoExists("photos/b"); ok {
+        t.Fatalf("expected the deleted photo gone")
+    }
+
+    DeletePhoto(1, third)
+    DeletePhoto(1, first)
+    if got := photoURL(); got != "" {
+        t.Fatalf("expected no photo_url without photos, got %q", got)
+    }
+
+    byUser, err := GetPhotosForUsers([]int64{1, 2})
+    if err != nil || len(byUser) != 0 {
+        t.Fatalf("expected empty galleries, got %v %v", byUser, err)
+    }
+}
+
+func TestPhotoChangesDropVerification(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'a', 'x')`); err != nil {
+        t.Fatalf("insert user: %v", err)
+    }
+    add := func(key string) int64 {
+        p := &models.Photo{Key: key, Width: 10, Height: 10}
+        if err := AddPhoto(1, p, 5); err != nil { t.Fatalf("add %s: %v", key, err) }
+        return p.ID
+    }
+    verify := func() {
+        if _, err := DB.Exec(`UPDATE users SET photo_verified = 1 WHERE id = 1`); err != nil { t.Fatalf("verify: %v", err) }
+    }
+    verified := func() bool {
+        var v bool
+        if err := DB.QueryRow(`SELECT photo_verified FROM users WHERE id = 1`).Scan(&v); err != nil { t.Fatalf("select: %v", err) }
+        return v
+    }
+
+    first, second := add("photos/a"), add("photos/b")
+    verify()
+    third := add("photos/c")
+    if verified() {
+        t.Fatalf("expected a new photo to drop the badge")
+    }
+
+    verify()
+    if ok, err := ReorderPhotos(1, []int64{first, third, second}); !ok || err != nil { t.Fatalf("reorder: %v %v", ok, err) }
+    if !verified() {
+        t.Fatalf("expected the badge kept while the primary photo stays")
+    }
+    if found, err := SetPrimaryPhoto(1, second); !found || err != nil { t.Fatalf("set primary: %v %v", found, err) }
+    if verified() {
+        t.Fatalf("expected a new primary photo to drop the badge")
+    }
+
+    verify()
+    if _, err := DeletePhoto(1, first); err != nil { t.Fatalf("delete: %v", err) }
+    if !verified() {
+        t.Fatalf("expected the badge kept when a secondary photo goes")
+    }
+    if _, err := DeletePhoto(1, second); err != nil { t.Fatalf("delete: %v", err) }
+    if verified() {
+        t.Fatalf("expected deleting the primary photo to drop the badge")
+    }
+}
@@ -0,0 +1,98 @@
+package data_access
+
+import (
+	"database/sql"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"strings"
+	"time"
+)
+
+// OnlineWindow is how recent last_active must be for a user to count as
+// online in discovery. It spans a couple of last-seen writes, which happen
+// every minute while a user is connected.
+var OnlineWindow = 2 * time.Minute
+
+// SetLastActive records that the users were active at now.
+func SetLastActive(userIDs []int64, now time.Time) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	args := []any{sqlTime(now)}
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	_, err := DB.Exec(`UPDATE users SET last_active = ? WHERE id IN (`+placeholders(len(userIDs))+`)`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: SetLastActive error users=%d: %v", len(userIDs), err)
+	}
+	return err
+}
+
+// GetPresence returns the last-seen time and hide setting of the given
+// users; unknown ids are skipped. Online is left to the caller, which
+// knows the live connections.
+func GetPresence(userIDs []int64) ([]models.Presence, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := DB.Query(`
+		SELECT id, last_active, hide_online FROM users
+		WHERE id IN (`+placeholders(len(userIDs))+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetPresence query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.Presence
+	for rows.Next() {
+		var p models.Presence
+		var lastActive sql.NullString
+		if err := rows.Scan(&p.UserID, &lastActive, &p.Hidden); err != nil {
+			logging.Log.Errorf("data-access: GetPresence scan error: %v", err)
+			return nil, err
+		}
+		if t, err := time.Parse("2006-01-02 15:04:05", lastActive.String); err == nil {
+			p.LastSeen = &t
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GetMatchedUserIDs returns the users the given user has an active match
+// with.
+func GetMatchedUserIDs(userID int64) ([]int64, error) {
+	rows, err := DB.Query(`
+		SELECT CASE WHEN user1_id = ? THEN user2_id ELSE user1_id END
+		FROM matches
+		WHERE (user1_id = ? OR user2_id = ?) AND status = 'active'
+	`, userID, userID, userID)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetMatchedUserIDs query error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			logging.Log.Errorf("data-access: GetMatchedUserIDs scan error user=%d: %v", userID, err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
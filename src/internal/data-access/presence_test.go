@@ -0,0 +1,43 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceData(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    for _, u := range []string{"a", "b", "c"} {
+        DB.Exec(`INSERT INTO users (username, password) VALUES (?, 'p')`, u)
+    }
+    DB.Exec(`UPDATE users SET hide_online = 1 WHERE id = 3`)
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    if err := SetLastActive([]int64{1, 3}, now); err != nil { t.Fatalf("set last active: %v", err) }
+
+    p, err := GetPresence([]int64{1, 2, 3, 99})
+    if err != nil { t.Fatalf("get presence: %v", err) }
+    if len(p) != 3 {
+        t.Fatalf("expected unknown ids skipped, got %+v", p)
+    }
+    if p[0].LastSeen == nil || !p[0].LastSeen.Equal(now) || p[0].Hidden {
+        t.Fatalf("unexpected presence of user 1: %+v", p[0])
+    }
+    if p[1].LastSeen != nil {
+        t.Fatalf("expected no last seen for a user never active, got %v", p[1].LastSeen)
+    }
+    if !p[2].Hidden {
+        t.Fatalf("expected user 3 hidden")
+    }
+
+    CreateMatch(1, 2, 1, "like", true)
+    m, _, _ := CreateMatch(1, 3, 2, "like", true)
+    Unmatch(m.ID, 1)
+    ids, err := GetMatchedUserIDs(1)
+    if err != nil { t.Fatalf("matched ids: %v", err) }
+    if len(ids) != 1 || ids[0] != 2 {
+        t.Fatalf("expected only the active match, got %v", ids)
+    }
+}
@@ -0,0 +1,181 @@
+package data_access
+
+import (
+	"database/sql"
+	"errors"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+// ErrUnknownPrompt is returned by SetPromptAnswers for a prompt that
+// doesn't exist or was retired before the user answered it.
+var ErrUnknownPrompt = errors.New("unknown prompt")
+
+// GetPrompts returns the prompts, oldest first; only the active ones
+// unless all is set.
+func GetPrompts(all bool) ([]models.Prompt, error) {
+	query := `SELECT id, text, active, created_at FROM prompts`
+	if !all {
+		query += ` WHERE active`
+	}
+	rows, err := DB.Query(query + ` ORDER BY id`)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetPrompts query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Prompt{}
+	for rows.Next() {
+		var p models.Prompt
+		if err := rows.Scan(&p.ID, &p.Text, &p.Active, &p.CreatedAt); err != nil {
+			logging.Log.Errorf("data-access: GetPrompts scan error: %v", err)
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// CreatePrompt adds an active prompt.
+func CreatePrompt(text string) (*models.Prompt, error) {
+	p := models.Prompt{Text: text, Active: true}
+	err := DB.QueryRow(`
+		INSERT INTO prompts (text) VALUES (?) RETURNING id, created_at
+	`, text).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		logging.Log.Errorf("data-access: CreatePrompt error: %v", err)
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdatePrompt rewords a prompt and retires or restores it; nil fields are
+// kept. It returns nil if there is no such prompt.
+func UpdatePrompt(id int64, text *string, active *bool) (*models.Prompt, error) {
+	var p models.Prompt
+	err := DB.QueryRow(`
+		UPDATE prompts SET text = IFNULL(?, text), active = IFNULL(?, active)
+		WHERE id = ?
+		RETURNING id, text, active, created_at
+	`, text, active, id).Scan(&p.ID, &p.Text, &p.Active, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: UpdatePrompt error id=%d: %v", id, err)
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SetPromptAnswers replaces the user's prompt cards with answers, in order.
+// A prompt the user answered before keeps its card id. Retired prompts can
+// only be kept, not picked anew.
+func SetPromptAnswers(userID int64, answers []models.PromptAnswer) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: SetPromptAnswers begin tx error user=%d: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPromptAnswers(tx, userID, answers); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: SetPromptAnswers commit error user=%d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+func setPromptAnswers(tx *sql.Tx, userID int64, answers []models.PromptAnswer) error {
+	keep := make([]any, 0, len(answers)+1)
+	keep = append(keep, userID)
+	for _, a := range answers {
+		keep = append(keep, a.PromptID)
+	}
+	query := `DELETE FROM user_prompts WHERE user_id = ?`
+	if len(answers) > 0 {
+		query += ` AND prompt_id NOT IN (` + placeholders(len(answers)) + `)`
+	}
+	if _, err := tx.Exec(query, keep...); err != nil {
+		logging.Log.Errorf("data-access: SetPromptAnswers cleanup error user=%d: %v", userID, err)
+		return err
+	}
+
+	for i, a := range answers {
+		res, err := tx.Exec(`
+			INSERT INTO user_prompts (user_id, prompt_id, answer, position)
+			SELECT ?1, p.id, ?3, ?4 FROM prompts p
+			WHERE p.id = ?2 AND (p.active OR EXISTS (
+				SELECT 1 FROM user_prompts WHERE user_id = ?1 AND prompt_id = p.id))
+			ON CONFLICT (user_id, prompt_id) DO UPDATE SET answer = excluded.answer, position = excluded.position
+		`, userID, a.PromptID, a.Answer, i)
+		if err != nil {
+			logging.Log.Errorf("data-access: SetPromptAnswers upsert error user=%d prompt=%d: %v", userID, a.PromptID, err)
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrUnknownPrompt
+		}
+	}
+	return nil
+}
+
+// GetPromptAnswers returns the prompt cards of the users, by user id, in
+// order.
+func GetPromptAnswers(userIDs []int64) (map[int64][]models.PromptAnswer, error) {
+	out := map[int64][]models.PromptAnswer{}
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := DB.Query(`
+		SELECT up.user_id, up.id, up.prompt_id, p.text, up.answer
+		FROM user_prompts up
+		JOIN prompts p ON p.id = up.prompt_id
+		WHERE up.user_id IN (`+placeholders(len(userIDs))+`)
+		ORDER BY up.user_id, up.position
+	`, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetPromptAnswers query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		var a models.PromptAnswer
+		if err := rows.Scan(&userID, &a.ID, &a.PromptID, &a.Question, &a.Answer); err != nil {
+			logging.Log.Errorf("data-access: GetPromptAnswers scan error: %v", err)
+			return nil, err
+		}
+		out[userID] = append(out[userID], a)
+	}
+	return out, rows.Err()
+}
+
+// HasContent reports whether the prompt card or photo belongs to the user.
+func HasContent(userID int64, c models.LikedContent) (bool, error) {
+	var table string
+	switch c.Type {
+	case "prompt":
+		table = "user_prompts"
+	case "photo":
+		table = "user_photos"
+	default:
+		return false, nil
+	}
+	var exists bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = ? AND user_id = ?)`, c.ID, userID).Scan(&exists)
+	if err != nil {
+		logging.Log.Errorf("data-access: HasContent error user=%d %s=%d: %v", userID, c.Type, c.ID, err)
+	}
+	return exists, err
+}
@@ -0,0 +1,150 @@
+package data_access
+
+import (
+	"testing"
+
+	"dating-backend/internal/models"
+)
+
+func TestPromptAnswers(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'a', 'x'), (2, 'b', 'x')`); err != nil {
+        t.Fatalf("insert users: %v", err)
+    }
+    weekend, err := CreatePrompt("Лучший способ провести выходные...")
+    if err != nil { t.Fatalf("create: %v", err) }
+    talent, _ := CreatePrompt("Мой главный талант")
+    old, _ := CreatePrompt("Старый вопрос")
+
+    answers := []models.PromptAnswer{{PromptID: weekend.ID, Answer: "Горы"}, {PromptID: old.ID, Answer: "Да"}}
+    if err := SetPromptAnswers(1, answers); err != nil { t.Fatalf("set: %v", err) }
+    if p, err := UpdatePrompt(old.ID, nil, new(bool)); err != nil || p == nil || p.Active || p.Text != "Старый вопрос" {
+        t.Fatalf("retire: %+v %v", p, err)
+    }
+    if p, _ := UpdatePrompt(99, nil, nil); p != nil {
+        t.Fatalf("expected a missing prompt reported, got %+v", p)
+    }
+    if active, _ := GetPrompts(false); len(active) != 2 {
+        t.Fatalf("expected the retired prompt left out, got %+v", active)
+    }
+    if err := SetPromptAnswers(2, []models.PromptAnswer{{PromptID: old.ID, Answer: "Нет"}}); err != ErrUnknownPrompt {
+        t.Fatalf("expected a retired prompt refused, got %v", err)
+    }
+
+    before, _ := GetPromptAnswers([]int64{1})
+    answers = []models.PromptAnswer{{PromptID: old.ID, Answer: "Уже нет"}, {PromptID: talent.ID, Answer: "Пеку хлеб"}}
+    if err := SetPromptAnswers(1, answers); err != nil { t.Fatalf("expected a retired prompt kept, got %v", err) }
+    after, err := GetPromptAnswers([]int64{1, 2})
+    if err != nil || len(after[1]) != 2 || len(after[2]) != 0 {
+        t.Fatalf("unexpected answers %+v %v", after, err)
+    }
+    if after[1][0].ID != before[1][1].ID || after[1][0].Answer != "Уже нет" || after[1][1].Question != "Мой главный талант" {
+        t.Fatalf("expected cards reordered with their ids kept: %+v then %+v", before[1], after[1])
+    }
+    if n := countRows(t, "user_prompts"); n != 2 {
+        t.Fatalf("expected the dropped answer deleted, got %d", n)
+    }
+
+    card := models.LikedContent{Type: "prompt", ID: after[1][1].ID}
+    if ok, _ := HasContent(1, card); !ok {
+        t.Fatalf("expected the card found")
+    }
+    if ok, _ := HasContent(2, card); ok {
+        t.Fatalf("expected another user's card refused")
+    }
+    if ok, _ := HasContent(1, models.LikedContent{Type: "video", ID: 1}); ok {
+        t.Fatalf("expected an unknown content type refused")
+    }
+}
+
+func TestUpdateProfileKeepsPromptsOnFailure(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password, name) VALUES (1, 'a', 'x', 'Anna')`); err != nil {
+        t.Fatalf("insert user: %v", err)
+    }
+    talent, _ := CreatePrompt("Мой главный талант")
+    weekend, _ := CreatePrompt("Лучший способ провести выходные...")
+    if err := SetPromptAnswers(1, []models.PromptAnswer{{PromptID: weekend.ID, Answer: "Горы"}}); err != nil {
+        t.Fatalf("set: %v", err)
+    }
+
+    // the unknown prompt fails the cards and the name saved with them
+    u, err := GetUserByID(1)
+    if err != nil { t.Fatalf("get user: %v", err) }
+    u.Name = "Anya"
+    err = UpdateProfile(&models.ProfileUpdate{
+        User:    u,
+        Prompts: &[]models.PromptAnswer{{PromptID: talent.ID, Answer: "Пеку хлеб"}, {PromptID: 99, Answer: "?"}},
+    })
+    if err != ErrUnknownPrompt { t.Fatalf("expected an unknown prompt refused, got %v", err) }
+    if cards, _ := GetPromptAnswers([]int64{1}); len(cards[1]) != 1 || cards[1][0].Answer != "Горы" {
+        t.Fatalf("expected prompt cards left as they were, got %+v", cards[1])
+    }
+    if u, _ := GetUserByID(1); u.Name != "Anna" {
+        t.Fatalf("expected the name left as it was, got %q", u.Name)
+    }
+
+    u.Name = "Anya"
+    if err := UpdateProfile(&models.ProfileUpdate{User: u, Prompts: &[]models.PromptAnswer{{PromptID: talent.ID, Answer: "Пеку хлеб"}}}); err != nil {
+        t.Fatalf("update: %v", err)
+    }
+    if cards, _ := GetPromptAnswers([]int64{1}); len(cards[1]) != 1 || cards[1][0].Answer != "Пеку хлеб" {
+        t.Fatalf("expected the new prompt cards saved, got %+v", cards[1])
+    }
+}
+
+func TestLikeOnContent(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password, name) VALUES (1, 'a', 'x', 'A'), (2, 'b', 'x', 'B'), (3, 'c', 'x', 'C')`); err != nil {
+        t.Fatalf("insert users: %v", err)
+    }
+    p, _ := CreatePrompt("Мой главный талант")
+    SetPromptAnswers(2, []models.PromptAnswer{{PromptID: p.ID, Answer: "Пеку хлеб"}})
+    cards, _ := GetPromptAnswers([]int64{2})
+    photo := models.Photo{Key: "photos/k", Width: 10, Height: 10}
+    if err := AddPhoto(2, &photo, 6); err != nil { t.Fatalf("add photo: %v", err) }
+
+    if err := UpsertLike(1, 2, "like", &models.LikedContent{Type: "prompt", ID: cards[2][0].ID}, "Научишь?"); err != nil {
+        t.Fatalf("like: %v", err)
+    }
+    if err := UpsertLike(3, 2, "superlike", &models.LikedContent{Type: "photo", ID: photo.ID}, ""); err != nil {
+        t.Fatalf("superlike: %v", err)
+    }
+
+    items, err := GetLikesInbox(2, nil, 10)
+    if err != nil || len(items) != 2 { t.Fatalf("inbox: %+v %v", items, err) }
+    if c := items[0].Content; c == nil || c.Type != "photo" || c.PhotoURL != models.PhotoURL("photos/k", models.PrimaryPhotoVariant) || items[0].Comment != "" {
+        t.Fatalf("unexpected photo like %+v %+v", items[0], c)
+    }
+    if c := items[1].Content; c == nil || c.Question != "Мой главный талант" || c.Answer != "Пеку хлеб" || items[1].Comment != "Научишь?" {
+        t.Fatalf("unexpected prompt like %+v %+v", items[1], c)
+    }
+
+    // removed content drops out of the inbox, the comment stays
+    SetPromptAnswers(2, nil)
+    items, _ = GetLikesInbox(2, nil, 10)
+    if items[1].Content != nil || items[1].Comment != "Научишь?" {
+        t.Fatalf("unexpected like on removed content %+v", items[1])
+    }
+
+    // the comment opens the chat once
+    if comment, _ := TakeLikeComment(1, 2); comment != "Научишь?" {
+        t.Fatalf("unexpected comment %q", comment)
+    }
+    if comment, _ := TakeLikeComment(1, 2); comment != "" {
+        t.Fatalf("expected the comment taken, got %q", comment)
+    }
+
+    // a plain swipe over the like clears the comment
+    if err := UpsertLike(1, 2, "like", nil, "Научишь?"); err != nil { t.Fatalf("like: %v", err) }
+    if err := UpsertSwipe(1, 2, "like"); err != nil { t.Fatalf("upsert: %v", err) }
+    if comment, _ := TakeLikeComment(1, 2); comment != "" {
+        t.Fatalf("expected the comment cleared, got %q", comment)
+    }
+}
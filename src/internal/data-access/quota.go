@@ -0,0 +1,96 @@
+package data_access
+
+import (
+	"database/sql"
+	"dating-backend/internal/logging"
+	"time"
+)
+
+// TakeQuota records one use of the quota bucket identified by key at now,
+// unless limit uses were already recorded since windowStart. Uses older
+// than windowStart are dropped. It returns the number of uses in the
+// window after the call and whether the use was recorded.
+func TakeQuota(key string, limit int, windowStart, now time.Time) (int, bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: TakeQuota begin tx error key=%s: %v", key, err)
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM quota_events WHERE key = ? AND created_at < ?`,
+		key, sqlTime(windowStart)); err != nil {
+		logging.Log.Errorf("data-access: TakeQuota prune error key=%s: %v", key, err)
+		return 0, false, err
+	}
+
+	var used int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM quota_events WHERE key = ?`, key).Scan(&used); err != nil {
+		logging.Log.Errorf("data-access: TakeQuota count error key=%s: %v", key, err)
+		return 0, false, err
+	}
+	if used >= limit {
+		return used, false, tx.Commit()
+	}
+
+	if _, err := tx.Exec(`INSERT INTO quota_events (key, created_at) VALUES (?, ?)`,
+		key, sqlTime(now)); err != nil {
+		logging.Log.Errorf("data-access: TakeQuota insert error key=%s: %v", key, err)
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: TakeQuota commit error key=%s: %v", key, err)
+		return 0, false, err
+	}
+	return used + 1, true, nil
+}
+
+// ReleaseQuota forgets the most recent use recorded for key, giving it back
+// when the action it paid for did not go through.
+func ReleaseQuota(key string) error {
+	_, err := DB.Exec(`
+		DELETE FROM quota_events WHERE id = (
+			SELECT id FROM quota_events WHERE key = ? ORDER BY created_at DESC, id DESC LIMIT 1
+		)
+	`, key)
+	if err != nil {
+		logging.Log.Errorf("data-access: ReleaseQuota error key=%s: %v", key, err)
+	}
+	return err
+}
+
+// QuotaUsage returns the number of uses recorded since windowStart and the
+// time of the oldest of them (zero when there are none).
+func QuotaUsage(key string, windowStart time.Time) (int, time.Time, error) {
+	var used int
+	var oldest sql.NullString
+	err := DB.QueryRow(`
+		SELECT COUNT(*), MIN(created_at) FROM quota_events
+		WHERE key = ? AND created_at >= ?
+	`, key, sqlTime(windowStart)).Scan(&used, &oldest)
+	if err != nil {
+		logging.Log.Errorf("data-access: QuotaUsage error key=%s: %v", key, err)
+		return 0, time.Time{}, err
+	}
+	if !oldest.Valid {
+		return used, time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", oldest.String)
+	if err != nil {
+		logging.Log.Errorf("data-access: QuotaUsage parse time error key=%s: %v", key, err)
+		return 0, time.Time{}, err
+	}
+	return used, t, nil
+}
+
+// GetUserTimezone returns the IANA timezone name stored for the user, or
+// an empty string if none is set.
+func GetUserTimezone(userID int64) (string, error) {
+	var tz string
+	err := DB.QueryRow(`SELECT IFNULL(timezone, '') FROM users WHERE id = ?`, userID).Scan(&tz)
+	if err != nil && err != sql.ErrNoRows {
+		logging.Log.Errorf("data-access: GetUserTimezone error user=%d: %v", userID, err)
+		return "", err
+	}
+	return tz, nil
+}
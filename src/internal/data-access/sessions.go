@@ -0,0 +1,84 @@
+package data_access
+
+import (
+	"dating-backend/internal/logging"
+	"time"
+)
+
+// CreateSession stores a login session, replacing the previous session of
+// the same device. If the user then has more than maxPerUser sessions, the
+// ones refreshed least recently are evicted; their number is returned.
+func CreateSession(userID int64, deviceID, accessToken, refreshToken string, accessExp, refreshExp time.Time, maxPerUser int) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: CreateSession begin tx error user=%d: %v", userID, err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO sessions (user_id, device_id, access_token, refresh_token, access_expires, refresh_expires)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, deviceID, accessToken, refreshToken, sqlTime(accessExp), sqlTime(refreshExp)); err != nil {
+		logging.Log.Errorf("data-access: CreateSession insert error user=%d: %v", userID, err)
+		return 0, err
+	}
+
+	var evicted int64
+	if maxPerUser > 0 {
+		res, err := tx.Exec(`
+			DELETE FROM sessions WHERE user_id = ? AND id NOT IN (
+				SELECT id FROM sessions WHERE user_id = ?
+				ORDER BY refresh_expires DESC, id DESC LIMIT ?
+			)
+		`, userID, userID, maxPerUser)
+		if err != nil {
+			logging.Log.Errorf("data-access: CreateSession evict error user=%d: %v", userID, err)
+			return 0, err
+		}
+		evicted, _ = res.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: CreateSession commit error user=%d: %v", userID, err)
+		return 0, err
+	}
+	return evicted, nil
+}
+
+// RefreshSession issues a new access token for the session holding
+// refreshToken and extends both expiries. Returns false if no session
+// matched.
+func RefreshSession(userID int64, refreshToken, accessToken string, accessExp, refreshExp time.Time) (bool, error) {
+	res, err := DB.Exec(`
+		UPDATE sessions SET access_token = ?, access_expires = ?, refresh_expires = ?
+		WHERE user_id = ? AND refresh_token = ?
+	`, accessToken, sqlTime(accessExp), sqlTime(refreshExp), userID, refreshToken)
+	if err != nil {
+		logging.Log.Errorf("data-access: RefreshSession exec error user=%d: %v", userID, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// PruneSessions deletes sessions whose refresh token expired before now and
+// returns how many were removed.
+func PruneSessions(now time.Time) (int64, error) {
+	res, err := DB.Exec(`DELETE FROM sessions WHERE refresh_expires < ?`, sqlTime(now))
+	if err != nil {
+		logging.Log.Errorf("data-access: PruneSessions exec error: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountSessions returns the number of rows in the sessions table.
+func CountSessions() (int64, error) {
+	var n int64
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n); err != nil {
+		logging.Log.Errorf("data-access: CountSessions error: %v", err)
+		return 0, err
+	}
+	return n, nil
+}
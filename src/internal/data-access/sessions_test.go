@@ -0,0 +1,45 @@
+package data_access
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSessionCapAndPrune(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    for i := 0; i < 3; i++ {
+        refreshExp := now.Add(time.Duration(i) * time.Hour)
+        evicted, err := CreateSession(1, fmt.Sprintf("d%d", i), fmt.Sprintf("a%d", i), fmt.Sprintf("r%d", i),
+            now, refreshExp, 2)
+        if err != nil { t.Fatalf("create: %v", err) }
+        want := int64(0)
+        if i == 2 { want = 1 }
+        if evicted != want {
+            t.Fatalf("login %d: expected %d evicted, got %d", i, want, evicted)
+        }
+    }
+    var oldest int
+    DB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE device_id = 'd0'`).Scan(&oldest)
+    if oldest != 0 {
+        t.Fatalf("expected the least recently refreshed session evicted")
+    }
+
+    // same device logs in again: replaced, not added
+    if _, err := CreateSession(1, "d2", "a3", "r3", now, now.Add(2*time.Hour), 2); err != nil { t.Fatalf("create: %v", err) }
+    if n, _ := CountSessions(); n != 2 {
+        t.Fatalf("expected 2 sessions, got %d", n)
+    }
+
+    pruned, err := PruneSessions(now.Add(90 * time.Minute))
+    if err != nil { t.Fatalf("prune: %v", err) }
+    if pruned != 1 {
+        t.Fatalf("expected 1 expired session pruned, got %d", pruned)
+    }
+    if ok, err := RefreshSession(1, "r3", "a4", now, now.Add(48*time.Hour)); err != nil || !ok {
+        t.Fatalf("expected live session to refresh, ok=%v err=%v", ok, err)
+    }
+}
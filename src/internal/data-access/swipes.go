@@ -1,30 +1,81 @@
 package data_access
 
 import (
+	"database/sql"
+	"dating-backend/internal/attributes"
+	"dating-backend/internal/interests"
 	"dating-backend/internal/logging"
 	"dating-backend/internal/models"
 	"dating-backend/internal/utils"
 	"math"
+	"time"
 )
 
 // UpsertSwipe puts or updates a swipe record
 func UpsertSwipe(userID, targetID int64, action string) error {
+	return UpsertLike(userID, targetID, action, nil, "")
+}
+
+// UpsertLike records a swipe like UpsertSwipe, with the prompt card or
+// photo of the target it was given on, if any, and a comment to them.
+func UpsertLike(userID, targetID int64, action string, content *models.LikedContent, comment string) error {
+	var contentType, contentID, text any
+	if content != nil {
+		contentType, contentID = content.Type, content.ID
+	}
+	if comment != "" {
+		text = comment
+	}
 	_, err := DB.Exec(`
-		INSERT OR REPLACE INTO swipes (user_id, target_id, action)
-		VALUES (?, ?, ?)
-	`, userID, targetID, action)
+		INSERT OR REPLACE INTO swipes (user_id, target_id, action, content_type, content_id, comment)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, targetID, action, contentType, contentID, text)
 	if err != nil {
 		logging.Log.Errorf("data-access: UpsertSwipe error user=%d target=%d action=%s: %v", userID, targetID, action, err)
 	}
 	return err
 }
 
-// HasLiked checks if userID has liked targetID
+// TakeLikeComment returns the comment userID left with their like on
+// targetID, or "", and clears it so that it is only delivered once.
+func TakeLikeComment(userID, targetID int64) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: TakeLikeComment begin tx error user=%d target=%d: %v", userID, targetID, err)
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var comment string
+	err = tx.QueryRow(`
+		SELECT IFNULL(comment, '') FROM swipes
+		WHERE user_id = ? AND target_id = ? AND action IN ('like', 'superlike')
+	`, userID, targetID).Scan(&comment)
+	if err == sql.ErrNoRows || (err == nil && comment == "") {
+		return "", nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: TakeLikeComment error user=%d target=%d: %v", userID, targetID, err)
+		return "", err
+	}
+
+	if _, err := tx.Exec(`UPDATE swipes SET comment = NULL WHERE user_id = ? AND target_id = ?`, userID, targetID); err != nil {
+		logging.Log.Errorf("data-access: TakeLikeComment clear error user=%d target=%d: %v", userID, targetID, err)
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: TakeLikeComment commit error user=%d target=%d: %v", userID, targetID, err)
+		return "", err
+	}
+	return comment, nil
+}
+
+// HasLiked checks if userID has liked (or super-liked) targetID
 func HasLiked(userID, targetID int64) (bool, error) {
 	var cnt int
 	err := DB.QueryRow(`
 		SELECT COUNT(*) FROM swipes
-		WHERE user_id = ? AND target_id = ? AND action = 'like'
+		WHERE user_id = ? AND target_id = ? AND action IN ('like', 'superlike')
 	`, userID, targetID).Scan(&cnt)
 	if err != nil {
 		logging.Log.Errorf("data-access: HasLiked error user=%d target=%d: %v", userID, targetID, err)
@@ -33,18 +84,35 @@ func HasLiked(userID, targetID int64) (bool, error) {
 	return cnt > 0, nil
 }
 
+// GetSwipeAction returns the action userID took on targetID, or "" if
+// there is no swipe.
+func GetSwipeAction(userID, targetID int64) (string, error) {
+	var action string
+	err := DB.QueryRow(`
+		SELECT action FROM swipes WHERE user_id = ? AND target_id = ?
+	`, userID, targetID).Scan(&action)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: GetSwipeAction error user=%d target=%d: %v", userID, targetID, err)
+		return "", err
+	}
+	return action, nil
+}
+
 // UpsertSwipe and HasLiked are thin wrappers for database operations related
 // to swipe state. Keeping them in data-access centralizes DB code and makes
 // higher-level handlers easier to test and reason about.
 func GetUserFollowers(userID int64) ([]models.User, error) {
 	rows, err := DB.Query(`
 		SELECT 
-		l1.user_id, u.name, u.birthday, u.photo_url, u.bio
+		l1.user_id, u.name, u.birthday, IFNULL(u.photo_url, ''), u.bio
 		FROM swipes l1
 		JOIN users u ON l1.user_id = u.id
 		WHERE 
 			l1.target_id = ? 
-			AND l1.action = 'like'
+			AND l1.action IN ('like', 'superlike')
 			AND l1.user_id NOT IN (
 				SELECT l2.target_id
 				FROM swipes l2
@@ -74,18 +142,47 @@ func GetUserFollowers(userID int64) ([]models.User, error) {
 // GetSwipeCandidates returns a list of users that the given user has not swiped on yet,
 // applying optional filters from SimpleFilter.
 func GetSwipeCandidates(userID int64, f *models.SimpleFilter) ([]models.User, error) {
+	viewerInterests, err := GetUserInterests([]int64{userID}, f.Locale)
+	if err != nil {
+		return nil, err
+	}
+	mine := viewerInterests[userID]
+
+	// Soft preferences rank candidates: one point for each that holds, and
+	// up to one more for the interests they share with the viewer
+	score, scoreArgs := "0", []any{}
+	for _, c := range f.Conditions {
+		if c.Soft {
+			expr, condArgs := attributeCondition(c)
+			score += " + " + expr
+			scoreArgs = append(scoreArgs, condArgs...)
+		}
+	}
+	if len(mine) > 0 {
+		expr, simArgs := interestSimilarity(userID, len(mine))
+		score += " + " + expr
+		scoreArgs = append(scoreArgs, simArgs...)
+	}
+
 	query := `
 	SELECT
 		u.id, u.username, u.name, u.gender, u.birthday,
-		u.interested_in, u.bio, u.photo_url, u.location,
-		u.latitude, u.longitude, u.created_at, u.last_active
+		u.interested_in, u.bio, IFNULL(u.photo_url, ''), u.location,
+		u.latitude, u.longitude, u.created_at,
+		CASE WHEN u.hide_online THEN '' ELSE IFNULL(u.last_active, '') END,
+		u.photo_verified,
+		up.city,
+		sl.id IS NOT NULL AS superliked,
+		` + score + ` AS rank_score
 	FROM users u
 	JOIN user_locations ul ON ul.id = u.id
 	LEFT JOIN swipes s ON s.target_id = u.id AND s.user_id = ?
+	LEFT JOIN swipes sl ON sl.user_id = u.id AND sl.target_id = ? AND sl.action = 'superlike'
+	LEFT JOIN user_passports up ON up.user_id = u.id AND up.expires_at > datetime('now')
 	WHERE u.id != ?
 	  AND s.id IS NULL
 	`
-	args := []any{userID, userID}
+	args := append(scoreArgs, userID, userID, userID)
 
 	// --- dinamic filters ---
 	var lat1, lon1 float64
@@ -121,7 +218,11 @@ func GetSwipeCandidates(userID int64, f *models.SimpleFilter) ([]models.User, er
 	}
 
 	if f.HasPhoto != nil && *f.HasPhoto {
-		query += " AND u.photo_url != ''"
+		query += " AND EXISTS (SELECT 1 FROM user_photos p WHERE p.user_id = u.id)"
+	}
+
+	if f.VerifiedOnly != nil && *f.VerifiedOnly {
+		query += " AND u.photo_verified"
 	}
 
 	if f.InterestedIn != nil && *f.InterestedIn != "" {
@@ -129,14 +230,41 @@ func GetSwipeCandidates(userID int64, f *models.SimpleFilter) ([]models.User, er
 		args = append(args, "%"+*f.InterestedIn+"%")
 	}
 
+	// Users hiding their status are never shown as online
+	if f.OnlineOnly != nil && *f.OnlineOnly {
+		query += " AND NOT u.hide_online AND u.last_active >= ?"
+		args = append(args, sqlTime(time.Now().Add(-OnlineWindow)))
+	}
+
+	if f.ActiveWithinDays != nil && *f.ActiveWithinDays > 0 {
+		query += " AND NOT u.hide_online AND u.last_active >= ?"
+		args = append(args, sqlTime(time.Now().AddDate(0, 0, -int(*f.ActiveWithinDays))))
+	}
+
+	for _, c := range f.Conditions {
+		if !c.Soft {
+			expr, condArgs := attributeCondition(c)
+			query += " AND " + expr
+			args = append(args, condArgs...)
+		}
+	}
+
+	// Users who super-liked the viewer come first, then the rest, each by
+	// rank_score and id. A page continues after the last candidate seen in
+	// that order; whether they superliked the viewer is looked up again.
 	if f.LastSeenID != nil {
-		query += " AND u.id > ?"
-		args = append(args, *f.LastSeenID)
+		var lastScore float64
+		if f.LastSeenScore != nil {
+			lastScore = *f.LastSeenScore
+		}
+		query += ` AND (superliked, rank_score, -u.id) < (
+			EXISTS (SELECT 1 FROM swipes WHERE user_id = ? AND target_id = ? AND action = 'superlike'), ?, -?)`
+		args = append(args, *f.LastSeenID, userID, lastScore, *f.LastSeenID)
 	}
 
 	// --- sort and limits ---
 	query += `
-	ORDER BY u.id ASC
+	ORDER BY superliked DESC, rank_score DESC, u.id ASC
 	LIMIT ?
 	`
 	args = append(args, f.PageSize)
@@ -151,10 +279,12 @@ func GetSwipeCandidates(userID int64, f *models.SimpleFilter) ([]models.User, er
 	var candidates []models.User
 	for rows.Next() {
 		var u models.User
+		var travelingTo sql.NullString
 			if err := rows.Scan(
 			&u.ID, &u.Username, &u.Name, &u.Gender, &u.Birthday,
 			&u.InterestedIn, &u.Bio, &u.PhotoURL, &u.Location,
 			&u.Latitude, &u.Longitude, &u.CreatedAt, &u.LastActive,
+			&u.PhotoVerified, &travelingTo, &u.SuperLikedYou, &u.RankScore,
 		); err != nil {
 			logging.Log.Errorf("data-access: GetSwipeCandidates scan error user=%d: %v", userID, err)
 			return nil, err
@@ -175,15 +305,55 @@ func GetSwipeCandidates(userID int64, f *models.SimpleFilter) ([]models.User, er
 		}
 		u.Latitude = nil 
 		u.Longitude= nil
+		if travelingTo.Valid {
+			// distance above is measured from the home location, the
+			// label tells the viewer the user is currently elsewhere
+			u.TravelingTo = &travelingTo.String
+		}
 		
 		u.Age = utils.GetAge(&u.Birthday.Time)
 
 		candidates = append(candidates, u)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(candidates))
+	for i, u := range candidates {
+		ids[i] = u.ID
+	}
+	photos, err := GetPhotosForUsers(ids)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := GetAttributes(ids)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := GetUserInterests(ids, f.Locale)
+	if err != nil {
+		return nil, err
+	}
+	prompts, err := GetPromptAnswers(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range candidates {
+		c := &candidates[i]
+		c.Photos = photos[c.ID]
+		c.Prompts = prompts[c.ID]
+		// candidates aren't matched with the viewer yet
+		c.Attributes, _ = attributes.Profile(attrs[c.ID], isPublic)
+		c.Interests = tags[c.ID]
+		c.SharedInterests = interests.Shared(mine, c.Interests)
+	}
 
 	return candidates, nil
 }
 
+func isPublic(visibility string) bool { return visibility == attributes.Public }
+
 func haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	const R = 6371.0 // Earth radius in km
 	dLat := (lat2 - lat1) * math.Pi / 180.0
@@ -197,6 +367,125 @@ func haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	return R * c
 }
 
+// GetLastSwipe returns the most recent swipe made by userID, or nil if the
+// user has not swiped yet.
+func GetLastSwipe(userID int64) (*models.Swipe, error) {
+	sw := &models.Swipe{}
+	err := DB.QueryRow(`
+		SELECT id, user_id, target_id, action, created_at
+		FROM swipes
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, userID).Scan(&sw.ID, &sw.UserID, &sw.TargetID, &sw.Action, &sw.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: GetLastSwipe error user=%d: %v", userID, err)
+		return nil, err
+	}
+	return sw, nil
+}
+
+// DeleteSwipe removes a single swipe so the target can show up in
+// discovery again.
+func DeleteSwipe(swipeID int64) error {
+	_, err := DB.Exec(`DELETE FROM swipes WHERE id = ?`, swipeID)
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteSwipe error id=%d: %v", swipeID, err)
+	}
+	return err
+}
+
+// GetSwipeHistory returns the user's own swipes, newest first, with a
+// summary of each target. action filters by swipe action when non-empty;
+// cursor is the id of the last swipe of the previous page.
+func GetSwipeHistory(userID int64, action string, cursor *int64, limit int) ([]models.SwipeHistoryItem, error) {
+	query := `
+		SELECT s.id, s.action, s.created_at, u.id, IFNULL(u.name, ''), u.birthday, IFNULL(u.photo_url, '')
+		FROM swipes s
+		JOIN users u ON u.id = s.target_id
+		WHERE s.user_id = ?`
+	args := []any{userID}
+
+	if action != "" {
+		query += " AND s.action = ?"
+		args = append(args, action)
+	}
+	if cursor != nil {
+		query += " AND s.id < ?"
+		args = append(args, *cursor)
+	}
+	query += " ORDER BY s.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetSwipeHistory query error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.SwipeHistoryItem{}
+	for rows.Next() {
+		var it models.SwipeHistoryItem
+		var b models.SQLiteDate
+		if err := rows.Scan(&it.SwipeID, &it.Action, &it.CreatedAt,
+			&it.User.ID, &it.User.Name, &b, &it.User.PhotoURL); err != nil {
+			logging.Log.Errorf("data-access: GetSwipeHistory scan error user=%d: %v", userID, err)
+			return nil, err
+		}
+		if !b.Time.IsZero() {
+			it.User.Age = utils.GetAge(&b.Time)
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// DeleteDislike removes the user's dislike of targetID so the target can
+// show up in discovery again. Returns false if there was no such dislike.
+func DeleteDislike(userID, targetID int64) (bool, error) {
+	res, err := DB.Exec(`
+		DELETE FROM swipes WHERE user_id = ? AND target_id = ? AND action = 'dislike'
+	`, userID, targetID)
+	if err != nil {
+		logging.Log.Errorf("data-access: DeleteDislike error user=%d target=%d: %v", userID, targetID, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetSwipeStats counts likes sent and received since the given time and
+// how many of the sent likes turned into matches. A match counts in the
+// window when the later of the two likes falls into it.
+func GetSwipeStats(userID int64, since time.Time) (*models.SwipeStats, error) {
+	st := &models.SwipeStats{}
+	from := sqlTime(since)
+	err := DB.QueryRow(`
+		SELECT
+		(SELECT COUNT(*) FROM swipes
+			WHERE user_id = ? AND action IN ('like', 'superlike') AND created_at >= ?),
+		(SELECT COUNT(*) FROM swipes
+			WHERE target_id = ? AND action IN ('like', 'superlike') AND created_at >= ?),
+		(SELECT COUNT(*) FROM swipes s
+			JOIN swipes r ON r.user_id = s.target_id AND r.target_id = s.user_id
+				AND r.action IN ('like', 'superlike')
+			WHERE s.user_id = ? AND s.action IN ('like', 'superlike')
+				AND MAX(s.created_at, r.created_at) >= ?)
+	`, userID, from, userID, from, userID, from).Scan(&st.LikesSent, &st.LikesReceived, &st.Matches)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetSwipeStats error user=%d: %v", userID, err)
+		return nil, err
+	}
+	if st.LikesSent > 0 {
+		st.MatchRate = float64(st.Matches) / float64(st.LikesSent)
+	}
+	return st, nil
+}
+
 // Only for testing purposes
 func ClearSwipesForUser(userID int64) (error) {
 	_, err := DB.Exec(`DELETE FROM swipes WHERE user_id = ?`,
@@ -2,7 +2,12 @@ package data_access
 
 import (
 	"database/sql"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
+
+	"dating-backend/internal/models"
 
 	_ "modernc.org/sqlite"
 )
@@ -16,9 +21,33 @@ func setupInMemoryDB(t *testing.T) func() {
 
     // create tables like in InitDB
     stmts := []string{
-        `CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, password TEXT NOT NULL);`,
-        `CREATE TABLE swipes (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, target_id INTEGER NOT NULL, action TEXT CHECK(action IN ('like', 'dislike')) NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, UNIQUE(user_id, target_id));`,
+        `CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, password TEXT NOT NULL, name TEXT, gender TEXT, interested_in TEXT, bio TEXT, birthday TEXT, photo_url TEXT, location TEXT, latitude REAL, longitude REAL, created_at TEXT DEFAULT CURRENT_TIMESTAMP, last_active TEXT, timezone TEXT, hide_online BOOLEAN NOT NULL DEFAULT 0, hide_read_receipts BOOLEAN NOT NULL DEFAULT 0, photo_verified BOOLEAN NOT NULL DEFAULT 0);`,
+        `CREATE VIRTUAL TABLE user_locations USING rtree(id, min_lat, max_lat, min_lon, max_lon);`,
+        `CREATE TABLE user_passports (user_id INTEGER PRIMARY KEY, city TEXT NOT NULL DEFAULT '', latitude REAL NOT NULL, longitude REAL NOT NULL, expires_at DATETIME NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+        `CREATE TABLE swipes (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, target_id INTEGER NOT NULL, action TEXT CHECK(action IN ('like', 'dislike', 'superlike')) NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, seen_at DATETIME, content_type TEXT, content_id INTEGER, comment TEXT, UNIQUE(user_id, target_id));`,
         `CREATE TABLE chats (id INTEGER PRIMARY KEY AUTOINCREMENT, user1_id INTEGER NOT NULL, user2_id INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, UNIQUE(user1_id, user2_id));`,
+        `CREATE TABLE messages (id INTEGER PRIMARY KEY AUTOINCREMENT, chat_id INTEGER NOT NULL, sender_id INTEGER NOT NULL, receiver_id INTEGER NOT NULL, content TEXT NOT NULL, is_read BOOLEAN DEFAULT 0, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, client_id TEXT, delivered_at DATETIME, read_at DATETIME, edited_at DATETIME, deleted_at DATETIME);`,
+        `CREATE UNIQUE INDEX idx_messages_client_id ON messages(sender_id, client_id) WHERE client_id IS NOT NULL;`,
+        `CREATE TABLE sessions (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, device_id TEXT NOT NULL, access_token TEXT NOT NULL UNIQUE, refresh_token TEXT NOT NULL UNIQUE, access_expires DATETIME NOT NULL, refresh_expires DATETIME NOT NULL, UNIQUE(user_id, device_id));`,
+        `CREATE TABLE jobs (id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, payload TEXT NOT NULL DEFAULT '', unique_key TEXT UNIQUE, run_at DATETIME NOT NULL, locked_until DATETIME, attempts INTEGER NOT NULL DEFAULT 0, max_attempts INTEGER NOT NULL, last_error TEXT NOT NULL DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+        `CREATE TABLE job_keys (key TEXT PRIMARY KEY, created_at DATETIME NOT NULL);`,
+        `CREATE TABLE dead_jobs (id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, payload TEXT NOT NULL DEFAULT '', attempts INTEGER NOT NULL, max_attempts INTEGER NOT NULL, last_error TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL, failed_at DATETIME NOT NULL);`,
+        `CREATE TABLE matches (id INTEGER PRIMARY KEY AUTOINCREMENT, user1_id INTEGER NOT NULL, user2_id INTEGER NOT NULL, chat_id INTEGER NOT NULL, source TEXT NOT NULL DEFAULT 'like', status TEXT NOT NULL DEFAULT 'active', created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP, warned_at DATETIME, UNIQUE(user1_id, user2_id));`,
+        `CREATE TABLE event_seqs (user_id INTEGER PRIMARY KEY, last_seq INTEGER NOT NULL);`,
+        `CREATE TABLE event_acks (user_id INTEGER NOT NULL, device_id TEXT NOT NULL, seq INTEGER NOT NULL, updated_at DATETIME NOT NULL, PRIMARY KEY (user_id, device_id));`,
+        `CREATE TABLE user_events (user_id INTEGER NOT NULL, seq INTEGER NOT NULL, payload TEXT NOT NULL, created_at DATETIME NOT NULL, PRIMARY KEY (user_id, seq));`,
+        `CREATE TABLE message_edits (id INTEGER PRIMARY KEY AUTOINCREMENT, message_id INTEGER NOT NULL, content TEXT NOT NULL, edited_at DATETIME NOT NULL);`,
+        `CREATE TABLE attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, chat_id INTEGER NOT NULL, uploader_id INTEGER NOT NULL, message_id INTEGER, kind TEXT NOT NULL, mime TEXT NOT NULL, size INTEGER NOT NULL, width INTEGER NOT NULL DEFAULT 0, height INTEGER NOT NULL DEFAULT 0, blob_key TEXT NOT NULL, thumb_key TEXT NOT NULL DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+        `CREATE TABLE user_photos (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, position INTEGER NOT NULL, blob_key TEXT NOT NULL UNIQUE, width INTEGER NOT NULL, height INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+        `CREATE TABLE photo_verifications (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, pose TEXT NOT NULL, status TEXT NOT NULL, reason TEXT NOT NULL DEFAULT '', selfie_key TEXT NOT NULL DEFAULT '', reviewer_id INTEGER, created_at DATETIME NOT NULL, expires_at DATETIME NOT NULL, submitted_at DATETIME, reviewed_at DATETIME);`,
+        `CREATE TABLE user_attributes (user_id INTEGER NOT NULL, key TEXT NOT NULL, visibility TEXT NOT NULL, PRIMARY KEY (user_id, key));`,
+        `CREATE TABLE user_attribute_values (user_id INTEGER NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL, num INTEGER, PRIMARY KEY (user_id, key, value));`,
+        `CREATE TABLE interests (id INTEGER PRIMARY KEY AUTOINCREMENT, code TEXT NOT NULL UNIQUE, category TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+        `CREATE TABLE interest_labels (interest_id INTEGER NOT NULL, locale TEXT NOT NULL, label TEXT NOT NULL, PRIMARY KEY (interest_id, locale));`,
+        `CREATE TABLE user_interests (user_id INTEGER NOT NULL, interest_id INTEGER NOT NULL, PRIMARY KEY (user_id, interest_id));`,
+        `CREATE TABLE prompts (id INTEGER PRIMARY KEY AUTOINCREMENT, text TEXT NOT NULL, active BOOLEAN NOT NULL DEFAULT 1, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`,
+        `CREATE TABLE user_prompts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, prompt_id INTEGER NOT NULL, answer TEXT NOT NULL, position INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, UNIQUE(user_id, prompt_id));`,
+        `CREATE TABLE message_deletions (message_id INTEGER NOT NULL, user_id INTEGER NOT NULL, deleted_at DATETIME NOT NULL, PRIMARY KEY (message_id, user_id));`,
     }
     for _, s := range stmts {
         if _, err := DB.Exec(s); err != nil {
@@ -71,3 +100,239 @@ func TestCreateOrGetChat_Uniqueness(t *testing.T) {
         t.Fatalf("expected same chat id, got %d and %d", id1, id2)
     }
 }
+
+func TestSuperlikeAndLastSwipe(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if err := UpsertSwipe(1, 2, "dislike"); err != nil { t.Fatalf("upsert: %v", err) }
+    if err := UpsertSwipe(1, 3, "superlike"); err != nil { t.Fatalf("upsert: %v", err) }
+
+    liked, err := HasLiked(1, 3)
+    if err != nil { t.Fatalf("hasliked: %v", err) }
+    if !liked { t.Fatalf("expected superlike to count as like") }
+
+    last, err := GetLastSwipe(1)
+    if err != nil { t.Fatalf("last swipe: %v", err) }
+    if last == nil || last.TargetID != 3 || last.Action != "superlike" {
+        t.Fatalf("expected superlike on 3 as last swipe, got %+v", last)
+    }
+
+    if err := DeleteSwipe(last.ID); err != nil { t.Fatalf("delete: %v", err) }
+    last, err = GetLastSwipe(1)
+    if err != nil { t.Fatalf("last swipe: %v", err) }
+    if last == nil || last.TargetID != 2 {
+        t.Fatalf("expected dislike on 2 after rewind, got %+v", last)
+    }
+}
+
+func TestSwipeCandidatesPagination(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    for id := int64(1); id <= 7; id++ {
+        if _, err := DB.Exec(`INSERT INTO users (id, username, password, name, gender, interested_in, bio, birthday, latitude, longitude)
+            VALUES (?, ?, 'x', 'n', 'female', 'male', '', '1995-01-01', 55.75, 37.61)`, id, "u"+strconv.FormatInt(id, 10)); err != nil {
+            t.Fatalf("insert user: %v", err)
+        }
+        if err := UpdateUserLocationIndex(id, 55.75, 37.61); err != nil { t.Fatalf("location: %v", err) }
+    }
+    // 4, 6 and 7 share the viewer's interest and rank higher; 3 and 6
+    // superliked the viewer and come first
+    DB.Exec(`INSERT INTO interests (id, code, category) VALUES (1, 'hiking', 'sport')`)
+    for _, id := range []int64{1, 4, 6, 7} {
+        DB.Exec(`INSERT INTO user_interests (user_id, interest_id) VALUES (?, 1)`, id)
+    }
+    for _, id := range []int64{3, 6} {
+        if err := UpsertSwipe(id, 1, "superlike"); err != nil { t.Fatalf("upsert: %v", err) }
+    }
+    want := []int64{6, 3, 4, 7, 2, 5}
+
+    for size := int64(1); size <= 4; size++ {
+        f := &models.SimpleFilter{PageSize: size}
+        var got []int64
+        for page := 0; page < 10; page++ {
+            users, err := GetSwipeCandidates(1, f)
+            if err != nil { t.Fatalf("candidates: %v", err) }
+            if len(users) == 0 {
+                break
+            }
+            for _, u := range users {
+                got = append(got, u.ID)
+            }
+            last := users[len(users)-1]
+            f.LastSeenID, f.LastSeenScore = &last.ID, &last.RankScore
+        }
+        if !slices.Equal(got, want) {
+            t.Fatalf("page size %d: expected %v, got %v", size, want, got)
+        }
+    }
+}
+
+func TestSwipeCandidatesFromPassport(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    // the viewer and 2 live in Moscow, 3 in Saint Petersburg, 4 in Tver
+    homes := map[int64][2]float64{1: {55.75, 37.61}, 2: {55.76, 37.62}, 3: {59.93, 30.33}, 4: {56.86, 35.90}}
+    for id, home := range homes {
+        if _, err := DB.Exec(`INSERT INTO users (id, username, password, name, gender, interested_in, bio, birthday, latitude, longitude)
+            VALUES (?, ?, 'x', 'n', 'female', 'male', '', '1995-01-01', ?, ?)`, id, "u"+strconv.FormatInt(id, 10), home[0], home[1]); err != nil {
+            t.Fatalf("insert user: %v", err)
+        }
+        if err := UpdateUserLocationIndex(id, home[0], home[1]); err != nil { t.Fatalf("location: %v", err) }
+    }
+    if err := SetPassport(1, &models.Passport{City: "Saint Petersburg", Latitude: 59.94, Longitude: 30.31, ExpiresAt: time.Now().Add(24 * time.Hour)}); err != nil {
+        t.Fatalf("set passport: %v", err)
+    }
+    passport, err := GetActivePassport(1)
+    if err != nil || passport == nil { t.Fatalf("get passport: %+v %v", passport, err) }
+
+    // the client still sends its home location and no radius
+    home := homes[1]
+    f := &models.SimpleFilter{Latitude: &home[0], Longitude: &home[1], PageSize: 10}
+    passport.Apply(f)
+    users, err := GetSwipeCandidates(1, f)
+    if err != nil { t.Fatalf("candidates: %v", err) }
+    if len(users) != 1 || users[0].ID != 3 || users[0].DistanceKm == nil || *users[0].DistanceKm > 5 {
+        t.Fatalf("expected only user 3 near the passport, got %+v", users)
+    }
+
+    // a radius sent by the client is kept
+    radius := 1000.0
+    f = &models.SimpleFilter{MaxDistanceKm: &radius, PageSize: 10}
+    passport.Apply(f)
+    users, err = GetSwipeCandidates(1, f)
+    if err != nil { t.Fatalf("candidates: %v", err) }
+    if len(users) != 3 {
+        t.Fatalf("expected 3 candidates within %v km, got %+v", radius, users)
+    }
+}
+
+func TestSwipeCandidatesActiveWithinSkipsHiddenUsers(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    recent, old := sqlTime(time.Now().Add(-time.Hour)), sqlTime(time.Now().AddDate(0, 0, -30))
+    for id, lastActive := range map[int64]string{1: recent, 2: recent, 3: recent, 4: old} {
+        if _, err := DB.Exec(`INSERT INTO users (id, username, password, name, gender, interested_in, bio, birthday, last_active)
+            VALUES (?, ?, 'x', 'n', 'female', 'male', '', '1995-01-01', ?)`, id, "u"+strconv.FormatInt(id, 10), lastActive); err != nil {
+            t.Fatalf("insert user: %v", err)
+        }
+        if err := UpdateUserLocationIndex(id, 55.75, 37.61); err != nil { t.Fatalf("location: %v", err) }
+    }
+    // 3 hides their online status, so their activity can't be filtered on
+    DB.Exec(`UPDATE users SET hide_online = 1 WHERE id = 3`)
+
+    days := int64(7)
+    users, err := GetSwipeCandidates(1, &models.SimpleFilter{ActiveWithinDays: &days, PageSize: 10})
+    if err != nil { t.Fatalf("candidates: %v", err) }
+    if len(users) != 1 || users[0].ID != 2 {
+        t.Fatalf("expected only user 2, got %+v", users)
+    }
+}
+
+// insertSwipeAt records a swipe made ago before now.
+func insertSwipeAt(t *testing.T, userID, targetID int64, action string, ago time.Duration) {
+    if _, err := DB.Exec(`INSERT INTO swipes (user_id, target_id, action, created_at) VALUES (?, ?, ?, ?)`,
+        userID, targetID, action, sqlTime(time.Now().Add(-ago))); err != nil {
+        t.Fatalf("insert swipe: %v", err)
+    }
+}
+
+func TestSwipeHistoryCursor(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    for id := int64(1); id <= 6; id++ {
+        DB.Exec(`INSERT INTO users (id, username, password, name, birthday) VALUES (?, ?, 'x', 'n', '1995-01-01')`, id, "u"+strconv.FormatInt(id, 10))
+    }
+    actions := map[int64]string{2: "like", 3: "dislike", 4: "superlike", 5: "dislike", 6: "like"}
+    for target := int64(2); target <= 6; target++ {
+        if err := UpsertSwipe(1, target, actions[target]); err != nil { t.Fatalf("upsert: %v", err) }
+    }
+    if err := UpsertSwipe(2, 1, "like"); err != nil { t.Fatalf("upsert: %v", err) }
+
+    // pages follow the cursor newest first, without gaps or repeats
+    page := func(action string, want []int64) {
+        var got []int64
+        var cursor *int64
+        for i := 0; i < 10; i++ {
+            items, err := GetSwipeHistory(1, action, cursor, 2)
+            if err != nil { t.Fatalf("history: %v", err) }
+            for _, it := range items {
+                if it.Action != actions[it.User.ID] || it.User.Age == 0 {
+                    t.Fatalf("unexpected item %+v", it)
+                }
+                got = append(got, it.User.ID)
+            }
+            if len(items) < 2 {
+                break
+            }
+            cursor = &items[len(items)-1].SwipeID
+        }
+        if !slices.Equal(got, want) {
+            t.Fatalf("action %q: expected %v, got %v", action, want, got)
+        }
+    }
+    page("", []int64{6, 5, 4, 3, 2})
+    page("dislike", []int64{5, 3})
+}
+
+func TestDeleteDislikeOutsideRewindWindow(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    // both swipes are long past the rewind window
+    insertSwipeAt(t, 1, 2, "dislike", 48*time.Hour)
+    insertSwipeAt(t, 1, 3, "like", 48*time.Hour)
+
+    removed, err := DeleteDislike(1, 2)
+    if err != nil || !removed { t.Fatalf("expected old dislike removed, got %v %v", removed, err) }
+    removed, err = DeleteDislike(1, 2)
+    if err != nil || removed { t.Fatalf("expected nothing left to remove, got %v %v", removed, err) }
+
+    // likes stay
+    removed, err = DeleteDislike(1, 3)
+    if err != nil || removed { t.Fatalf("expected like kept, got %v %v", removed, err) }
+    if liked, _ := HasLiked(1, 3); !liked { t.Fatalf("expected like on 3 kept") }
+}
+
+func TestSwipeStats(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    day := 24 * time.Hour
+    insertSwipeAt(t, 1, 2, "like", 2*day)
+    insertSwipeAt(t, 1, 3, "like", 40*day)
+    insertSwipeAt(t, 1, 4, "superlike", time.Hour)
+    insertSwipeAt(t, 1, 5, "dislike", time.Hour)
+    // 2 answers today, so the match counts in the last 24 hours
+    insertSwipeAt(t, 2, 1, "like", time.Hour)
+    insertSwipeAt(t, 3, 1, "superlike", 35*day)
+    insertSwipeAt(t, 6, 1, "like", 3*day)
+    insertSwipeAt(t, 7, 1, "dislike", time.Hour)
+
+    cases := []struct {
+        since                   time.Duration
+        sent, received, matches int
+    }{
+        {day, 1, 1, 1},
+        {7 * day, 2, 2, 1},
+        {0, 3, 3, 2},
+    }
+    for _, c := range cases {
+        since := time.Time{}
+        if c.since > 0 {
+            since = time.Now().Add(-c.since)
+        }
+        st, err := GetSwipeStats(1, since)
+        if err != nil { t.Fatalf("stats: %v", err) }
+        if st.LikesSent != c.sent || st.LikesReceived != c.received || st.Matches != c.matches {
+            t.Fatalf("since %v: expected %d/%d/%d, got %+v", c.since, c.sent, c.received, c.matches, st)
+        }
+        if rate := float64(c.matches) / float64(c.sent); st.MatchRate != rate {
+            t.Fatalf("since %v: expected match rate %v, got %v", c.since, rate, st.MatchRate)
+        }
+    }
+}
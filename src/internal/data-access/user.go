@@ -24,13 +24,20 @@ func GetUserByID(id int64) (*models.User, error) {
 		IFNULL(latitude, 0),
 		IFNULL(longitude, 0),
 		IFNULL(created_at, ''),
-		IFNULL(last_active, '')
+		IFNULL(last_active, ''),
+		IFNULL(timezone, ''),
+		hide_online,
+		hide_read_receipts,
+		photo_verified,
+		(SELECT city FROM user_passports p
+			WHERE p.user_id = users.id AND p.expires_at > datetime('now'))
 	FROM users WHERE id = ?`, id)
 
 	var b models.SQLiteDate
+	var travelingTo sql.NullString
 	err := row.Scan(&u.ID, &u.Username, &u.Name, &u.Gender, &b,
 		&u.InterestedIn, &u.Bio, &u.PhotoURL, &u.Location, &u.Latitude, 
-		&u.Longitude, &u.CreatedAt, &u.LastActive)
+		&u.Longitude, &u.CreatedAt, &u.LastActive, &u.Timezone, &u.HideOnline, &u.HideReadReceipts, &u.PhotoVerified, &travelingTo)
 	if err == sql.ErrNoRows {
 		logging.Log.Errorf("data-access: GetUserByID not found id=%d", id)
 		return nil, fmt.Errorf("not found")
@@ -43,27 +50,99 @@ func GetUserByID(id int64) (*models.User, error) {
 	if !b.Time.IsZero() {
 		u.Birthday = &b
 	}
+	if travelingTo.Valid {
+		u.TravelingTo = &travelingTo.String
+	}
 
 	return u, nil
 }
 
+// ReadReceiptsHidden reports whether the user chose not to send read
+// receipts.
+func ReadReceiptsHidden(userID int64) (bool, error) {
+	var hidden bool
+	err := DB.QueryRow(`SELECT hide_read_receipts FROM users WHERE id = ?`, userID).Scan(&hidden)
+	if err != nil {
+		logging.Log.Errorf("data-access: ReadReceiptsHidden error id=%d: %v", userID, err)
+	}
+	return hidden, err
+}
+
 // UpdateUser updates the user's profile information.
 func UpdateUser(u *models.User) error {
-	_, err := DB.Exec(`
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: UpdateUser begin tx error id=%d: %v", u.ID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateUser(tx, u); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: UpdateUser commit error id=%d: %v", u.ID, err)
+		return err
+	}
+	return nil
+}
+
+// UpdateProfile saves a profile edit in one transaction, so a rejected or
+// failed part leaves the whole profile as it was. It returns
+// ErrTooManyInterests, ErrUnknownInterest or ErrUnknownPrompt for invalid
+// picks.
+func UpdateProfile(p *models.ProfileUpdate) error {
+	u := p.User
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: UpdateProfile begin tx error id=%d: %v", u.ID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if p.InterestIDs != nil {
+		if err := setUserInterests(tx, u.ID, *p.InterestIDs, p.InterestLimit); err != nil {
+			return err
+		}
+	}
+	if p.Prompts != nil {
+		if err := setPromptAnswers(tx, u.ID, *p.Prompts); err != nil {
+			return err
+		}
+	}
+	if err := updateUser(tx, u); err != nil {
+		return err
+	}
+	if len(p.AttributeVisibility) > 0 {
+		if err := setAttributes(tx, u.ID, p.AttributeValues, p.AttributeVisibility); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: UpdateProfile commit error id=%d: %v", u.ID, err)
+		return err
+	}
+	return nil
+}
+
+func updateUser(tx *sql.Tx, u *models.User) error {
+	_, err := tx.Exec(`
 		UPDATE users SET 
 		name=?,
 		gender=?,
 		birthday=?,
 		interested_in=?,
 		bio=?,
-		photo_url=?,
 		location=?,
 		latitude=?,
 		longitude=?,
+		timezone=?,
+		hide_online=?,
+		hide_read_receipts=?,
 		last_active=CURRENT_TIMESTAMP
 		WHERE id=?`,
-		u.Name, u.Gender, u.Birthday, u.InterestedIn, u.Bio, u.PhotoURL, 
-		u.Location, u.Latitude, u.Longitude, u.ID,
+		u.Name, u.Gender, u.Birthday, u.InterestedIn, u.Bio,
+		u.Location, u.Latitude, u.Longitude, u.Timezone, u.HideOnline, u.HideReadReceipts, u.ID,
 	)
 	if err != nil {
 		logging.Log.Errorf("data-access: UpdateUser error id=%d: %v", u.ID, err)
@@ -0,0 +1,211 @@
+package data_access
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+// ErrVerificationPending is returned by StartVerification while an earlier
+// selfie of the user still waits for a decision.
+var ErrVerificationPending = errors.New("verification pending")
+
+const verificationColumns = `id, user_id, pose, status, reason, selfie_key, reviewer_id,
+	created_at, expires_at, submitted_at, reviewed_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVerification(row rowScanner) (*models.Verification, error) {
+	var v models.Verification
+	var reviewer sql.NullInt64
+	var expires time.Time
+	var submitted, reviewed sql.NullTime
+	err := row.Scan(&v.ID, &v.UserID, &v.Pose, &v.Status, &v.Reason, &v.SelfieKey, &reviewer,
+		&v.CreatedAt, &expires, &submitted, &reviewed)
+	if err != nil {
+		return nil, err
+	}
+	if reviewer.Valid {
+		v.ReviewerID = &reviewer.Int64
+	}
+	if v.Status == "requested" {
+		v.ExpiresAt = &expires
+	}
+	v.SubmittedAt = nullTime(submitted)
+	v.ReviewedAt = nullTime(reviewed)
+	return &v, nil
+}
+
+// StartVerification hands the user a pose to take a selfie in until
+// expires, replacing a pose handed out before.
+func StartVerification(userID int64, pose string, now, expires time.Time) (*models.Verification, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: StartVerification begin tx error user=%d: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM photo_verifications WHERE user_id = ? AND status = 'pending')`, userID).Scan(&pending)
+	if err != nil {
+		logging.Log.Errorf("data-access: StartVerification lookup error user=%d: %v", userID, err)
+		return nil, err
+	}
+	if pending {
+		return nil, ErrVerificationPending
+	}
+	if _, err := tx.Exec(`DELETE FROM photo_verifications WHERE user_id = ? AND status = 'requested'`, userID); err != nil {
+		logging.Log.Errorf("data-access: StartVerification cleanup error user=%d: %v", userID, err)
+		return nil, err
+	}
+
+	v, err := scanVerification(tx.QueryRow(`
+		INSERT INTO photo_verifications (user_id, pose, status, created_at, expires_at)
+		VALUES (?, ?, 'requested', ?, ?)
+		RETURNING `+verificationColumns,
+		userID, pose, sqlTime(now), sqlTime(expires)))
+	if err != nil {
+		logging.Log.Errorf("data-access: StartVerification insert error user=%d: %v", userID, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: StartVerification commit error user=%d: %v", userID, err)
+		return nil, err
+	}
+	return v, nil
+}
+
+// GetLatestVerification returns the user's most recent verification
+// request, or nil if there is none.
+func GetLatestVerification(userID int64) (*models.Verification, error) {
+	v, err := scanVerification(DB.QueryRow(`
+		SELECT `+verificationColumns+`
+		FROM photo_verifications WHERE user_id = ?
+		ORDER BY id DESC LIMIT 1
+	`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: GetLatestVerification error user=%d: %v", userID, err)
+	}
+	return v, err
+}
+
+// GetVerification returns a verification request, or nil if there is none.
+func GetVerification(id int64) (*models.Verification, error) {
+	v, err := scanVerification(DB.QueryRow(`
+		SELECT `+verificationColumns+` FROM photo_verifications WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: GetVerification error id=%d: %v", id, err)
+	}
+	return v, err
+}
+
+// SubmitVerification attaches a selfie to the pose the user was handed and
+// queues it for a decision. It returns nil if the user has no pose that
+// hasn't expired.
+func SubmitVerification(userID int64, selfieKey string, now time.Time) (*models.Verification, error) {
+	v, err := scanVerification(DB.QueryRow(`
+		UPDATE photo_verifications
+		SET status = 'pending', selfie_key = ?, submitted_at = ?
+		WHERE user_id = ? AND status = 'requested' AND expires_at > ?
+		RETURNING `+verificationColumns,
+		selfieKey, sqlTime(now), userID, sqlTime(now)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: SubmitVerification error user=%d: %v", userID, err)
+	}
+	return v, err
+}
+
+// GetPendingVerifications returns the review queue, oldest first, after
+// the cursor id.
+func GetPendingVerifications(cursor *int64, limit int) ([]models.Verification, error) {
+	query := `SELECT ` + verificationColumns + ` FROM photo_verifications WHERE status = 'pending'`
+	args := []any{}
+	if cursor != nil {
+		query += " AND id > ?"
+		args = append(args, *cursor)
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		logging.Log.Errorf("data-access: GetPendingVerifications query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Verification{}
+	for rows.Next() {
+		v, err := scanVerification(rows)
+		if err != nil {
+			logging.Log.Errorf("data-access: GetPendingVerifications scan error: %v", err)
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+// DecideVerification approves or rejects a pending request; approval
+// gives the user the photo_verified badge. reviewerID is nil when the
+// engine decided. The selfie key is cleared, the returned request still
+// carries it so the caller can delete the file. It returns nil if the
+// request isn't pending.
+func DecideVerification(id int64, approved bool, reason string, reviewerID *int64, now time.Time) (*models.Verification, error) {
+	status := "rejected"
+	if approved {
+		status, reason = "approved", ""
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		logging.Log.Errorf("data-access: DecideVerification begin tx error id=%d: %v", id, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	v, err := scanVerification(tx.QueryRow(`
+		UPDATE photo_verifications
+		SET status = ?, reason = ?, reviewer_id = ?, reviewed_at = ?
+		WHERE id = ? AND status = 'pending'
+		RETURNING `+verificationColumns,
+		status, reason, reviewerID, sqlTime(now), id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("data-access: DecideVerification update error id=%d: %v", id, err)
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE photo_verifications SET selfie_key = '' WHERE id = ?`, id); err != nil {
+		logging.Log.Errorf("data-access: DecideVerification clear selfie error id=%d: %v", id, err)
+		return nil, err
+	}
+	if approved {
+		if _, err := tx.Exec(`UPDATE users SET photo_verified = 1 WHERE id = ?`, v.UserID); err != nil {
+			logging.Log.Errorf("data-access: DecideVerification badge error user=%d: %v", v.UserID, err)
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logging.Log.Errorf("data-access: DecideVerification commit error id=%d: %v", id, err)
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,80 @@
+package data_access
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhotoVerification(t *testing.T) {
+    tear := setupInMemoryDB(t)
+    defer tear()
+
+    if _, err := DB.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'a', 'x'), (2, 'b', 'x')`); err != nil {
+        t.Fatalf("insert users: %v", err)
+    }
+    now := time.Now().UTC().Truncate(time.Second)
+    verified := func(userID int64) bool {
+        var v bool
+        DB.QueryRow(`SELECT photo_verified FROM users WHERE id = ?`, userID).Scan(&v)
+        return v
+    }
+
+    if v, _ := SubmitVerification(1, "verifications/early.jpg", now); v != nil {
+        t.Fatalf("expected no selfie accepted without a pose, got %+v", v)
+    }
+
+    old, err := StartVerification(1, "thumbs_up", now.Add(-time.Hour), now.Add(-50*time.Minute))
+    if err != nil || old.Status != "requested" || old.ExpiresAt == nil { t.Fatalf("start: %+v %v", old, err) }
+    if v, _ := SubmitVerification(1, "verifications/late.jpg", now); v != nil {
+        t.Fatalf("expected an expired pose rejected, got %+v", v)
+    }
+
+    started, err := StartVerification(1, "peace_sign", now, now.Add(10*time.Minute))
+    if err != nil { t.Fatalf("start: %v", err) }
+    if n := countRows(t, "photo_verifications"); n != 1 {
+        t.Fatalf("expected the old pose replaced, got %d requests", n)
+    }
+    v, err := SubmitVerification(1, "verifications/a.jpg", now)
+    if err != nil || v == nil || v.ID != started.ID || v.Status != "pending" || v.Pose != "peace_sign" {
+        t.Fatalf("submit: %+v %v", v, err)
+    }
+    if _, err := StartVerification(1, "thumbs_up", now, now.Add(time.Minute)); err != ErrVerificationPending {
+        t.Fatalf("expected a new pose refused while pending, got %v", err)
+    }
+
+    StartVerification(2, "touch_nose", now, now.Add(10*time.Minute))
+    second, _ := SubmitVerification(2, "verifications/b.jpg", now)
+
+    queue, err := GetPendingVerifications(nil, 10)
+    if err != nil || len(queue) != 2 || queue[0].ID != v.ID {
+        t.Fatalf("unexpected queue %+v %v", queue, err)
+    }
+    if queue, _ := GetPendingVerifications(&v.ID, 10); len(queue) != 1 || queue[0].ID != second.ID {
+        t.Fatalf("unexpected queue after cursor %+v", queue)
+    }
+
+    reviewer := int64(9)
+    decided, err := DecideVerification(v.ID, true, "ignored", &reviewer, now)
+    if err != nil || decided == nil || decided.Status != "approved" || decided.Reason != "" || decided.SelfieKey != "verifications/a.jpg" {
+        t.Fatalf("approve: %+v %v", decided, err)
+    }
+    if !verified(1) { t.Fatalf("expected the badge set") }
+    if again, _ := DecideVerification(v.ID, false, "", nil, now); again != nil {
+        t.Fatalf("expected a decided request left alone, got %+v", again)
+    }
+    if stored, _ := GetVerification(v.ID); stored.SelfieKey != "" || stored.ReviewedAt == nil || *stored.ReviewerID != reviewer {
+        t.Fatalf("expected selfie key cleared and reviewer kept, got %+v", stored)
+    }
+
+    rejected, _ := DecideVerification(second.ID, false, "Лицо не видно", nil, now)
+    if rejected == nil || rejected.Status != "rejected" || rejected.ReviewerID != nil || verified(2) {
+        t.Fatalf("reject: %+v", rejected)
+    }
+    latest, _ := GetLatestVerification(2)
+    if latest.Reason != "Лицо не видно" {
+        t.Fatalf("expected the reason kept, got %+v", latest)
+    }
+    if u, _ := GetLatestVerification(3); u != nil {
+        t.Fatalf("expected no request, got %+v", u)
+    }
+}
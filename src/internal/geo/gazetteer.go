@@ -0,0 +1,324 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxReverseDistanceKm bounds reverse geocoding: coordinates further than
+// this from any known place are treated as "unknown".
+const MaxReverseDistanceKm = 50.0
+
+// Place is a normalized populated place from the gazetteer.
+type Place struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	Region     string  `json:"region,omitempty"`
+	Country    string  `json:"country"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Population int64   `json:"population"`
+	Timezone   string  `json:"timezone,omitempty"`
+}
+
+// DisplayName returns "City, Region, CC", skipping empty parts.
+func (p Place) DisplayName() string {
+	parts := []string{p.Name}
+	if p.Region != "" && p.Region != p.Name {
+		parts = append(parts, p.Region)
+	}
+	if p.Country != "" {
+		parts = append(parts, p.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type cell struct {
+	lat, lon int
+}
+
+type nameEntry struct {
+	key string
+	idx int
+}
+
+// Gazetteer is an in-memory, read-only place index. It supports reverse
+// lookups through a 1x1 degree grid and name lookups through a sorted
+// key list, so no external service is needed.
+type Gazetteer struct {
+	places []Place
+	grid   map[cell][]int
+	names  []nameEntry
+}
+
+// Default is the gazetteer used by handlers. It is empty until main loads
+// a data file, in which case all lookups simply report "not found".
+var Default = New(nil)
+
+// New builds the indexes for the given places.
+func New(places []Place) *Gazetteer {
+	g := &Gazetteer{places: places, grid: make(map[cell][]int)}
+	for i, p := range places {
+		c := cellOf(p.Latitude, p.Longitude)
+		g.grid[c] = append(g.grid[c], i)
+	}
+	return g
+}
+
+// Len returns the number of loaded places.
+func (g *Gazetteer) Len() int {
+	return len(g.places)
+}
+
+// Load reads a GeoNames "cities" dump (cities500.txt, cities15000.txt, ...)
+// and, optionally, admin1CodesASCII.txt to resolve region names. An empty
+// admin1Path keeps raw admin1 codes as regions.
+func Load(citiesPath, admin1Path string) (*Gazetteer, error) {
+	regions := map[string]string{}
+	if admin1Path != "" {
+		f, err := os.Open(admin1Path)
+		if err != nil {
+			return nil, err
+		}
+		regions, err = ParseAdmin1(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(citiesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, regions)
+}
+
+// ParseAdmin1 reads admin1CodesASCII.txt lines ("US.CA<TAB>California<TAB>...")
+// into a code -> name map.
+func ParseAdmin1(r io.Reader) (map[string]string, error) {
+	regions := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		cols := strings.Split(sc.Text(), "\t")
+		if len(cols) < 2 {
+			continue
+		}
+		regions[cols[0]] = cols[1]
+	}
+	return regions, sc.Err()
+}
+
+// Parse reads GeoNames tab-separated place records and builds a gazetteer.
+// regions maps "CC.admin1" codes to names and may be nil.
+func Parse(r io.Reader, regions map[string]string) (*Gazetteer, error) {
+	var places []Place
+	var alternates [][]string
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cols := strings.Split(text, "\t")
+		if len(cols) < 18 {
+			return nil, fmt.Errorf("geo: line %d: expected at least 18 columns, got %d", line, len(cols))
+		}
+		id, err := strconv.ParseInt(cols[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("geo: line %d: invalid id: %w", line, err)
+		}
+		lat, err := strconv.ParseFloat(cols[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("geo: line %d: invalid latitude: %w", line, err)
+		}
+		lon, err := strconv.ParseFloat(cols[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("geo: line %d: invalid longitude: %w", line, err)
+		}
+		pop, _ := strconv.ParseInt(cols[14], 10, 64)
+
+		region := cols[10]
+		if name, ok := regions[cols[8]+"."+cols[10]]; ok {
+			region = name
+		}
+
+		places = append(places, Place{
+			ID:         id,
+			Name:       cols[1],
+			Region:     region,
+			Country:    cols[8],
+			Latitude:   lat,
+			Longitude:  lon,
+			Population: pop,
+			Timezone:   cols[17],
+		})
+		names := []string{cols[1], cols[2]}
+		if cols[3] != "" {
+			names = append(names, strings.Split(cols[3], ",")...)
+		}
+		alternates = append(alternates, names)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	g := New(places)
+	for i, names := range alternates {
+		seen := make(map[string]bool, len(names))
+		for _, n := range names {
+			key := normalize(n)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			g.names = append(g.names, nameEntry{key: key, idx: i})
+		}
+	}
+	sort.Slice(g.names, func(i, j int) bool { return g.names[i].key < g.names[j].key })
+	return g, nil
+}
+
+// Reverse returns the nearest place within MaxReverseDistanceKm.
+func (g *Gazetteer) Reverse(lat, lon float64) (*Place, bool) {
+	if len(g.places) == 0 {
+		return nil, false
+	}
+	c := cellOf(lat, lon)
+	dLat := int(math.Ceil(MaxReverseDistanceKm / 111.0))
+	dLon := 180
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+		dLon = min(int(math.Ceil(MaxReverseDistanceKm/(111.0*cos))), 180)
+	}
+
+	best := -1
+	bestDist := MaxReverseDistanceKm
+	for i := c.lat - dLat; i <= c.lat+dLat; i++ {
+		for j := c.lon - dLon; j <= c.lon+dLon; j++ {
+			for _, idx := range g.grid[cell{i, wrapLon(j)}] {
+				p := g.places[idx]
+				if d := DistanceKm(lat, lon, p.Latitude, p.Longitude); d <= bestDist {
+					best, bestDist = idx, d
+				}
+			}
+		}
+	}
+	if best < 0 {
+		return nil, false
+	}
+	p := g.places[best]
+	return &p, true
+}
+
+// Forward resolves a place name to its most populous match. The query may
+// be qualified with a country code after a comma, e.g. "Paris, FR".
+func (g *Gazetteer) Forward(query string) (*Place, bool) {
+	name, country := splitCountry(query)
+	key := normalize(name)
+	if key == "" {
+		return nil, false
+	}
+
+	i := sort.Search(len(g.names), func(i int) bool { return g.names[i].key >= key })
+	best := -1
+	for ; i < len(g.names) && g.names[i].key == key; i++ {
+		p := g.places[g.names[i].idx]
+		if country != "" && !strings.EqualFold(p.Country, country) {
+			continue
+		}
+		if best < 0 || p.Population > g.places[best].Population {
+			best = g.names[i].idx
+		}
+	}
+	if best < 0 {
+		return nil, false
+	}
+	p := g.places[best]
+	return &p, true
+}
+
+// Autocomplete returns up to limit places whose name starts with prefix,
+// most populous first.
+func (g *Gazetteer) Autocomplete(prefix string, limit int) []Place {
+	key := normalize(prefix)
+	if key == "" || limit <= 0 {
+		return nil
+	}
+
+	seen := make(map[int]bool)
+	var matches []int
+	i := sort.Search(len(g.names), func(i int) bool { return g.names[i].key >= key })
+	for ; i < len(g.names) && strings.HasPrefix(g.names[i].key, key); i++ {
+		if idx := g.names[i].idx; !seen[idx] {
+			seen[idx] = true
+			matches = append(matches, idx)
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return g.places[matches[a]].Population > g.places[matches[b]].Population
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	out := make([]Place, 0, len(matches))
+	for _, idx := range matches {
+		out = append(out, g.places[idx])
+	}
+	return out
+}
+
+// DistanceKm returns the great-circle distance between two points.
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371.0 // Earth radius in km
+	dLat := (lat2 - lat1) * math.Pi / 180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+	lat1R := lat1 * math.Pi / 180.0
+	lat2R := lat2 * math.Pi / 180.0
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(lat1R)*math.Cos(lat2R)
+	return R * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func cellOf(lat, lon float64) cell {
+	return cell{int(math.Floor(lat)), int(math.Floor(lon))}
+}
+
+func wrapLon(j int) int {
+	for j < -180 {
+		j += 360
+	}
+	for j >= 180 {
+		j -= 360
+	}
+	return j
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func splitCountry(query string) (string, string) {
+	i := strings.LastIndex(query, ",")
+	if i < 0 {
+		return query, ""
+	}
+	cc := strings.TrimSpace(query[i+1:])
+	if len(cc) != 2 {
+		// not a country code, e.g. "Springfield, Illinois" - match by name only
+		return query[:i], ""
+	}
+	return query[:i], cc
+}
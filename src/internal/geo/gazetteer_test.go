@@ -0,0 +1,76 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCities = "2950159\tBerlin\tBerlin\tBerlin,Берлин\t52.52437\t13.41053\tP\tPPLC\tDE\t\t16\t00\t11000\t11000000\t3426354\t\t74\tEurope/Berlin\t2022-01-01\n" +
+	"2988507\tParis\tParis\tParis,Париж\t48.85341\t2.3488\tP\tPPLC\tFR\t\t11\t75\t751\t75056\t2138551\t\t42\tEurope/Paris\t2022-01-01\n" +
+	"4717560\tParis\tParis\t\t33.66094\t-95.55551\tP\tPPLA2\tUS\t\tTX\t277\t\t\t24171\t\t183\tAmerica/Chicago\t2022-01-01\n" +
+	"2867714\tMunich\tMunich\tMünchen,Мюнхен\t48.13743\t11.57549\tP\tPPLA\tDE\t\t02\t091\t09162\t09162000\t1260391\t\t524\tEurope/Berlin\t2022-01-01\n"
+
+const testAdmin1 = "DE.16\tBerlin\tBerlin\t2950157\nFR.11\tÎle-de-France\tIle-de-France\t3012874\nDE.02\tBavaria\tBavaria\t2951839\n"
+
+func loadTest(t *testing.T) *Gazetteer {
+	regions, err := ParseAdmin1(strings.NewReader(testAdmin1))
+	if err != nil {
+		t.Fatalf("admin1: %v", err)
+	}
+	g, err := Parse(strings.NewReader(testCities), regions)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return g
+}
+
+func TestReverse(t *testing.T) {
+	g := loadTest(t)
+
+	p, ok := g.Reverse(52.5, 13.4)
+	if !ok || p.Name != "Berlin" {
+		t.Fatalf("expected Berlin, got %+v", p)
+	}
+	if p.DisplayName() != "Berlin, DE" {
+		t.Fatalf("unexpected display name %q", p.DisplayName())
+	}
+
+	if _, ok := g.Reverse(0, 0); ok {
+		t.Fatalf("expected no place in the middle of the ocean")
+	}
+}
+
+func TestForward(t *testing.T) {
+	g := loadTest(t)
+
+	p, ok := g.Forward("  paris ")
+	if !ok || p.Country != "FR" {
+		t.Fatalf("expected Paris, FR as the most populous match, got %+v", p)
+	}
+	p, ok = g.Forward("Paris, US")
+	if !ok || p.Country != "US" {
+		t.Fatalf("expected Paris, US, got %+v", p)
+	}
+	p, ok = g.Forward("München")
+	if !ok || p.Region != "Bavaria" {
+		t.Fatalf("expected Munich by alternate name, got %+v", p)
+	}
+	if _, ok := g.Forward("Atlantis"); ok {
+		t.Fatalf("expected no match")
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	g := loadTest(t)
+
+	got := g.Autocomplete("par", 10)
+	if len(got) != 2 || got[0].Country != "FR" {
+		t.Fatalf("expected both Paris entries, most populous first, got %+v", got)
+	}
+	if got := g.Autocomplete("Бер", 10); len(got) != 1 || got[0].Name != "Berlin" {
+		t.Fatalf("expected Berlin by cyrillic prefix, got %+v", got)
+	}
+	if got := g.Autocomplete("p", 1); len(got) != 1 {
+		t.Fatalf("expected limit to apply, got %d", len(got))
+	}
+}
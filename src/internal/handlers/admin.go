@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/interests"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/storage"
+	"dating-backend/internal/verification"
+)
+
+// GET /admin/jobs/failed
+// Lists background jobs that ran out of attempts (the dead-letter table),
+// most recent first. Supports optional query parameters:
+// - cursor: next_cursor from the previous page
+// - limit: page size (default 20, max 100)
+// Example response:
+// {
+//	 "items": [{"id": 4, "kind": "match_expiry", "attempts": 5, "max_attempts": 5, "last_error": "...", "failed_at": "..."}],
+//	 "next_cursor": null
+// }
+func GetFailedJobsHandler(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, ok := parsePage(r.URL.Query().Get("cursor"), r.URL.Query().Get("limit"))
+	if !ok {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := data_access.GetDeadJobs(cursor, limit)
+	if err != nil {
+		logging.Log.Errorf("get failed jobs: db error: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	var next *string
+	if len(jobs) == limit {
+		c := strconv.FormatInt(jobs[len(jobs)-1].ID, 10)
+		next = &c
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"items":       jobs,
+		"next_cursor": next,
+	})
+}
+
+// POST /admin/jobs/failed/{id}/retry
+// Moves a dead job back to the queue with a fresh set of attempts. It runs
+// on the next scheduler poll.
+// Example response:
+// {
+//	 "status": "queued",
+//	 "job_id": 12
+// }
+func RetryFailedJobHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/jobs/failed/"), "/retry")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logging.Log.Warnf("retry failed job: invalid id '%s': %v", idStr, err)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	jobID, err := data_access.RequeueDeadJob(id, time.Now())
+	if err != nil {
+		logging.Log.Errorf("retry failed job: db error job=%d: %v", id, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if jobID == 0 {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "queued",
+		"job_id": jobID,
+	})
+}
+
+// GET /admin/messages/{id}/history
+// Returns a message as stored, including the content of a message deleted
+// for everyone, and the versions it had before each edit, oldest first.
+// Example response:
+// {
+//	 "message": {"id": 7, "content": "Hello there!", "edited_at": "..."},
+//	 "edits": [{"content": "Helo", "edited_at": "..."}]
+// }
+func GetMessageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/messages/"), "/history")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logging.Log.Warnf("message history: invalid id '%s': %v", idStr, err)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	// as stored: no participant's view
+	msg, err := data_access.GetMessage(id, 0)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if msg == nil {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	edits, err := data_access.GetMessageEdits(id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": msg,
+		"edits":   edits,
+	})
+}
+
+// GET /admin/verifications
+// The review queue: selfies waiting for a decision, oldest first, with a
+// signed link to the selfie and the user's profile photos to compare it
+// with. Supports "cursor" and "limit" like /admin/jobs/failed.
+// Example response:
+// {
+//	 "items": [{"id": 3, "user_id": 1, "pose": "thumbs_up", "instruction": "...", "status": "pending",
+//	            "selfie_url": "/files/verifications/3?expires=...&sig=...", "photos": [...]}],
+//	 "next_cursor": "3"
+// }
+func GetVerificationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, ok := parsePage(r.URL.Query().Get("cursor"), r.URL.Query().Get("limit"))
+	if !ok {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	items, err := data_access.GetPendingVerifications(cursor, limit)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	userIDs := make([]int64, len(items))
+	for i, v := range items {
+		userIDs[i] = v.UserID
+	}
+	photos, err := data_access.GetPhotosForUsers(userIDs)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	for i := range items {
+		v := &items[i]
+		if pose, ok := verification.PoseByCode(v.Pose); ok {
+			v.Instruction = pose.Instruction
+		}
+		v.SelfieURL = storage.URLs.Sign("/files/verifications/"+strconv.FormatInt(v.ID, 10), now)
+		v.Photos = photos[v.UserID]
+	}
+
+	var next *string
+	if len(items) == limit {
+		c := strconv.FormatInt(items[len(items)-1].ID, 10)
+		next = &c
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"items":       items,
+		"next_cursor": next,
+	})
+}
+
+type VerificationDecisionRequest struct {
+	Approve bool   `json:"approve"`
+	Reason  string `json:"reason,omitempty"` // shown to the user when rejected
+}
+
+// POST /admin/verifications/{id}/decision
+// Approves or rejects a selfie from the review queue. Approval gives the
+// user the photo_verified badge; the selfie is deleted either way.
+// Example request body:
+// {"approve": false, "reason": "Поза не совпадает"}
+// Responds with the decided request; 409 if it was already decided.
+func DecideVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	reviewerID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/verifications/"), "/decision")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req VerificationDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	v, err := decideVerification(r.Context(), id, req.Approve, strings.TrimSpace(req.Reason), &reviewerID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if v == nil {
+		existing, err := data_access.GetVerification(id)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if existing == nil {
+			http.Error(w, "verification not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "verification is not pending", http.StatusConflict)
+		return
+	}
+	writeVerification(w, v)
+}
+
+// GET /admin/interests
+// The interests taxonomy with the labels in every locale.
+// Example response:
+// [{"id": 3, "code": "jazz", "category": "music", "label": "Джаз", "labels": {"en": "Jazz", "ru": "Джаз"}}]
+func GetAdminInterestsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := data_access.GetInterests(interests.DefaultLocale)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	labels, err := data_access.GetInterestLabels()
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		list[i].Labels = labels[list[i].ID]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+type InterestRequest struct {
+	Code     string            `json:"code,omitempty"`     // only when creating
+	Category string            `json:"category,omitempty"` // one of interests.Categories
+	Labels   map[string]string `json:"labels,omitempty"`   // by locale, "" removes one
+}
+
+// validate checks the category and labels of the request; the category is
+// optional when updating.
+func (req *InterestRequest) validate(create bool) (string, bool) {
+	if create && !interests.ValidCode(req.Code) {
+		return "invalid code", false
+	}
+	if (create || req.Category != "") && !interests.ValidCategory(req.Category) {
+		return "invalid category", false
+	}
+	for locale, label := range req.Labels {
+		label = strings.TrimSpace(label)
+		if create && label == "" {
+			delete(req.Labels, locale)
+			continue
+		}
+		if !interests.ValidLocale(locale) || utf8.RuneCountInString(label) > 50 {
+			return "invalid label", false
+		}
+		req.Labels[locale] = label
+	}
+	return "", true
+}
+
+// POST /admin/interests
+// Adds an interest to the taxonomy; 409 if the code is taken.
+// Example request body:
+// {"code": "jazz", "category": "music", "labels": {"ru": "Джаз", "en": "Jazz"}}
+// Responds 201 with the interest.
+func CreateInterestHandler(w http.ResponseWriter, r *http.Request) {
+	var req InterestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if msg, ok := req.validate(true); !ok {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	i, err := data_access.CreateInterest(req.Code, req.Category, req.Labels)
+	if errors.Is(err, data_access.ErrInterestExists) {
+		http.Error(w, "interest exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	i.Labels = req.Labels
+	i.Label = interestLabel(i.Code, i.Labels)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(i)
+}
+
+// PUT /admin/interests/{id}
+// Changes the category of an interest and sets or removes labels; the code
+// can't change. Fields left out are kept.
+// Example request body:
+// {"labels": {"de": "Jazz", "en": ""}}
+// Example response:
+// {"status": "updated"}
+func UpdateInterestHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/admin/interests/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req InterestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if msg, ok := req.validate(false); !ok {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	found, err := data_access.UpdateInterest(id, req.Category, req.Labels)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "interest not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+}
+
+// DELETE /admin/interests/{id}
+// Removes an interest from the taxonomy and from every profile that had it.
+// Example response:
+// {"status": "deleted"}
+func DeleteInterestHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/admin/interests/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := data_access.DeleteInterest(id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "interest not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// interestLabel is the label of an interest in the default locale, as
+// GetInterests picks it.
+func interestLabel(code string, labels map[string]string) string {
+	if l := labels[interests.DefaultLocale]; l != "" {
+		return l
+	}
+	return code
+}
+
+// GET /admin/prompts
+// All prompts, the retired ones ("active": false) included.
+// Example response:
+// [{"id": 1, "text": "Лучший способ провести выходные...", "active": true, "created_at": "..."}]
+func GetAdminPromptsHandler(w http.ResponseWriter, r *http.Request) {
+	prompts, err := data_access.GetPrompts(true)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompts)
+}
+
+type PromptRequest struct {
+	Text   *string `json:"text,omitempty"`
+	Active *bool   `json:"active,omitempty"` // false retires the prompt: answers stay, nobody can pick it anew
+}
+
+// POST /admin/prompts
+// Adds a prompt users can answer.
+// Example request body:
+// {"text": "Лучший способ провести выходные..."}
+// Responds 201 with the prompt.
+func CreatePromptHandler(w http.ResponseWriter, r *http.Request) {
+	var req PromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.Text == nil || !validPromptText(req.Text) {
+		http.Error(w, "invalid text", http.StatusBadRequest)
+		return
+	}
+
+	p, err := data_access.CreatePrompt(*req.Text)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// PUT /admin/prompts/{id}
+// Rewords a prompt, or retires ("active": false) or restores it. Fields
+// left out are kept.
+// Example request body:
+// {"active": false}
+// Responds with the prompt.
+func UpdatePromptHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/admin/prompts/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req PromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.Text != nil && !validPromptText(req.Text) {
+		http.Error(w, "invalid text", http.StatusBadRequest)
+		return
+	}
+
+	p, err := data_access.UpdatePrompt(id, req.Text, req.Active)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if p == nil {
+		http.Error(w, "prompt not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// validPromptText trims a prompt question and checks its length.
+func validPromptText(text *string) bool {
+	*text = strings.TrimSpace(*text)
+	return *text != "" && utf8.RuneCountInString(*text) <= MaxPromptLength
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"dating-backend/internal/attributes"
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/models"
+)
+
+// GET /profile/attributes
+// Describes the optional profile attributes: their kind, allowed values and
+// default visibility. Set them in PUT /me under "attributes".
+// Example response:
+// [
+//	 {"key": "height", "kind": "int", "min": 100, "max": 250, "unit": "cm", "visibility": "public"},
+//	 {"key": "pets", "kind": "enum", "values": ["dog", "cat", ...], "multi": true, "visibility": "public"},
+//	 ...
+// ]
+func GetAttributeSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attributes.Schema)
+}
+
+// parseAttributeUpdate validates the attributes and visibility levels of a
+// profile update. It returns the new values of the attributes sent and the
+// visibility of every attribute touched: the one sent, else the stored one,
+// else the schema default.
+func parseAttributeUpdate(userID int64, values map[string]json.RawMessage, visibility map[string]string) (map[string][]models.AttributeValue, map[string]string, error) {
+	parsed := map[string][]models.AttributeValue{}
+	for key, raw := range values {
+		a, ok := attributes.Lookup(key)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown attribute %q", key)
+		}
+		vals, err := a.Parse(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed[key] = vals
+	}
+	for key, vis := range visibility {
+		if _, ok := attributes.Lookup(key); !ok {
+			return nil, nil, fmt.Errorf("unknown attribute %q", key)
+		}
+		if !attributes.ValidVisibility(vis) {
+			return nil, nil, fmt.Errorf("%s: invalid visibility %q", key, vis)
+		}
+	}
+	if len(parsed) == 0 && len(visibility) == 0 {
+		return parsed, visibility, nil
+	}
+
+	stored, err := data_access.GetAttributes([]int64{userID})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, current := attributes.Profile(stored[userID], func(string) bool { return false })
+	touched := map[string]string{}
+	for key := range parsed {
+		a, _ := attributes.Lookup(key)
+		touched[key] = a.Visibility
+		if vis, ok := current[key]; ok {
+			touched[key] = vis
+		}
+	}
+	for key, vis := range visibility {
+		touched[key] = vis
+	}
+	return parsed, touched, nil
+}
+
+// profileAttributes fills in the attributes of the user's profile that the
+// viewer may see: all of them on the user's own profile, along with their
+// visibility, the "matches" ones to the user's matches, else the public ones.
+func profileAttributes(u *models.User, viewerID int64) error {
+	stored, err := data_access.GetAttributes([]int64{u.ID})
+	if err != nil {
+		return err
+	}
+	if viewerID == u.ID {
+		u.Attributes, u.AttributeVisibility = attributes.Profile(stored[u.ID], func(string) bool { return true })
+		return nil
+	}
+
+	matched := false
+	if viewerID != 0 {
+		ids, err := data_access.GetMatchedUserIDs(u.ID)
+		if err != nil {
+			return err
+		}
+		matched = slices.Contains(ids, viewerID)
+	}
+	u.Attributes, _ = attributes.Profile(stored[u.ID], func(visibility string) bool {
+		return visibility == attributes.Public || (matched && visibility == attributes.Matches)
+	})
+	return nil
+}
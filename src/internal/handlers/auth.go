@@ -3,6 +3,7 @@ package handlers
 import (
 	data_access "dating-backend/internal/data-access"
 	"dating-backend/internal/logging"
+	"dating-backend/internal/metrics"
 	models "dating-backend/internal/models"
 	utils "dating-backend/internal/utils"
 	"encoding/json"
@@ -12,8 +13,14 @@ import (
 	"time"
 )
 
+// MaxSessionsPerUser caps how many devices a user can be logged in on at
+// once; logging in on one more evicts the session refreshed least
+// recently. Zero means no cap.
+var MaxSessionsPerUser = 10
+
 // RegisterHandler handles user registration requests.
-// It expects a JSON body with username, password, bio, and photo_url fields.
+// It expects a JSON body with username, password, and bio fields. Photos
+// are uploaded to /me/photos after logging in.
 // On success, it responds with a success message. On failure, it responds with an error.
 // Method: POST
 // Endpoint: /register
@@ -21,8 +28,7 @@ import (
 // {
 //   "username": "johndoe",
 //   "password": "securepassword",
-//   "bio": "Hello, I'm John!",
-//   "photo_url": "http://example.com/photo.jpg"
+//   "bio": "Hello, I'm John!"
 // }
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -61,13 +67,13 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	newUser.Password = HashPassword
 
 	// Insert into DB new user
-	stmt, err := data_access.DB.Prepare("INSERT INTO users(username, password, bio, photo_url) VALUES(?,?,?,?)")
+	stmt, err := data_access.DB.Prepare("INSERT INTO users(username, password, bio) VALUES(?,?,?)")
 	if err != nil {
 		logging.Log.Errorf("register: db prepare error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	_, err = stmt.Exec(newUser.Username, newUser.Password, newUser.Bio, newUser.PhotoURL)
+	_, err = stmt.Exec(newUser.Username, newUser.Password, newUser.Bio)
 	if err != nil {
 		logging.Log.Errorf("register: db exec error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -135,15 +141,17 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	accessExp := time.Now().Add(15 * time.Minute)
 	refreshExp := time.Now().Add(30 * 24 * time.Hour)
 
-	// Store tokens in DB
-	_, err = data_access.DB.Exec(`INSERT OR REPLACE INTO sessions (user_id, device_id, access_token, refresh_token, access_expires, refresh_expires)
-	                  VALUES (?, ?, ?, ?, ?, ?)`,
-		id, credentials.DeviceID, accessToken, refreshToken, accessExp, refreshExp)
+	// Store tokens in DB, evicting the oldest sessions over the cap
+	evicted, err := data_access.CreateSession(id, credentials.DeviceID, accessToken, refreshToken, accessExp, refreshExp, MaxSessionsPerUser)
 	if err != nil {
 		logging.Log.Errorf("login: db exec error user=%d: %v", id, err)
 		http.Error(w, "DB error", http.StatusInternalServerError)
 		return
 	}
+	if evicted > 0 {
+		logging.Log.Infof("login: evicted %d oldest sessions of user=%d", evicted, id)
+		metrics.SessionsEvicted.Add(evicted)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	resp := map[string]interface{}{
@@ -241,8 +249,7 @@ func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	newExp := time.Now().Add(15 * time.Minute)
 	newRefreshExp := time.Now().Add(30 * 24 * time.Hour)
 
-	_, err = data_access.DB.Exec(`UPDATE sessions SET access_token=?, access_expires=?, refresh_expires=? WHERE user_id = ? AND refresh_token=?`,
-		newAccess, newExp, newRefreshExp, req.UserID, req.RefreshToken)
+	_, err = data_access.RefreshSession(req.UserID, req.RefreshToken, newAccess, newExp, newRefreshExp)
 	if err != nil {
 		logging.Log.Errorf("refresh: db exec error user=%d: %v", req.UserID, err)
 		http.Error(w, "DB error", http.StatusInternalServerError)
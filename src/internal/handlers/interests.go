@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/interests"
+	"dating-backend/internal/models"
+)
+
+// GET /interests?lang=en
+// The interests taxonomy users pick their interests from, by category.
+// Labels are in the "lang" language, else the first one of
+// Accept-Language, falling back to Russian. Pick them in PUT /me with
+// "interest_ids".
+// Example response:
+// [
+//	 {"id": 3, "code": "jazz", "category": "music", "label": "Jazz"},
+//	 {"id": 1, "code": "hiking", "category": "sports", "label": "Hiking"},
+//	 ...
+// ]
+func GetInterestsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := data_access.GetInterests(requestLocale(r))
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// requestLocale is the language labels are shown in.
+func requestLocale(r *http.Request) string {
+	return interests.Locale(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+}
+
+// profileInterests fills in the interests of the user's profile and, for
+// another viewer, those they share with the viewer.
+func profileInterests(u *models.User, viewerID int64, locale string) error {
+	ids := []int64{u.ID}
+	if viewerID != 0 && viewerID != u.ID {
+		ids = append(ids, viewerID)
+	}
+	tags, err := data_access.GetUserInterests(ids, locale)
+	if err != nil {
+		return err
+	}
+	u.Interests = tags[u.ID]
+	if viewerID != u.ID {
+		u.SharedInterests = interests.Shared(tags[viewerID], u.Interests)
+	}
+	return nil
+}
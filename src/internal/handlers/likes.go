@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/realtime"
+	"dating-backend/internal/realtime/protocol"
+)
+
+// BlurLikesInbox hides who liked the user unless they hold the "see_likes"
+// entitlement. Main enables it from configuration.
+var BlurLikesInbox = false
+
+// GET /likes
+// Returns inbound likes the authenticated user hasn't answered yet, newest
+// first. Supports optional query parameters:
+// - cursor: next_cursor from the previous page
+// - limit: page size (default 20, max 100)
+// When BlurLikesInbox is on and the user lacks the "see_likes" entitlement,
+// items are returned with "blurred": true and without identifying fields.
+func GetLikesInboxHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get likes: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	cursor, limit, ok := parsePage(r.URL.Query().Get("cursor"), r.URL.Query().Get("limit"))
+	if !ok {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	items, err := data_access.GetLikesInbox(userID, cursor, limit)
+	if err != nil {
+		logging.Log.Errorf("get likes: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	blur, err := shouldBlurLikes(userID)
+	if err != nil {
+		logging.Log.Errorf("get likes: entitlement error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if blur {
+		for i := range items {
+			items[i].Blurred = true
+			blurProfile(&items[i].User)
+		}
+	}
+
+	var next *string
+	if len(items) == limit {
+		c := strconv.FormatInt(items[len(items)-1].SwipeID, 10)
+		next = &c
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"items":       items,
+		"next_cursor": next,
+	})
+}
+
+// GET /likes/count
+// Returns the number of unanswered inbound likes and how many are unseen.
+// Example response:
+// {
+//	 "total": 12,
+//	 "unseen": 3
+// }
+func GetLikesCountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get likes count: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	total, unseen, err := data_access.CountLikesInbox(userID)
+	if err != nil {
+		logging.Log.Errorf("get likes count: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"total":  total,
+		"unseen": unseen,
+	})
+}
+
+// POST /likes/seen
+// Marks inbound likes as seen. An empty body or an empty list marks all.
+// Example request body:
+// {
+//	 "swipe_ids": [17, 18]
+// }
+func MarkLikesSeenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("mark likes seen: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		SwipeIDs []int64 `json:"swipe_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		logging.Log.Warnf("mark likes seen: decode error user=%d: %v", userID, err)
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if err := data_access.MarkLikesSeen(userID, req.SwipeIDs); err != nil {
+		logging.Log.Errorf("mark likes seen: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// notifyLikeReceived pushes a "like_received" (or "superlike") event with
+// the liker's profile to the target, blurred if the target may not see it.
+func notifyLikeReceived(likerID, targetID int64, action string) {
+	liker, err := data_access.GetProfileSummary(likerID)
+	if err != nil {
+		return
+	}
+
+	blur, err := shouldBlurLikes(targetID)
+	if err != nil {
+		return
+	}
+	if blur {
+		blurProfile(liker)
+	}
+
+	event := protocol.LikeEvent{Action: action, Blurred: blur, User: liker}
+	if action == "superlike" {
+		realtime.ChatHub.SendToUser(targetID, protocol.SuperlikeEvent(event))
+		return
+	}
+	realtime.ChatHub.SendToUser(targetID, event)
+}
+
+func shouldBlurLikes(userID int64) (bool, error) {
+	if !BlurLikesInbox {
+		return false, nil
+	}
+	entitled, err := data_access.HasEntitlement(userID, "see_likes")
+	if err != nil {
+		return false, err
+	}
+	return !entitled, nil
+}
+
+// blurProfile strips identifying fields. The photo goes too: its URL is
+// public and permanent, so clients render a placeholder instead.
+func blurProfile(p *models.ProfileSummary) {
+	p.ID = 0
+	p.Name = ""
+	p.PhotoURL = ""
+}
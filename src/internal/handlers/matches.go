@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/realtime"
+	"dating-backend/internal/realtime/protocol"
+)
+
+// GET /matches
+// Returns the authenticated user's active matches, newest first. Supports an
+// optional query parameter:
+// - state: "new" for matches without messages yet, "active" for matches
+//   with a conversation; omitted returns both
+// Example response:
+// [
+//	 {"id": 3, "chat_id": 7, "source": "like", "status": "active", "created_at": "...",
+//	  "user": {"id": 5, "name": "Anna", "age": 27, "photo_url": "..."}, "has_messages": false}
+// ]
+func GetMatchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get matches: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	if state != "" && state != "new" && state != "active" {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := data_access.GetMatchesForUser(userID, state)
+	if err != nil {
+		logging.Log.Errorf("get matches: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
+
+// DELETE /matches/{id}
+// Unmatches the pair. The chat disappears from both users' chat lists and
+// the other user receives an "unmatched" event. Neither of them shows up in
+// the other's discovery again.
+func UnmatchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("unmatch: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/matches/")
+	matchID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logging.Log.Warnf("unmatch: invalid id '%s': %v", idStr, err)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	match, err := data_access.Unmatch(matchID, userID)
+	if err != nil {
+		logging.Log.Errorf("unmatch: db error user=%d match=%d: %v", userID, matchID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if match == nil {
+		http.Error(w, "match not found", http.StatusNotFound)
+		return
+	}
+
+	realtime.ChatHub.SendToUser(match.User.ID, protocol.UnmatchedEvent{
+		MatchID: match.ID,
+		ChatID:  match.ChatID,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// RematchExpired lets a pair whose match expired match again. When false
+// an expired match is never revived. Main sets it from configuration.
+var RematchExpired = true
+
+// createMatch opens (or reuses) the pair's chat, records the match and, if
+// it is new, sends a "match" event to both users. action is the swipe that
+// completed the match; the match counts as a superlike one if either side
+// superliked. It returns nil if the pair's match expired and may not be
+// revived.
+func createMatch(userID, targetID int64, action string) (*models.Match, error) {
+	source := "like"
+	if action == "superlike" {
+		source = "superlike"
+	} else {
+		theirs, err := data_access.GetSwipeAction(targetID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if theirs == "superlike" {
+			source = "superlike"
+		}
+	}
+
+	_, chatID, err := data_access.CreateOrGetChat(userID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	match, created, err := data_access.CreateMatch(userID, targetID, chatID, source, RematchExpired)
+	if err != nil {
+		return nil, err
+	}
+	if match.Status != "active" {
+		return nil, nil
+	}
+
+	if created {
+		event := protocol.MatchEvent{
+			MatchID:   match.ID,
+			ChatID:    match.ChatID,
+			UserID:    targetID,
+			Source:    match.Source,
+			CreatedAt: match.CreatedAt,
+		}
+		realtime.ChatHub.SendToUser(userID, event)
+		event.UserID = userID
+		realtime.ChatHub.SendToUser(targetID, event)
+
+		// The comments sent with the likes open the chat, the earlier like's
+		// first
+		seedChat(match.ChatID, targetID, userID)
+		seedChat(match.ChatID, userID, targetID)
+	}
+	return match, nil
+}
+
+// seedChat posts the comment the sender left with their like, if any, as
+// their message to the receiver. The comment is used up, so a match that is
+// reactivated later doesn't post it again.
+func seedChat(chatID, senderID, receiverID int64) {
+	comment, err := data_access.TakeLikeComment(senderID, receiverID)
+	if err != nil || comment == "" {
+		return
+	}
+	msg := models.Message{ChatID: chatID, SenderID: senderID, Content: comment}
+	sendMessage(&msg)
+}
@@ -2,28 +2,44 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	data_access "dating-backend/internal/data-access"
 	"dating-backend/internal/logging"
 	middleware "dating-backend/internal/middleware"
 	models "dating-backend/internal/models"
 	"dating-backend/internal/realtime"
+	"dating-backend/internal/realtime/protocol"
 )
 
+// MaxMessageLength is the longest message content accepted, in characters.
+const MaxMessageLength = 4000
+
+// EditWindow is how long after sending a message its sender can edit it.
+var EditWindow = 15 * time.Minute
+
 // SendMessageHandler handles sending a message from the authenticated user
-// to another user. It ensures a chat exists between the users, saves the
-// message, and notifies the receiver via WebSocket if connected.
-// Expects a JSON body with filled "receiver_id" and "content" fields in Message model.
+// to the other person in a chat. It saves the message and notifies the
+// receiver via WebSocket if connected.
+// Expects a JSON body with filled "chat_id" and "content" fields in Message model.
+// The receiver is taken from the chat; "receiver_id" is ignored. Sending to
+// a chat the user isn't in, or whose match ended, is 403.
+// An optional "client_id" makes retries safe: resending a message with a
+// client_id already used returns the stored message with 200 instead of
+// creating a new one. "attachment_ids" sends files uploaded through
+// POST /uploads; the content may then be empty.
 // Example request body:
 // {
-//     "receiver_id": 42,
 //     "content": "Hello there!",
-//     "chat_id": 0,
-//     "sender_id": 0
+//     "chat_id": 7,
+//     "sender_id": 0,
+//     "client_id": "3f1c2a9e",
+//     "attachment_ids": [12]
 // }
 func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.UserIDFromContext(r.Context())
@@ -40,34 +56,94 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if msg.ChatID == 0 || msg.ReceiverID == 0 || msg.Content == "" {
-		logging.Log.Warnf("send message: missing fields from user=%d receiver=%d chat=%d", userID, msg.ReceiverID, msg.ChatID)
-		http.Error(w, "missing fields", http.StatusBadRequest)
+	msg.SenderID = userID
+	if reason := validateMessage(&msg); reason != "" {
+		logging.Log.Warnf("send message: %s from user=%d chat=%d", reason, userID, msg.ChatID)
+		http.Error(w, reason, http.StatusBadRequest)
 		return
 	}
-	msg.SenderID = userID
 
-	var msgId int64
-	if msgId, err = data_access.SaveMessage(&msg); err != nil {
-		logging.Log.Errorf("send message: save error chat=%d sender=%d receiver=%d: %v", msg.ChatID, msg.SenderID, msg.ReceiverID, err)
+	created, err := sendMessage(&msg)
+	if errors.Is(err, errNotParticipant) {
+		http.Error(w, "not a participant of this chat", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, data_access.ErrInvalidAttachments) {
+		http.Error(w, "invalid attachments", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
 		http.Error(w, "failed to save", http.StatusInternalServerError)
 		return
 	}
-	msg.ID = msgId
-	msg.CreatedAt = time.Now()
-
-	realtime.ChatHub.SendToUser(msg.ReceiverID, map[string]interface{}{
-		"type":		"message",
-		"id":		msgId,
-		"chat_id":	msg.ChatID,
-		"user_id":	userID,
-		"content":	msg.Content,
-	})
 
-	w.WriteHeader(http.StatusCreated)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
 	json.NewEncoder(w).Encode(msg)
 }
 
+// validateMessage checks a message before it is saved and returns why it
+// is rejected, or "" if it is fine. REST and WebSocket sends share it.
+func validateMessage(msg *models.Message) string {
+	if msg.ChatID == 0 || (msg.Content == "" && len(msg.AttachmentIDs) == 0) {
+		return "missing fields"
+	}
+	if len(msg.AttachmentIDs) > maxAttachments {
+		return "too many attachments"
+	}
+	if utf8.RuneCountInString(msg.Content) > MaxMessageLength {
+		return "message too long"
+	}
+	return ""
+}
+
+// errNotParticipant is returned by sendMessage when the sender isn't in
+// the chat or the chat is closed.
+var errNotParticipant = errors.New("not a chat participant")
+
+// sendMessage saves a validated message and pushes it to the receiver, the
+// other person in the chat. A resend with a known client id isn't pushed
+// again; created is false and msg holds the stored message.
+func sendMessage(msg *models.Message) (created bool, err error) {
+	peerID, err := data_access.GetChatPeer(msg.ChatID, msg.SenderID)
+	if err != nil {
+		return false, err
+	}
+	if peerID == 0 {
+		logging.Log.Warnf("send message: user=%d not in chat=%d", msg.SenderID, msg.ChatID)
+		return false, errNotParticipant
+	}
+	msg.ReceiverID = peerID
+
+	created, err = data_access.SaveMessage(msg)
+	if errors.Is(err, data_access.ErrInvalidAttachments) {
+		logging.Log.Warnf("send message: invalid attachments %v chat=%d sender=%d", msg.AttachmentIDs, msg.ChatID, msg.SenderID)
+		return false, err
+	}
+	if err != nil {
+		logging.Log.Errorf("send message: save error chat=%d sender=%d receiver=%d: %v", msg.ChatID, msg.SenderID, msg.ReceiverID, err)
+		return false, err
+	}
+	msgs := []models.Message{*msg}
+	if err := loadAttachments(msgs); err != nil {
+		logging.Log.Errorf("send message: attachments error message=%d: %v", msg.ID, err)
+	}
+	msg.Attachments = msgs[0].Attachments
+	if !created {
+		return false, nil
+	}
+
+	realtime.ChatHub.SendToUser(msg.ReceiverID, protocol.MessageEvent{
+		ID:          msg.ID,
+		ChatID:      msg.ChatID,
+		UserID:      msg.SenderID,
+		Content:     msg.Content,
+		Attachments: msg.Attachments,
+	})
+	return true, nil
+}
+
 // GetChatsHandler retrieves all chats for the authenticated user.
 // Each chat includes the latest message and unread count.
 func GetChatsHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,13 +164,21 @@ func GetChatsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetChatMessagesHandler retrieves messages for a specific chat.
-// The chat ID is taken from the URL path.
+// The chat ID is taken from the URL path. Messages the authenticated user
+// deleted for themselves are left out; messages deleted for everyone come
+// as tombstones with "deleted_at" and empty content.
 // Supports optional query parameters:
 // - limit: maximum number of messages to return (default 50, max 200)
 // - before_id: fetch messages with IDs less than this value
 // - after_id: fetch messages with IDs greater than this value
 // Example: GET /chat/messages/{chatId}?limit=100&before_id=500
 func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	idStr := strings.TrimPrefix(r.URL.Path, "/chat/messages/")
 	chatId, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
@@ -128,7 +212,10 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	msgs, err := data_access.GetMessagesForChat(chatId, beforeID, afterID, limit)
+	msgs, err := data_access.GetMessagesForChat(chatId, userID, beforeID, afterID, limit)
+	if err == nil {
+		err = loadAttachments(msgs)
+	}
 	if err != nil {
 		logging.Log.Errorf("get chat messages: db error chat=%d: %v", chatId, err)
 		http.Error(w, "failed to fetch messages", http.StatusInternalServerError)
@@ -138,10 +225,13 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(msgs)
 }
 
-// MarkChatMessagesAsReadHandler marks all messages in a chat as read for the
-// authenticated user.
-// The chat ID is taken from the URL path.
-// Example: POST /chat/read
+// MarkChatMessagesAsReadHandler marks all messages the authenticated user
+// received in a chat as read and tells the sender, unless the user hides
+// read receipts.
+// Example request body:
+// {
+//     "chat_id": 42
+// }
 func MarkChatMessagesAsReadHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.UserIDFromContext(r.Context())
 	if err != nil {
@@ -152,7 +242,6 @@ func MarkChatMessagesAsReadHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		ChatId int64 `json:"chat_id"`
-		ReceiverID int64 `json:"receiver_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logging.Log.Warnf("mark chat read: decode error: %v", err)
@@ -160,30 +249,45 @@ func MarkChatMessagesAsReadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := data_access.MarkMessagesAsReadForChat(req.ChatId, userID)
+	hidden, err := data_access.ReadReceiptsHidden(userID)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	msgs, err := data_access.MarkMessagesAsReadForChat(req.ChatId, userID, now, !hidden)
 	if err != nil {
 		logging.Log.Errorf("mark chat read: db error chat=%d user=%d: %v", req.ChatId, userID, err)
 		http.Error(w, "failed to set messages", http.StatusInternalServerError)
 		return
 	}
 
-	realtime.ChatHub.SendToUser(req.ReceiverID, map[string]interface{}{
-		"type":       "read_chat",
-		"chat_id":    req.ChatId,
-		"user_id":    userID,
-	})
+	if !hidden {
+		notified := map[int64]bool{}
+		for _, m := range msgs {
+			if notified[m.SenderID] {
+				continue
+			}
+			notified[m.SenderID] = true
+			realtime.ChatHub.SendToUser(m.SenderID, protocol.ReadChatEvent{
+				ChatID: req.ChatId,
+				UserID: userID,
+				ReadAt: now,
+			})
+		}
+	}
 
-	json.NewEncoder(w).Encode(res)
+	json.NewEncoder(w).Encode(true)
 }
 
 type MarkMsgReadRequest struct {
 	MessageIDs []int64 `json:"message_ids"`
-	ChatId    int64    `json:"chat_id"`
-	ReceiverID int64   `json:"receiver_id"`
 }
 
 // MarkMessagesReadHandler marks messages as read based on provided message IDs.
 // Expects a JSON body with a "message_ids" field containing an array of int64 IDs.
+// Only messages the authenticated user received are marked; their senders
+// get a read_messages event per chat unless the user hides read receipts.
 func MarkMessagesReadHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.UserIDFromContext(r.Context())
 	if err != nil {
@@ -204,19 +308,211 @@ func MarkMessagesReadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = data_access.MarkMessagesAsRead(req.MessageIDs)
+	hidden, err := data_access.ReadReceiptsHidden(userID)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	msgs, err := data_access.MarkMessagesAsRead(userID, req.MessageIDs, now, !hidden)
 	if err != nil {
 		logging.Log.Errorf("mark messages read: db error: %v", err)
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
 
-	realtime.ChatHub.SendToUser(req.ReceiverID, map[string]interface{}{
-		"type":       "read_messages",
-		"chat_id":    req.ChatId,
-		"user_id":    userID,
-		"message_id": req.MessageIDs,
-	})
+	if !hidden {
+		// one event per chat, with the ids read in it
+		events := map[int64]*protocol.ReadMessagesEvent{}
+		senders := map[int64]int64{}
+		var chats []int64
+		for _, m := range msgs {
+			ev, ok := events[m.ChatID]
+			if !ok {
+				ev = &protocol.ReadMessagesEvent{ChatID: m.ChatID, UserID: userID, ReadAt: now}
+				events[m.ChatID] = ev
+				senders[m.ChatID] = m.SenderID
+				chats = append(chats, m.ChatID)
+			}
+			ev.MessageIDs = append(ev.MessageIDs, m.ID)
+		}
+		for _, chatID := range chats {
+			realtime.ChatHub.SendToUser(senders[chatID], *events[chatID])
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// markDelivered records that userID's device received the message and
+// tells its sender. Only the receiver of a message can mark it, once.
+func markDelivered(userID, messageID int64) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	msgs, err := data_access.MarkMessagesDelivered(userID, []int64{messageID}, now)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		realtime.ChatHub.SendToUser(m.SenderID, protocol.DeliveredEvent{
+			ChatID:      m.ChatID,
+			UserID:      userID,
+			MessageID:   m.ID,
+			DeliveredAt: now,
+		})
+	}
+	return nil
+}
+
+// PATCH /messages/{id}
+// Replaces the content of a message the authenticated user sent, up to
+// EditWindow after sending it. The previous version is kept for
+// moderation and both participants get a message_edited event.
+// Example request body:
+// {
+//     "content": "Hello there!"
+// }
+func EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("edit message: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/messages/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logging.Log.Warnf("edit message: invalid id '%s': %v", idStr, err)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logging.Log.Warnf("edit message: decode error: %v", err)
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := data_access.GetMessage(id, userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if msg == nil || msg.SenderID != userID || msg.DeletedAt != nil {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	if time.Since(msg.CreatedAt) > EditWindow {
+		logging.Log.Warnf("edit message: window expired user=%d message=%d", userID, id)
+		http.Error(w, "edit window expired", http.StatusConflict)
+		return
+	}
+	msg.Content = req.Content
+	if reason := validateMessage(msg); reason != "" {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	updated, err := data_access.EditMessage(id, msg.Content, now)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	msg.EditedAt = &now
+
+	event := protocol.MessageEditedEvent{
+		ID:       msg.ID,
+		ChatID:   msg.ChatID,
+		UserID:   msg.SenderID,
+		Content:  msg.Content,
+		EditedAt: now,
+	}
+	realtime.ChatHub.SendToUser(msg.ReceiverID, event)
+	realtime.ChatHub.SendToUser(msg.SenderID, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// DELETE /messages/{id}?for=me|everyone
+// Deletes a message. "me" (the default) hides it from the authenticated
+// user only and works for both participants. "everyone" unsends it: only
+// the sender may do that, and the message stays in the chat as a
+// tombstone. The participants who lose the message get a message_deleted
+// event.
+func DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("delete message: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/messages/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logging.Log.Warnf("delete message: invalid id '%s': %v", idStr, err)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	forEveryone := false
+	switch r.URL.Query().Get("for") {
+	case "", "me":
+	case "everyone":
+		forEveryone = true
+	default:
+		http.Error(w, "for must be me or everyone", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := data_access.GetMessage(id, userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if msg == nil || (msg.SenderID != userID && msg.ReceiverID != userID) {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	if forEveryone && msg.SenderID != userID {
+		http.Error(w, "only the sender can delete for everyone", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	event := protocol.MessageDeletedEvent{
+		ID:          msg.ID,
+		ChatID:      msg.ChatID,
+		UserID:      userID,
+		ForEveryone: forEveryone,
+		DeletedAt:   now,
+	}
+	if forEveryone {
+		deleted, err := data_access.DeleteMessage(id, now)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if deleted {
+			realtime.ChatHub.SendToUser(msg.ReceiverID, event)
+			realtime.ChatHub.SendToUser(msg.SenderID, event)
+		}
+	} else {
+		if err := data_access.DeleteMessageForUser(id, userID, now); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		realtime.ChatHub.SendToUser(userID, event)
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"ok"}`))
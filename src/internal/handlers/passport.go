@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/geo"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+)
+
+const (
+	defaultPassportDuration = 7 * 24 * time.Hour
+	maxPassportDuration     = 30 * 24 * time.Hour
+)
+
+type SetPassportRequest struct {
+	City      *string  `json:"city,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Hours     *int     `json:"hours,omitempty"` // how long the passport stays active
+}
+
+// PUT /me/passport
+// Sets a temporary search location by coordinates or by city name (resolved
+// through the gazetteer). While it is active, discovery searches around it;
+// the home location is kept for other users.
+// Example request body:
+// {
+//	 "city": "Berlin",
+//	 "latitude": 52.52,
+//	 "longitude": 13.405,
+//	 "hours": 72
+// }
+func SetPassportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("set passport: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SetPassportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logging.Log.Warnf("set passport: decode error user=%d: %v", userID, err)
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var p models.Passport
+	switch {
+	case req.Latitude != nil && req.Longitude != nil:
+		if !validCoordinates(*req.Latitude, *req.Longitude) {
+			logging.Log.Warnf("set passport: invalid coordinates user=%d lat=%f lon=%f", userID, *req.Latitude, *req.Longitude)
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+		p.Latitude, p.Longitude = *req.Latitude, *req.Longitude
+		if req.City != nil {
+			p.City = strings.TrimSpace(*req.City)
+		}
+		if p.City == "" {
+			if place, ok := geo.Default.Reverse(p.Latitude, p.Longitude); ok {
+				p.City = place.DisplayName()
+			} else {
+				p.City = fmt.Sprintf("%.2f, %.2f", p.Latitude, p.Longitude)
+			}
+		}
+	case req.City != nil:
+		place, ok := geo.Default.Forward(*req.City)
+		if !ok {
+			logging.Log.Warnf("set passport: unknown city '%s' user=%d", *req.City, userID)
+			http.Error(w, "unknown city", http.StatusBadRequest)
+			return
+		}
+		p.City = place.DisplayName()
+		p.Latitude, p.Longitude = place.Latitude, place.Longitude
+	default:
+		logging.Log.Warnf("set passport: missing location user=%d", userID)
+		http.Error(w, "city or latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	duration := defaultPassportDuration
+	if req.Hours != nil {
+		duration = time.Duration(*req.Hours) * time.Hour
+		if duration <= 0 || duration > maxPassportDuration {
+			http.Error(w, "invalid hours", http.StatusBadRequest)
+			return
+		}
+	}
+
+	p.ExpiresAt = time.Now().Add(duration)
+
+	if err := data_access.SetPassport(userID, &p); err != nil {
+		logging.Log.Errorf("set passport: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	p.CreatedAt = time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// GET /me/passport
+// Returns the active passport or null when the user is at home.
+func GetPassportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get passport: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	p, err := data_access.GetActivePassport(userID)
+	if err != nil {
+		logging.Log.Errorf("get passport: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// DELETE /me/passport
+// Ends travel mode; discovery falls back to the usual location.
+func ClearPassportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("clear passport: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := data_access.ClearPassport(userID); err != nil {
+		logging.Log.Errorf("clear passport: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
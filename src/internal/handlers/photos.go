@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/media"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/storage"
+	"dating-backend/internal/utils"
+)
+
+// MaxPhotos is how many photos a profile gallery holds.
+var MaxPhotos = 6
+
+// photoFileName matches the names of stored photo sizes,
+// "<random key>_<size>.jpg".
+var photoFileName = regexp.MustCompile(`^([A-Za-z0-9_-]+)_([a-z]+)\.jpg$`)
+
+// GET /me/photos
+// Returns the user's gallery in order; the first photo is the primary one.
+// Example response:
+// [
+//	 {"id": 4, "position": 0, "primary": true, "width": 1280, "height": 960,
+//	  "urls": {"small": "/files/photos/..._small.jpg", "medium": "...", "large": "..."}, "created_at": "..."}
+// ]
+func GetMyPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeGallery(w, userID)
+}
+
+// POST /me/photos
+// Adds a photo to the end of the user's gallery; the first photo becomes
+// the primary one. Expects a multipart form with "file": a JPEG, PNG or GIF
+// image up to 10 MB. The photo is turned upright and stored re-encoded in
+// the sizes of models.PhotoVariants, so none of its metadata, such as the
+// place it was taken at, is kept. The gallery holds up to MaxPhotos photos.
+// Example response (201):
+// {"id": 5, "position": 1, "primary": false, "width": 960, "height": 1280, "urls": {...}, "created_at": "..."}
+func UploadPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("upload photo: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxSize[media.Image]+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		logging.Log.Warnf("upload photo: invalid form user=%d: %v", userID, err)
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > media.MaxSize[media.Image] {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// don't decode anything for a full gallery; AddPhoto checks again
+	photos, err := data_access.GetPhotos(userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if len(photos) >= MaxPhotos {
+		http.Error(w, "at most "+strconv.Itoa(MaxPhotos)+" photos", http.StatusConflict)
+		return
+	}
+
+	mime, kind, ok := media.Sniff(data[:min(len(data), media.SniffLen)])
+	if !ok || kind != media.Image {
+		logging.Log.Warnf("upload photo: rejected type %s user=%d", mime, userID)
+		http.Error(w, "unsupported file type", http.StatusUnsupportedMediaType)
+		return
+	}
+	img, err := media.Decode(data)
+	switch {
+	case errors.Is(err, media.ErrUnsupported):
+		http.Error(w, "unsupported image format", http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, media.ErrTooLarge):
+		http.Error(w, "image dimensions too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		logging.Log.Warnf("upload photo: undecodable image user=%d: %v", userID, err)
+		http.Error(w, "invalid image", http.StatusBadRequest)
+		return
+	}
+	orientation := media.Orientation(data)
+
+	p := models.Photo{
+		Key:    "photos/" + utils.GenerateToken(15),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+	if orientation >= 5 {
+		p.Width, p.Height = p.Height, p.Width
+	}
+
+	ctx := r.Context()
+	for variant, size := range models.PhotoVariants {
+		out, err := media.EncodeJPEG(media.Orient(media.Resize(img, size), orientation), 85)
+		if err == nil {
+			err = storage.Default.Put(ctx, models.PhotoBlobKey(p.Key, variant), bytes.NewReader(out), int64(len(out)), "image/jpeg")
+		}
+		if err != nil {
+			logging.Log.Errorf("upload photo: storing %s error user=%d: %v", variant, userID, err)
+			deletePhotoBlobs(ctx, p.Key)
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = data_access.AddPhoto(userID, &p, MaxPhotos)
+	if err != nil {
+		deletePhotoBlobs(ctx, p.Key)
+		if errors.Is(err, data_access.ErrTooManyPhotos) {
+			http.Error(w, "at most "+strconv.Itoa(MaxPhotos)+" photos", http.StatusConflict)
+			return
+		}
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	p.FillURLs()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+type ReorderPhotosRequest struct {
+	PhotoIDs []int64 `json:"photo_ids"`
+}
+
+// PUT /me/photos/order
+// Puts the gallery in a new order; the first photo becomes the primary
+// one. Every photo of the gallery must be listed once.
+// Example request body:
+// {"photo_ids": [5, 4, 7]}
+// Responds with the reordered gallery, like GET /me/photos.
+func ReorderPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req ReorderPhotosRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := data_access.ReorderPhotos(userID, req.PhotoIDs)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "photo_ids must list every photo of the gallery once", http.StatusBadRequest)
+		return
+	}
+	writeGallery(w, userID)
+}
+
+// PUT /me/photos/{id}/primary
+// Makes a photo the primary one by moving it to the front of the gallery.
+// Responds with the reordered gallery, like GET /me/photos.
+func SetPrimaryPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/me/photos/"), "/primary")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := data_access.SetPrimaryPhoto(userID, id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "photo not found", http.StatusNotFound)
+		return
+	}
+	writeGallery(w, userID)
+}
+
+// DELETE /me/photos/{id}
+// Removes a photo and its files. When the primary photo is removed, the
+// next one takes its place. Responds with the remaining gallery, like
+// GET /me/photos.
+func DeletePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	idStr := strings.TrimPrefix(r.URL.Path, "/me/photos/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	p, err := data_access.DeletePhoto(userID, id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if p == nil {
+		http.Error(w, "photo not found", http.StatusNotFound)
+		return
+	}
+	deletePhotoBlobs(r.Context(), p.Key)
+	writeGallery(w, userID)
+}
+
+// GET /files/photos/{name}
+// Serves one size of a gallery photo. Profiles are visible to every user,
+// so the URLs need no signature; their keys are random and they never
+// change, so clients and proxies may cache them for good.
+func ServePhotoFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/files/photos/")
+	m := photoFileName.FindStringSubmatch(name)
+	if m == nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := models.PhotoVariants[m[2]]; !ok {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	key := "photos/" + m[1]
+	exists, err := data_access.PhotoExists(key)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := storage.Default.Open(r.Context(), models.PhotoBlobKey(key, m[2]))
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Log.Errorf("serve photo: storage error key=%s: %v", key, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, f)
+}
+
+// writeGallery responds with the user's gallery.
+func writeGallery(w http.ResponseWriter, userID int64) {
+	photos, err := data_access.GetPhotos(userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if photos == nil {
+		photos = []models.Photo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photos)
+}
+
+// deletePhotoBlobs removes the stored sizes of a photo.
+func deletePhotoBlobs(ctx context.Context, key string) {
+	for variant := range models.PhotoVariants {
+		if err := storage.Default.Delete(ctx, models.PhotoBlobKey(key, variant)); err != nil {
+			logging.Log.Errorf("delete blob %s: %v", models.PhotoBlobKey(key, variant), err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"dating-backend/internal/geo"
+)
+
+// GET /places/autocomplete
+// Suggests places from the offline gazetteer by name prefix, most populous
+// first. Supports query parameters:
+// - q: name prefix (required)
+// - limit: maximum number of places (default 10, max 50)
+// Example: GET /places/autocomplete?q=ber&limit=5
+func PlacesAutocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 50 {
+			limit = parsed
+		}
+	}
+
+	places := geo.Default.Autocomplete(q, limit)
+	if places == nil {
+		places = []geo.Place{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(places)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/realtime"
+	"dating-backend/internal/realtime/protocol"
+)
+
+// maxPresenceIDs caps the ids of one GET /presence request.
+const maxPresenceIDs = 100
+
+// GET /presence?ids=1,2,3
+// Returns whether each user is online now and when they were last seen.
+// Users who hide their status are reported offline without last_seen.
+// Unknown ids are left out.
+// Example response:
+// [
+//	 {"user_id": 1, "online": true, "last_seen": "2025-03-10T12:00:00Z"},
+//	 {"user_id": 2, "online": false}
+// ]
+func GetPresenceHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get presence: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var ids []int64
+	for _, s := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			logging.Log.Warnf("get presence: invalid id '%s' user=%d", s, userID)
+			http.Error(w, "invalid ids", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 || len(ids) > maxPresenceIDs {
+		http.Error(w, "ids must list 1 to "+strconv.Itoa(maxPresenceIDs)+" users", http.StatusBadRequest)
+		return
+	}
+
+	presence, err := data_access.GetPresence(ids)
+	if err != nil {
+		logging.Log.Errorf("get presence: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	online, err := realtime.ChatHub.Online(r.Context(), ids)
+	if err != nil {
+		logging.Log.Errorf("get presence: presence lookup error user=%d: %v", userID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range presence {
+		p := &presence[i]
+		if p.Hidden && p.UserID != userID {
+			p.LastSeen = nil
+			continue
+		}
+		p.Online = online[p.UserID]
+	}
+	if presence == nil {
+		presence = []models.Presence{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presence)
+}
+
+// NotifyPresence tells the user's matches that the user came online or went
+// offline, unless the user hides their status. Main hooks it to the hub.
+func NotifyPresence(userID int64, online bool) {
+	p, err := data_access.GetPresence([]int64{userID})
+	if err != nil || len(p) == 0 || p[0].Hidden {
+		return
+	}
+	sendPresence(userID, online)
+}
+
+// sendPresence pushes a presence event about userID to their matches.
+func sendPresence(userID int64, online bool) {
+	matched, err := data_access.GetMatchedUserIDs(userID)
+	if err != nil {
+		return
+	}
+	event := protocol.PresenceEvent{UserID: userID, Online: online}
+	if !online {
+		now := time.Now().UTC().Truncate(time.Second)
+		event.LastSeen = &now
+	}
+	for _, id := range matched {
+		realtime.ChatHub.SendEphemeral(id, event)
+	}
+}
@@ -2,14 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/geo"
+	"dating-backend/internal/interests"
 	"dating-backend/internal/logging"
 	middleware "dating-backend/internal/middleware"
 	"dating-backend/internal/models"
+	"dating-backend/internal/realtime"
 	"dating-backend/internal/utils"
 )
 
@@ -21,7 +27,12 @@ import (
 //	 "username": "johndoe",
 //	 "name": "John Doe",
 //	 "bio": "Hello!",
-//	 "photo_url": "http://example.com/photo.jpg",
+//	 "photo_url": "/files/photos/..._medium.jpg",
+//	 "photos": [{"id": 4, "position": 0, "primary": true, "urls": {...}, ...}],
+//	 "attributes": {"height": 180, "religion": "agnostic", "pets": ["dog"]},
+//	 "attribute_visibility": {"height": "public", "religion": "matches", "pets": "public"},
+//	 "interests": [{"id": 3, "code": "jazz", "category": "music", "label": "Джаз"}],
+//	 "prompts": [{"id": 5, "prompt_id": 2, "question": "Лучший способ провести выходные...", "answer": "Горы"}],
 //	 ...
 // }
 func GetMyProfileHandler(w http.ResponseWriter, r *http.Request) {
@@ -39,6 +50,23 @@ func GetMyProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if u.Photos, err = data_access.GetPhotos(userID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profileAttributes(u, userID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profileInterests(u, userID, requestLocale(r)); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profilePrompts(u); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
 	u.Password = "" // Hide password
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(u)
@@ -52,10 +80,17 @@ func GetMyProfileHandler(w http.ResponseWriter, r *http.Request) {
 //	 "username": "janedoe",
 //	 "name": "Jane Doe",
 //	 "bio": "Hi there!",
-//	 "photo_url": "http://example.com/photo2.jpg",
+//	 "photo_url": "/files/photos/..._medium.jpg",
+//	 "photos": [{"id": 7, "position": 0, "primary": true, "urls": {...}, ...}],
+//	 "attributes": {"height": 170, "smoking": "never"},
+//	 "interests": [{"id": 1, "code": "hiking", ...}, {"id": 3, "code": "jazz", ...}],
+//	 "shared_interests": [{"id": 3, "code": "jazz", "category": "music", "label": "Джаз"}],
 //	 ...
 // }
+// Attributes visible to matches only are shown to the user's matches.
+// Interests are labelled as in GET /interests.
 func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID, _ := middleware.UserIDFromContext(r.Context())
 	idStr := strings.TrimPrefix(r.URL.Path, "/user/")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
@@ -70,9 +105,28 @@ func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "user not found", http.StatusNotFound)
 		return
 	}
+	if u.Photos, err = data_access.GetPhotos(id); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profileAttributes(u, viewerID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profileInterests(u, viewerID, requestLocale(r)); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profilePrompts(u); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
 
 	u.Age = utils.GetAge(&u.Birthday.Time)
 	u.Birthday = nil // Hide birthday
+	if u.HideOnline {
+		u.LastActive = ""
+	}
 	u.Password = ""
 	u.Longitude = nil // Hide precise location
 	u.Latitude = nil
@@ -87,20 +141,35 @@ type UpdateProfileRequest struct {
 	Birthday		*models.SQLiteDate	`json:"birthday,omitempty"`
 	InterestedIn 	*string  `json:"interested_in,omitempty"`
 	Bio          	*string  `json:"bio,omitempty"`
-	PhotoURL     	*string  `json:"photo_url,omitempty"`
 	Location     	*string  `json:"location,omitempty"`
 	Latitude     	*float64 `json:"latitude,omitempty"`
 	Longitude    	*float64 `json:"longitude,omitempty"`
+	Timezone     	*string  `json:"timezone,omitempty"`
+	HideOnline   	*bool    `json:"hide_online,omitempty"`
+	HideReadReceipts *bool   `json:"hide_read_receipts,omitempty"`
+	Attributes   	map[string]json.RawMessage `json:"attributes,omitempty"`
+	AttributeVisibility map[string]string `json:"attribute_visibility,omitempty"`
+	InterestIDs  	*[]int64 `json:"interest_ids,omitempty"`
+	Prompts      	*[]models.PromptAnswer `json:"prompts,omitempty"`
 }
 
 // PUT /me
 // Updates the profile of the authenticated user.
-// Expects a JSON body with fields to update.
+// Expects a JSON body with fields to update. Photos are managed through
+// /me/photos; photo_url follows the primary photo. "attributes" sets the
+// optional fields described by GET /profile/attributes, null clearing one;
+// "attribute_visibility" sets who sees them: "public", "matches" or
+// "hidden". Attributes left out keep their values. "interest_ids" replaces
+// the user's interests, picked from GET /interests. "prompts" replaces the
+// user's prompt cards: up to three answers to prompts from GET /prompts.
 // Example request body:
 // {
 //	 "name": "New Name",
 //	 "bio": "Updated bio",
-//	 "photo_url": "http://example.com/newphoto.jpg",
+//	 "attributes": {"height": 180, "pets": ["dog", "cat"], "smoking": null},
+//	 "attribute_visibility": {"height": "matches"},
+//	 "interest_ids": [1, 3],
+//	 "prompts": [{"prompt_id": 2, "answer": "Горы и хороший кофе"}],
 //	 ...
 // }
 func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
@@ -124,6 +193,20 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Prompts != nil {
+		if reason := validatePromptAnswers(*req.Prompts); reason != "" {
+			logging.Log.Warnf("update profile: %s user=%d", reason, userID)
+			http.Error(w, reason, http.StatusBadRequest)
+			return
+		}
+	}
+	attrValues, attrVisibility, err := parseAttributeUpdate(userID, req.Attributes, req.AttributeVisibility)
+	if err != nil {
+		logging.Log.Warnf("update profile: invalid attributes user=%d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	u, err := data_access.GetUserByID(userID)
 	if err != nil {
 		logging.Log.Warnf("update profile: user not found id=%d: %v", userID, err)
@@ -147,12 +230,24 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	if req.Bio != nil {
 		u.Bio = *req.Bio
 	}
-	if req.PhotoURL != nil {
-		u.PhotoURL = *req.PhotoURL
-	}
 	if req.Location != nil {
 		u.Location = req.Location
 	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			logging.Log.Warnf("update profile: invalid timezone '%s' user=%d", *req.Timezone, userID)
+			http.Error(w, "invalid timezone", http.StatusBadRequest)
+			return
+		}
+		u.Timezone = *req.Timezone
+	}
+	hideChanged := req.HideOnline != nil && *req.HideOnline != u.HideOnline
+	if req.HideOnline != nil {
+		u.HideOnline = *req.HideOnline
+	}
+	if req.HideReadReceipts != nil {
+		u.HideReadReceipts = *req.HideReadReceipts
+	}
 	var doUpdateUserLocationIndex bool = false
 	if req.Latitude != nil && *req.Latitude != 0.0 {
 		if u.Latitude != req.Latitude {
@@ -167,16 +262,87 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		u.Longitude = req.Longitude
 	}
 
-	if err := data_access.UpdateUser(u); err != nil {
+	// Keep location consistent with the gazetteer: coordinates are
+	// reverse-geocoded into a normalized place name, a bare place name is
+	// resolved into coordinates.
+	if doUpdateUserLocationIndex {
+		if u.Latitude == nil || u.Longitude == nil || !validCoordinates(*u.Latitude, *u.Longitude) {
+			logging.Log.Warnf("update profile: invalid coordinates user=%d", userID)
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+		if place, ok := geo.Default.Reverse(*u.Latitude, *u.Longitude); ok {
+			name := place.DisplayName()
+			u.Location = &name
+			if req.Timezone == nil && place.Timezone != "" {
+				u.Timezone = place.Timezone
+			}
+		}
+	} else if req.Location != nil && geo.Default.Len() > 0 {
+		place, ok := geo.Default.Forward(*req.Location)
+		if !ok {
+			logging.Log.Warnf("update profile: unknown location '%s' user=%d", *req.Location, userID)
+			http.Error(w, "unknown location", http.StatusBadRequest)
+			return
+		}
+		name := place.DisplayName()
+		u.Location = &name
+		u.Latitude = &place.Latitude
+		u.Longitude = &place.Longitude
+		if req.Timezone == nil && place.Timezone != "" {
+			u.Timezone = place.Timezone
+		}
+		doUpdateUserLocationIndex = true
+	}
+
+	err = data_access.UpdateProfile(&models.ProfileUpdate{
+		User:                u,
+		InterestIDs:         req.InterestIDs,
+		InterestLimit:       interests.MaxPerUser,
+		Prompts:             req.Prompts,
+		AttributeValues:     attrValues,
+		AttributeVisibility: attrVisibility,
+	})
+	switch {
+	case errors.Is(err, data_access.ErrTooManyInterests):
+		http.Error(w, fmt.Sprintf("at most %d interests", interests.MaxPerUser), http.StatusBadRequest)
+		return
+	case errors.Is(err, data_access.ErrUnknownInterest):
+		http.Error(w, "unknown interest", http.StatusBadRequest)
+		return
+	case errors.Is(err, data_access.ErrUnknownPrompt):
+		http.Error(w, "unknown prompt", http.StatusBadRequest)
+		return
+	case err != nil:
 		logging.Log.Errorf("update profile: db error user=%d: %v", u.ID, err)
 		http.Error(w, "failed to update", http.StatusInternalServerError)
 		return
 	}
+	if err := profileAttributes(u, u.ID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profileInterests(u, u.ID, requestLocale(r)); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := profilePrompts(u); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
 	
 	if doUpdateUserLocationIndex {
 		_ = data_access.UpdateUserLocationIndex(u.ID, *u.Latitude, *u.Longitude)
 	}
 
+	// Matches see the user go offline when they start hiding, and come back
+	// online when they stop
+	if hideChanged {
+		if online, err := realtime.ChatHub.Online(r.Context(), []int64{u.ID}); err == nil && online[u.ID] {
+			sendPresence(u.ID, !u.HideOnline)
+		}
+	}
+
 	u.Password = ""
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(u)
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/models"
+)
+
+// MaxPrompts is how many prompt cards a profile shows.
+var MaxPrompts = 3
+
+const (
+	// MaxPromptLength bounds prompt questions and answers, in characters.
+	MaxPromptLength = 300
+	// MaxLikeCommentLength bounds the comment sent with a like.
+	MaxLikeCommentLength = 500
+)
+
+// GET /prompts
+// The prompts users can answer on their profile. Pick up to MaxPrompts in
+// PUT /me with "prompts".
+// Example response:
+// [
+//	 {"id": 1, "text": "Лучший способ провести выходные...", "active": true, "created_at": "..."},
+//	 ...
+// ]
+func GetPromptsHandler(w http.ResponseWriter, r *http.Request) {
+	prompts, err := data_access.GetPrompts(false)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompts)
+}
+
+// profilePrompts fills in the prompt cards of the user's profile.
+func profilePrompts(u *models.User) error {
+	prompts, err := data_access.GetPromptAnswers([]int64{u.ID})
+	if err != nil {
+		return err
+	}
+	u.Prompts = prompts[u.ID]
+	return nil
+}
+
+// validatePromptAnswers trims the answers of a profile update and returns
+// why they are rejected, or "" if they are fine.
+func validatePromptAnswers(answers []models.PromptAnswer) string {
+	if len(answers) > MaxPrompts {
+		return "too many prompts"
+	}
+	seen := map[int64]bool{}
+	for i := range answers {
+		a := &answers[i]
+		a.Answer = strings.TrimSpace(a.Answer)
+		if a.Answer == "" || utf8.RuneCountInString(a.Answer) > MaxPromptLength {
+			return "invalid prompt answer"
+		}
+		if seen[a.PromptID] {
+			return "prompt answered twice"
+		}
+		seen[a.PromptID] = true
+	}
+	return ""
+}
+
+// validateLikedContent checks the content and comment a like is sent with
+// and returns why they are rejected, or "" if they are fine. Only likes on
+// a prompt card or photo of the target carry a comment.
+func validateLikedContent(req *SwipeRequest) (string, error) {
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Content == nil {
+		if req.Comment != "" {
+			return "comment needs content", nil
+		}
+		return "", nil
+	}
+	if req.Action == "dislike" {
+		return "only likes carry content", nil
+	}
+	if utf8.RuneCountInString(req.Comment) > MaxLikeCommentLength {
+		return "comment too long", nil
+	}
+	ok, err := data_access.HasContent(req.TargetID, *req.Content)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "unknown content", nil
+	}
+	return "", nil
+}
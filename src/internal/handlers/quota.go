@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/quota"
+)
+
+// GET /me/quota
+// Reports the remaining uses of every rate-limited action.
+// Example response:
+// {
+//	 "like": {"kind": "like", "limit": 100, "used": 3, "remaining": 97, "reset_at": "2024-01-02T00:00:00+03:00"},
+//	 "swipe": {"kind": "swipe", "limit": 60, "used": 0, "remaining": 60}
+// }
+func GetMyQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get quota: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	statuses, err := quota.Default.All(userID, userLocation(userID))
+	if err != nil {
+		logging.Log.Errorf("get quota: store error user=%d: %v", userID, err)
+		http.Error(w, "quota error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// allowQuota consumes one use of kind for the user. When the quota is
+// exhausted it replies with 429 and a typed error body and returns false.
+func allowQuota(w http.ResponseWriter, kind string, userID int64) bool {
+	_, err := quota.Default.Allow(kind, userID, userLocation(userID))
+	if err == nil {
+		return true
+	}
+
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		logging.Log.Errorf("quota: store error kind=%s user=%d: %v", kind, userID, err)
+		http.Error(w, "quota error", http.StatusInternalServerError)
+		return false
+	}
+
+	logging.Log.Warnf("quota: %s quota exceeded user=%d", kind, userID)
+	retryAfter := int(math.Ceil(time.Until(exceeded.ResetAt).Seconds()))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":    "quota_exceeded",
+		"kind":     exceeded.Kind,
+		"limit":    exceeded.Limit,
+		"reset_at": exceeded.ResetAt,
+	})
+	return false
+}
+
+// refundQuota gives back a use taken by allowQuota when the action it paid
+// for failed afterwards.
+func refundQuota(kind string, userID int64) {
+	if err := quota.Default.Refund(kind, userID); err != nil {
+		logging.Log.Errorf("quota: refund error kind=%s user=%d: %v", kind, userID, err)
+	}
+}
+
+// userLocation returns the user's timezone for daily quotas, UTC if unknown.
+func userLocation(userID int64) *time.Location {
+	tz, err := data_access.GetUserTimezone(userID)
+	if err != nil || tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+)
+
+// GET /me/swipes
+// Returns the authenticated user's own swipes, newest first, with a profile
+// summary of each target. Supports optional query parameters:
+// - action: "like", "dislike" or "superlike"
+// - cursor: next_cursor from the previous page
+// - limit: page size (default 20, max 100)
+// Example response:
+// {
+//	 "items": [{"swipe_id": 17, "action": "like", "created_at": "...", "user": {"id": 5, "name": "Anna", "age": 27, "photo_url": "..."}}],
+//	 "next_cursor": "17"
+// }
+func GetMySwipesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get my swipes: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	action := q.Get("action")
+	if action != "" && action != "like" && action != "dislike" && action != "superlike" {
+		http.Error(w, "invalid action", http.StatusBadRequest)
+		return
+	}
+
+	cursor, limit, ok := parsePage(q.Get("cursor"), q.Get("limit"))
+	if !ok {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	items, err := data_access.GetSwipeHistory(userID, action, cursor, limit)
+	if err != nil {
+		logging.Log.Errorf("get my swipes: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	var next *string
+	if len(items) == limit {
+		c := strconv.FormatInt(items[len(items)-1].SwipeID, 10)
+		next = &c
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"items":       items,
+		"next_cursor": next,
+	})
+}
+
+// DELETE /me/swipes/{targetId}
+// Undoes a dislike so the person can reappear in discovery. Likes can't be
+// removed this way.
+func UndoDislikeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("undo dislike: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/me/swipes/")
+	targetID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logging.Log.Warnf("undo dislike: invalid id '%s': %v", idStr, err)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := data_access.DeleteDislike(userID, targetID)
+	if err != nil {
+		logging.Log.Errorf("undo dislike: db error user=%d target=%d: %v", userID, targetID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "dislike not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// statsWindows are the periods reported by GetMySwipeStatsHandler; zero
+// means all time.
+var statsWindows = []struct {
+	name string
+	d    time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"all", 0},
+}
+
+// GET /me/swipes/stats
+// Reports likes sent and received, matches and match rate for the last
+// 24 hours, 7 days, 30 days and all time.
+func GetMySwipeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("get swipe stats: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	stats := make([]*models.SwipeStats, 0, len(statsWindows))
+	for _, win := range statsWindows {
+		since := time.Time{}
+		if win.d > 0 {
+			since = now.Add(-win.d)
+		}
+		st, err := data_access.GetSwipeStats(userID, since)
+		if err != nil {
+			logging.Log.Errorf("get swipe stats: db error user=%d: %v", userID, err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		st.Window = win.name
+		stats = append(stats, st)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// parsePage reads keyset pagination parameters: an optional numeric cursor
+// and a limit (default 20, max 100).
+func parsePage(cursorStr, limitStr string) (*int64, int, bool) {
+	limit := 20
+	if limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if cursorStr == "" {
+		return nil, limit, true
+	}
+	cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+	if err != nil {
+		return nil, 0, false
+	}
+	return &cursor, limit, true
+}
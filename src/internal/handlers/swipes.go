@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"dating-backend/internal/attributes"
+	"dating-backend/internal/interests"
 	data_access "dating-backend/internal/data-access"
 	"dating-backend/internal/logging"
 	middleware "dating-backend/internal/middleware"
 	"dating-backend/internal/models"
-	"dating-backend/internal/realtime"
 
 	"github.com/gorilla/schema"
 )
@@ -18,17 +20,34 @@ var decoder = schema.NewDecoder()
 
 type SwipeRequest struct {
 	TargetID int64  `json:"target_id"`
-	Action   string `json:"action"` // "like" или "dislike"
+	Action   string `json:"action"` // "like", "dislike" или "superlike"
+	// Content is the prompt card or photo of the target the like is for;
+	// Comment is sent with it.
+	Content *models.LikedContent `json:"content,omitempty"`
+	Comment string               `json:"comment,omitempty"`
 }
 
-// SwipeHandler processes a swipe action (like or dislike) from the authenticated user.
+// RewindWindow is how long after a swipe it can still be undone.
+var RewindWindow = 5 * time.Minute
+
+// SwipeHandler processes a swipe action (like, dislike or superlike) from the authenticated user.
 // It updates the swipe record in the database and checks for mutual likes to create a match.
-// On a mutual like, it creates a chat and sends real-time notifications to both users.
-// If no match occurs, it simply acknowledges the swipe action.
+// On a mutual like, it records a match with its chat and sends a typed "match" event to both users.
+// If no match occurs, it simply acknowledges the swipe action; likes and
+// superlikes additionally notify the target in real time.
+// When a quota is exhausted it responds 429 with a "quota_exceeded" body
+// carrying the quota kind and reset time.
+// Repeating the swipe already on record is acknowledged without using
+// quota or notifying anyone.
+// A like can point at one of the target's prompt cards or photos and carry
+// a comment, shown in the target's likes inbox and sent as the first chat
+// message on a match.
 // Expected JSON request body:
 // {
 //     "target_id": <int64>,
-//     "action": "like" | "dislike"
+//     "action": "like" | "dislike" | "superlike",
+//     "content": {"type": "prompt" | "photo", "id": <int64>},
+//     "comment": "Тоже обожаю горы!"
 // }
 func SwipeHandler(w http.ResponseWriter, r *http.Request) {
 	userID, authErr := middleware.UserIDFromContext(r.Context())
@@ -50,60 +69,160 @@ func SwipeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Action != "like" && req.Action != "dislike" {
+	if req.Action != "like" && req.Action != "dislike" && req.Action != "superlike" {
 		logging.Log.Warnf("swipe: invalid action '%s' from user %d", req.Action, userID)
 		http.Error(w, "invalid action", http.StatusBadRequest)
 		return
 	}
 
+	reason, err := validateLikedContent(&req)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if reason != "" {
+		logging.Log.Warnf("swipe: %s from user=%d target=%d", reason, userID, req.TargetID)
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	// Repeating the swipe already on record changes nothing: it costs no
+	// quota and notifies nobody again
+	current, err := data_access.GetSwipeAction(userID, req.TargetID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if current == req.Action {
+		json.NewEncoder(w).Encode(map[string]string{"status": req.Action})
+		return
+	}
+
+	// Rate limits: every swipe counts towards "swipe", likes and superlikes
+	// also towards their own quota. Uses taken are given back if the swipe
+	// doesn't go through, so a rejected or failed swipe costs nothing.
+	kinds := []string{"swipe"}
+	if req.Action != "dislike" {
+		kinds = append(kinds, req.Action)
+	}
+	refund := func(kinds []string) {
+		for _, kind := range kinds {
+			refundQuota(kind, userID)
+		}
+	}
+	for i, kind := range kinds {
+		if !allowQuota(w, kind, userID) {
+			refund(kinds[:i])
+			return
+		}
+	}
+
 	// Put or update the swipe record
-	if err := data_access.UpsertSwipe(userID, req.TargetID, req.Action); err != nil {
+	if err := data_access.UpsertLike(userID, req.TargetID, req.Action, req.Content, req.Comment); err != nil {
 		logging.Log.Errorf("swipe: upsert error user=%d target=%d action=%s: %v", userID, req.TargetID, req.Action, err)
+		refund(kinds)
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
 	}
 
 	// Check for mutual likes
-	if req.Action == "like" {
+	if req.Action == "like" || req.Action == "superlike" {
 		mutual, err := data_access.HasLiked(req.TargetID, userID)
 
 			if err == nil && mutual {
-
-				isNew, chatID, err := data_access.CreateOrGetChat(userID, req.TargetID)
-				if isNew{
-					var msgMatch = models.Message{
-							ChatID:  chatID,
-							Content: "It's a match! 🎉",
-						}
-						_,_ = data_access.SaveMessage(&msgMatch)
-
-					if err == nil {
-						// Send real-time notifications to both users
-						msg := map[string]any{
-							"type":    "match",
-							"content": "It's a match! 🎉",
-							"chat_id": chatID,
-							"user_id": req.TargetID,
-						}
-						realtime.ChatHub.SendToUser(userID, msg)
-						msg["user_id"] = userID
-						realtime.ChatHub.SendToUser(req.TargetID, msg)
-					}
+				match, err := createMatch(userID, req.TargetID, req.Action)
+				if err != nil {
+					logging.Log.Errorf("swipe: create match error user=%d target=%d: %v", userID, req.TargetID, err)
+					http.Error(w, "db error", http.StatusInternalServerError)
+					return
 				}
-			json.NewEncoder(w).Encode(map[string]string{
-				"status": "match",
-				"content": fmt.Sprintf("It's a match with user %d!", req.TargetID),
-			})
+				if match == nil {
+					// the pair's match expired for good
+					json.NewEncoder(w).Encode(map[string]string{"status": req.Action})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]any{
+					"status":   "match",
+					"match_id": match.ID,
+					"chat_id":  match.ChatID,
+					"content":  fmt.Sprintf("It's a match with user %d!", req.TargetID),
+				})
+
+				return
+			}
+
+		notifyLikeReceived(userID, req.TargetID, req.Action)
+	}
 
+	json.NewEncoder(w).Encode(map[string]string{"status": req.Action})
+}
+
+// RewindHandler undoes the authenticated user's most recent swipe if it was
+// made within RewindWindow and did not produce a match. The target becomes
+// eligible for discovery again. Rewinds are limited by the "rewind" quota.
+// Example response:
+// {
+//     "status": "rewound",
+//     "target_id": 42,
+//     "action": "dislike"
+// }
+func RewindHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("rewind: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	last, err := data_access.GetLastSwipe(userID)
+	if err != nil {
+		logging.Log.Errorf("rewind: db error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if last == nil || time.Since(last.CreatedAt) > RewindWindow {
+		logging.Log.Warnf("rewind: nothing to rewind user=%d", userID)
+		http.Error(w, "nothing to rewind", http.StatusConflict)
+		return
+	}
+
+	if last.Action != "dislike" {
+		mutual, err := data_access.HasLiked(last.TargetID, userID)
+		if err != nil {
+			logging.Log.Errorf("rewind: db error user=%d: %v", userID, err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if mutual {
+			logging.Log.Warnf("rewind: last swipe of user=%d produced a match", userID)
+			http.Error(w, "swipe produced a match", http.StatusConflict)
 			return
 		}
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"status": req.Action})
+	if !allowQuota(w, "rewind", userID) {
+		return
+	}
+
+	if err := data_access.DeleteSwipe(last.ID); err != nil {
+		logging.Log.Errorf("rewind: delete error user=%d swipe=%d: %v", userID, last.ID, err)
+		refundQuota("rewind", userID)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":    "rewound",
+		"target_id": last.TargetID,
+		"action":    last.Action,
+	})
 }
 
 // GetMyFollowersHandler retrieves the list of users who have liked the authenticated user.
 // It responds with a JSON array of user profiles.
+// When the likes inbox is blurred for the user it responds 403; GET /likes
+// serves the blurred list.
 func GetMyFollowersHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.UserIDFromContext(r.Context())
 	if err != nil {
@@ -112,6 +231,17 @@ func GetMyFollowersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blur, err := shouldBlurLikes(userID)
+	if err != nil {
+		logging.Log.Errorf("get followers: entitlement error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if blur {
+		http.Error(w, "see_likes entitlement required", http.StatusForbidden)
+		return
+	}
+
 	profiles, err := data_access.GetUserFollowers(userID)
 	if err != nil {
 		logging.Log.Errorf("get followers: db error user=%d: %v", userID, err)
@@ -128,6 +258,14 @@ func GetMyFollowersHandler(w http.ResponseWriter, r *http.Request) {
 // It responds with a JSON array of user profiles.
 // Expected query parameters can include those defined in SimpleFilter.
 // For example: ?min_age=18&max_age=30&gender=female
+// If the user has an active passport, its coordinates replace latitude/longitude.
+// Attribute dealbreakers exclude candidates, preferences rank them higher:
+// ?dealbreaker=smoking:never&prefer=height:170-190&prefer=pets:dog,cat
+// Only public attributes are matched. Candidates who superliked the user
+// come first, then the rest, each by descending "rank_score"; the next
+// page takes last_seen_id and last_seen_score.
+// Candidates sharing more interests with the user rank higher too; their
+// "shared_interests" are labelled in "lang" like GET /interests.
 func GetSwipeCandidatesHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.UserIDFromContext(r.Context())
 	if err != nil {
@@ -142,6 +280,32 @@ func GetSwipeCandidatesHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid query", http.StatusBadRequest)
 		return
 	}
+	for _, list := range []struct {
+		conds []string
+		soft  bool
+	}{{filter.Dealbreakers, false}, {filter.Preferences, true}} {
+		for _, s := range list.conds {
+			c, err := attributes.ParseCondition(s, list.soft)
+			if err != nil {
+				logging.Log.Warnf("get swipe candidates: invalid attribute condition user=%d: %v", userID, err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.Conditions = append(filter.Conditions, c)
+		}
+	}
+	filter.Locale = interests.Locale(filter.Locale, r.Header.Get("Accept-Language"))
+
+	// An active passport overrides the client-supplied search location
+	passport, err := data_access.GetActivePassport(userID)
+	if err != nil {
+		logging.Log.Errorf("get swipe candidates: passport lookup error user=%d: %v", userID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if passport != nil {
+		passport.Apply(&filter)
+	}
 
 	profiles, err := data_access.GetSwipeCandidates(userID, &filter)
 	if err != nil {
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/media"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/storage"
+	"dating-backend/internal/utils"
+)
+
+const (
+	// thumbnailSize bounds the longer side of image thumbnails, in pixels.
+	thumbnailSize = 320
+	// maxAttachments is how many files one message may carry.
+	maxAttachments = 10
+)
+
+// POST /uploads
+// Uploads an image or a voice note into a chat, to be sent with a message
+// through "attachment_ids". Expects a multipart form with "chat_id" and
+// "file". The type is detected from the content, whatever the client
+// declares: JPEG, PNG, GIF and WebP images up to 10 MB, Ogg, MP3, M4A,
+// WebM and WAV voice notes up to 5 MB. Only the participants of an open
+// chat can upload into it. Uploads not sent within a day are removed.
+// Example response (201):
+// {
+//	 "id": 12, "chat_id": 3, "uploader_id": 1, "kind": "image", "mime": "image/jpeg",
+//	 "size": 48211, "width": 1280, "height": 960, "created_at": "...",
+//	 "url": "/files/attachments/12?expires=...&sig=...",
+//	 "thumbnail_url": "/files/attachments/12/thumb?expires=...&sig=..."
+// }
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		logging.Log.Warnf("upload: unauthorized: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var limit int64
+	for _, n := range media.MaxSize {
+		limit = max(limit, n)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		logging.Log.Warnf("upload: invalid form user=%d: %v", userID, err)
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid chat_id", http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	ok, err := data_access.IsChatParticipant(chatID, userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		logging.Log.Warnf("upload: user=%d not in chat=%d", userID, chatID)
+		http.Error(w, "not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	mime, kind, ok := media.Sniff(data[:min(len(data), media.SniffLen)])
+	if !ok {
+		logging.Log.Warnf("upload: rejected type %s user=%d", mime, userID)
+		http.Error(w, "unsupported file type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if int64(len(data)) > media.MaxSize[kind] {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	a := models.Attachment{
+		ChatID:     chatID,
+		UploaderID: userID,
+		Kind:       string(kind),
+		MIME:       mime,
+		Size:       int64(len(data)),
+	}
+	base := "attachments/" + utils.GenerateToken(15)
+	a.Key = base + media.Ext(mime)
+
+	var thumb []byte
+	if kind == media.Image {
+		img, err := media.Decode(data)
+		switch {
+		case err == nil:
+			a.Width, a.Height = img.Bounds().Dx(), img.Bounds().Dy()
+			if thumb, err = media.EncodeJPEG(media.Resize(img, thumbnailSize), 80); err != nil {
+				logging.Log.Errorf("upload: thumbnail error user=%d: %v", userID, err)
+				thumb = nil
+			}
+		case errors.Is(err, media.ErrUnsupported):
+			// stored as is, without a thumbnail
+		default:
+			logging.Log.Warnf("upload: undecodable image user=%d: %v", userID, err)
+			http.Error(w, "invalid image", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if err := storage.Default.Put(ctx, a.Key, bytes.NewReader(data), a.Size, a.MIME); err != nil {
+		logging.Log.Errorf("upload: storage error user=%d: %v", userID, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	if thumb != nil {
+		a.ThumbKey = base + "_thumb.jpg"
+		if err := storage.Default.Put(ctx, a.ThumbKey, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+			logging.Log.Errorf("upload: thumbnail storage error user=%d: %v", userID, err)
+			a.ThumbKey = ""
+		}
+	}
+	if err := data_access.CreateAttachment(&a); err != nil {
+		deleteBlobs(ctx, &a)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	signAttachment(&a, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// GET /attachments/{id}
+// Returns an attachment with fresh download URLs, for clients whose URLs
+// expired. Only the participants of the chat can see it.
+func GetAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	idStr := strings.TrimPrefix(r.URL.Path, "/attachments/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	a, err := data_access.GetAttachment(id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	// unsent uploads are only visible to the uploader
+	if a == nil || (a.MessageID == nil && a.UploaderID != userID) {
+		http.Error(w, "attachment not found", http.StatusNotFound)
+		return
+	}
+	if ok, err := data_access.IsChatParticipant(a.ChatID, userID); err != nil || !ok {
+		http.Error(w, "attachment not found", http.StatusNotFound)
+		return
+	}
+
+	signAttachment(a, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// GET /files/attachments/{id}[/thumb]?expires=...&sig=...
+// Serves an attachment, or its thumbnail, to whoever holds a signed URL
+// that hasn't expired. No access token is needed, so the URLs work in
+// <img> and <audio> elements.
+func ServeAttachmentFileHandler(w http.ResponseWriter, r *http.Request) {
+	if !storage.URLs.Verify(r.URL.Path, r.URL.Query(), time.Now()) {
+		http.Error(w, "invalid or expired link", http.StatusForbidden)
+		return
+	}
+	idStr, wantThumb := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/files/attachments/"), "/thumb")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	a, err := data_access.GetAttachment(id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if a == nil || (wantThumb && a.ThumbKey == "") {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	key, contentType := a.Key, a.MIME
+	if wantThumb {
+		key, contentType = a.ThumbKey, "image/jpeg"
+	}
+
+	f, err := storage.Default.Open(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Log.Errorf("serve file: storage error attachment=%d: %v", id, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if !wantThumb {
+		w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	}
+	io.Copy(w, f)
+}
+
+// signAttachment fills in the download URLs of an attachment.
+func signAttachment(a *models.Attachment, now time.Time) {
+	path := "/files/attachments/" + strconv.FormatInt(a.ID, 10)
+	a.URL = storage.URLs.Sign(path, now)
+	if a.ThumbKey != "" {
+		a.ThumbnailURL = storage.URLs.Sign(path+"/thumb", now)
+	}
+}
+
+// loadAttachments fills in the attachments of the messages, with signed
+// URLs. Tombstones of messages deleted for everyone get none.
+func loadAttachments(msgs []models.Message) error {
+	ids := make([]int64, 0, len(msgs))
+	for _, m := range msgs {
+		if m.DeletedAt == nil {
+			ids = append(ids, m.ID)
+		}
+	}
+	byMessage, err := data_access.GetAttachmentsForMessages(ids)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range msgs {
+		atts := byMessage[msgs[i].ID]
+		for j := range atts {
+			signAttachment(&atts[j], now)
+		}
+		msgs[i].Attachments = atts
+	}
+	return nil
+}
+
+func deleteBlobs(ctx context.Context, a *models.Attachment) {
+	for _, key := range []string{a.Key, a.ThumbKey} {
+		if key == "" {
+			continue
+		}
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			logging.Log.Errorf("delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// PruneOrphanUploads removes uploads older than cutoff that were never
+// sent with a message, and their files. It returns how many it removed.
+func PruneOrphanUploads(ctx context.Context, cutoff time.Time) (int, error) {
+	orphans, err := data_access.GetOrphanAttachments(cutoff, 500)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i := range orphans {
+		deleted, err := data_access.DeleteOrphanAttachment(orphans[i].ID)
+		if err != nil {
+			return removed, err
+		}
+		if deleted {
+			deleteBlobs(ctx, &orphans[i])
+			removed++
+		}
+	}
+	return removed, nil
+}
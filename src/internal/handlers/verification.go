@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/media"
+	middleware "dating-backend/internal/middleware"
+	"dating-backend/internal/models"
+	"dating-backend/internal/storage"
+	"dating-backend/internal/utils"
+	"dating-backend/internal/verification"
+)
+
+// VerificationTTL is how long the user has to send a selfie in the pose
+// they were handed.
+var VerificationTTL = 10 * time.Minute
+
+// selfieSize bounds the longer side of stored selfies, in pixels.
+const selfieSize = 1280
+
+// POST /me/verification/start
+// Hands the user a random pose for a verification selfie, to be sent
+// within VerificationTTL. A pose handed out before is replaced. The user
+// needs at least one profile photo; 409 while an earlier selfie waits for
+// a decision.
+// Example response (201):
+// {
+//	 "id": 3, "user_id": 1, "pose": "thumbs_up", "instruction": "Покажите большой палец вверх",
+//	 "status": "requested", "created_at": "...", "expires_at": "..."
+// }
+func StartVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	photos, err := data_access.GetPhotos(userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if len(photos) == 0 {
+		http.Error(w, "add a profile photo first", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	pose := verification.RandomPose()
+	v, err := data_access.StartVerification(userID, pose.Code, now, now.Add(VerificationTTL))
+	if errors.Is(err, data_access.ErrVerificationPending) {
+		http.Error(w, "a selfie is already waiting for review", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	v.Instruction = pose.Instruction
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+// POST /me/verification
+// Sends the verification selfie, taken in the pose from
+// POST /me/verification/start. Expects a multipart form with "file": a
+// JPEG, PNG or GIF image up to 10 MB. The selfie is decided by the
+// verification engine or queued for moderators; approval sets
+// "photo_verified" on the profile. The selfie is deleted once decided.
+// Example response:
+// {"id": 3, "user_id": 1, "pose": "thumbs_up", "status": "pending", "submitted_at": "...", ...}
+func SubmitVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxSize[media.Image]+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > media.MaxSize[media.Image] {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, kind, ok := media.Sniff(data[:min(len(data), media.SniffLen)]); !ok || kind != media.Image {
+		http.Error(w, "unsupported file type", http.StatusUnsupportedMediaType)
+		return
+	}
+	img, err := media.Decode(data)
+	switch {
+	case errors.Is(err, media.ErrUnsupported):
+		http.Error(w, "unsupported image format", http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, media.ErrTooLarge):
+		http.Error(w, "image dimensions too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "invalid image", http.StatusBadRequest)
+		return
+	}
+	selfie, err := media.EncodeJPEG(media.Orient(media.Resize(img, selfieSize), media.Orientation(data)), 90)
+	if err != nil {
+		logging.Log.Errorf("submit verification: encode error user=%d: %v", userID, err)
+		http.Error(w, "invalid image", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	key := "verifications/" + utils.GenerateToken(15) + ".jpg"
+	if err := storage.Default.Put(ctx, key, bytes.NewReader(selfie), int64(len(selfie)), "image/jpeg"); err != nil {
+		logging.Log.Errorf("submit verification: storage error user=%d: %v", userID, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+
+	v, err := data_access.SubmitVerification(userID, key, time.Now().UTC())
+	if err != nil || v == nil {
+		storage.Default.Delete(ctx, key)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "no pose requested or it expired", http.StatusConflict)
+		return
+	}
+
+	photos, err := data_access.GetPhotos(userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	req := verification.Request{ID: v.ID, UserID: userID, Pose: v.Pose, SelfieKey: key}
+	for _, p := range photos {
+		req.PhotoKeys = append(req.PhotoKeys, models.PhotoBlobKey(p.Key, models.PrimaryPhotoVariant))
+	}
+	res, err := verification.Decide(ctx, verification.Default, req)
+	if err != nil {
+		logging.Log.Errorf("submit verification: engine error verification=%d, left for review: %v", v.ID, err)
+	}
+	if res.Status != verification.Pending {
+		decided, err := decideVerification(ctx, v.ID, res.Status == verification.Approved, res.Reason, nil)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if decided != nil {
+			v = decided
+		}
+	}
+
+	writeVerification(w, v)
+}
+
+// GET /me/verification
+// Returns the user's latest verification request; 404 if there is none.
+// A rejected one carries the reason.
+// Example response:
+// {"id": 3, "user_id": 1, "pose": "thumbs_up", "status": "rejected", "reason": "Лицо не видно", ...}
+func GetMyVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	v, err := data_access.GetLatestVerification(userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if v == nil {
+		http.Error(w, "no verification", http.StatusNotFound)
+		return
+	}
+	writeVerification(w, v)
+}
+
+// GET /files/verifications/{id}?expires=...&sig=...
+// Serves a selfie waiting for review to whoever holds a signed URL; the
+// URLs are only handed to moderators.
+func ServeVerificationFileHandler(w http.ResponseWriter, r *http.Request) {
+	if !storage.URLs.Verify(r.URL.Path, r.URL.Query(), time.Now()) {
+		http.Error(w, "invalid or expired link", http.StatusForbidden)
+		return
+	}
+	idStr := strings.TrimPrefix(r.URL.Path, "/files/verifications/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	v, err := data_access.GetVerification(id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if v == nil || v.SelfieKey == "" {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	f, err := storage.Default.Open(r.Context(), v.SelfieKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Log.Errorf("serve selfie: storage error verification=%d: %v", id, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	io.Copy(w, f)
+}
+
+// decideVerification records a decision on a pending request and deletes
+// the selfie. reviewerID is nil for the engine. It returns nil if the
+// request isn't pending.
+func decideVerification(ctx context.Context, id int64, approved bool, reason string, reviewerID *int64) (*models.Verification, error) {
+	v, err := data_access.DecideVerification(id, approved, reason, reviewerID, time.Now().UTC())
+	if err != nil || v == nil {
+		return nil, err
+	}
+	if v.SelfieKey != "" {
+		if err := storage.Default.Delete(ctx, v.SelfieKey); err != nil {
+			logging.Log.Errorf("delete blob %s: %v", v.SelfieKey, err)
+		}
+	}
+	logging.Log.Infow("verification decided", "verification", id, "user", v.UserID, "status", v.Status)
+	return v, nil
+}
+
+// writeVerification responds with a request as its owner sees it.
+func writeVerification(w http.ResponseWriter, v *models.Verification) {
+	if pose, ok := verification.PoseByCode(v.Pose); ok {
+		v.Instruction = pose.Instruction
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
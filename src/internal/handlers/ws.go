@@ -3,14 +3,19 @@ package handlers
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	crypto "crypto/rand"
+	data_access "dating-backend/internal/data-access"
 	"dating-backend/internal/realtime"
+	"dating-backend/internal/realtime/protocol"
 
 	"dating-backend/internal/logging"
 	"dating-backend/internal/middleware"
+	"dating-backend/internal/models"
 
 	"github.com/gorilla/websocket"
 )
@@ -54,7 +59,12 @@ func generateSessionToken() string {
 	return hex.EncodeToString(b)
 }
 
+// maxFrameSize bounds client frames; it leaves room for a message of
+// MaxMessageLength characters, even fully escaped.
+const maxFrameSize = 64 << 10
+
 var upgrader = websocket.Upgrader{
+	Subprotocols: protocol.Supported,
 	CheckOrigin: func(r *http.Request) bool {
 		// Allow all origins - adjust for production as needed
         return true
@@ -64,7 +74,18 @@ var upgrader = websocket.Upgrader{
 // GenerateChatSessionToken creates a one-time session token for WebSocket chat connection.
 // The token is mapped to the userID and stored.
 // This token should be included as a query parameter when establishing the WebSocket connection.
-// Example usage: /ws/chat?session=<token>
+// Example usage: /ws/chat?session=<token>&device_id=<id>&last_seq=<n>
+// A user may be connected from several devices at once; events are sent to
+// all of them. Reconnecting with the same device_id replaces that device's
+// previous connection.
+// Events carry a per-user "seq"; a client reconnecting with last_seq first
+// receives the logged events it missed, preceded by a "resync" frame if
+// some of them are gone. Each device confirms receipt by sending
+// {"type":"ack","seq":n}; the log is trimmed up to the lowest seq acked.
+// Typing and presence events are live only, without "seq".
+// Frames are defined in internal/realtime/protocol; the version is
+// negotiated with Sec-WebSocket-Protocol (currently only "dating.v1").
+// Invalid or unknown frames are answered with an "error" frame.
 // Note: This function should be called after user authentication.
 // The token is valid for one-time use only.
 func ChatWebSocketHandler(w http.ResponseWriter, r *http.Request) {
@@ -81,6 +102,14 @@ func ChatWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients pick the protocol version through the subprotocol header; the
+	// upgrader echoes the one chosen
+	if _, ok := protocol.Negotiate(websocket.Subprotocols(r)); !ok {
+		logging.Log.Warnf("ws: unsupported protocol versions %v from user=%d", websocket.Subprotocols(r), userID)
+		http.Error(w, "unsupported protocol version", http.StatusBadRequest)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logging.Log.Errorf("ws: upgrade error: %v", err)
@@ -88,20 +117,34 @@ func ChatWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	realtime.ChatHub.Add(userID, conn)
-	
+	// Each device keeps its own connection; without a device_id every
+	// connection counts as a separate device
+	connID := r.URL.Query().Get("device_id")
+	if connID == "" {
+		connID = generateSessionToken()[:16]
+	}
+	var client *realtime.Connection
+	if v := r.URL.Query().Get("last_seq"); v != "" {
+		lastSeq, _ := strconv.ParseInt(v, 10, 64)
+		client, err = realtime.ChatHub.Resume(userID, connID, conn, lastSeq)
+		if err != nil {
+			logging.Log.Errorf("ws: replay failed user=%d last_seq=%d: %v", userID, lastSeq, err)
+		}
+	} else {
+		client = realtime.ChatHub.Add(userID, connID, conn)
+	}
+
 	// one-time use - remove token from the store
 	if err := realtime.DefaultSessionStore.Delete(session); err != nil {
 		logging.Log.Errorf("ws: failed to delete session token: %v", err)
 	}
 
 	defer func() {
-		realtime.ChatHub.Remove(userID)
-		conn.Close()
+		realtime.ChatHub.Remove(client)
 	}()
 
 	// Ping/Pong to keep the connection alive 
-	conn.SetReadLimit(512) // TODO: adjust limit as needed 
+	conn.SetReadLimit(maxFrameSize)
 	conn.SetReadDeadline(time.Now().Add(60 * time.Second)) 
 	conn.SetPongHandler(func(string) error { 
 		conn.SetReadDeadline(time.Now().Add(60 * time.Second)) 
@@ -109,39 +152,86 @@ func ChatWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	for {
-		var msg struct {
-            Type       string  `json:"type"`
-            ChatID     int64   `json:"chat_id,omitempty"`
-            ReceiverID int64   `json:"receiver_id,omitempty"`
-            Content    string  `json:"content,omitempty"`
-            MessageID  int64   `json:"message_id,omitempty"`
-        }
-
-		if err := conn.ReadJSON(&msg); err != nil {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
 				logging.Log.Warnf("user=%d disconnected unexpectedly: %v", userID, err)
 				break
 			}
-			logging.Log.Errorf("ws: read json error user=%d: %v", userID, err)
-				break
+			logging.Log.Errorf("ws: read error user=%d: %v", userID, err)
+			break
+		}
+
+		env, frame, ferr := protocol.Decode(data)
+		var ack *protocol.Ack
+		if ferr == nil {
+			ack, ferr = handleClientFrame(userID, client.ID, frame)
+		}
+		if ferr != nil {
+			ferr.ID = env.ID
+			logging.Log.Warnf("ws: rejected frame from user=%d: %v", userID, ferr)
+			client.Send(ferr)
+			continue
+		}
+		if ack == nil && env.ID != "" {
+			ack = &protocol.Ack{}
+		}
+		if ack != nil {
+			ack.ID = env.ID
+			client.Send(ack)
+		}
+	}
+}
+
+// handleClientFrame acts on a decoded client frame from the user's device
+// connID. A returned ack or error is sent back to the client.
+func handleClientFrame(userID int64, connID string, frame protocol.Frame) (*protocol.Ack, *protocol.Error) {
+	switch f := frame.(type) {
+	case *protocol.SendMessage:
+		msg := models.Message{
+			SenderID: userID,
+			ChatID:   f.ChatID,
+			Content:  f.Content,
+			ClientID: f.ClientID,
+
+			AttachmentIDs: f.AttachmentIDs,
+		}
+		if reason := validateMessage(&msg); reason != "" {
+			return nil, &protocol.Error{Code: protocol.CodeInvalid, Message: "send_message: " + reason}
+		}
+		if _, err := sendMessage(&msg); errors.Is(err, errNotParticipant) {
+			return nil, &protocol.Error{Code: protocol.CodeInvalid, Message: "send_message: not a participant of this chat"}
+		} else if errors.Is(err, data_access.ErrInvalidAttachments) {
+			return nil, &protocol.Error{Code: protocol.CodeInvalid, Message: "send_message: invalid attachments"}
+		} else if err != nil {
+			return nil, &protocol.Error{Code: protocol.CodeInternal, Message: "failed to save message"}
+		}
+		return &protocol.Ack{Message: &protocol.MessageAck{
+			ID:        msg.ID,
+			ClientID:  msg.ClientID,
+			ChatID:    msg.ChatID,
+			CreatedAt: msg.CreatedAt,
+		}}, nil
+
+	case *protocol.Typing:
+		realtime.ChatHub.SendEphemeral(f.ReceiverID, protocol.TypingEvent{
+			ChatID: f.ChatID,
+			UserID: userID,
+		})
+
+	case *protocol.Delivered:
+		if err := markDelivered(userID, f.MessageID); err != nil {
+			return nil, &protocol.Error{Code: protocol.CodeInternal, Message: "failed to mark delivered"}
 		}
 
-		switch msg.Type {
-
-        case "typing":
-            realtime.ChatHub.SendToUser(msg.ReceiverID, map[string]interface{}{
-                "type":		"typing",
-                "chat_id":	msg.ChatID,
-                "user_id":	userID,
-            })
-			
-        case "delivered":
-			realtime.ChatHub.SendToUser(msg.ReceiverID, map[string]interface{}{
-				"type":       "delivered",
-				"chat_id":    msg.ChatID,
-				"user_id":    userID,
-				"message_id": msg.MessageID,
-			})
-        }
-    }
+	case *protocol.SeqAck:
+		if err := realtime.ChatHub.Ack(userID, connID, f.Seq); err != nil {
+			logging.Log.Errorf("ws: ack failed user=%d seq=%d: %v", userID, f.Seq, err)
+			return nil, &protocol.Error{Code: protocol.CodeInternal, Message: "failed to trim event log"}
+		}
+
+	default:
+		return nil, &protocol.Error{Code: protocol.CodeUnknownType, Message: "unhandled frame type " + frame.FrameType()}
+	}
+	return nil, nil
 }
@@ -0,0 +1,77 @@
+// Package interests holds the rules of the interests taxonomy: the tags
+// users pick for their profile are grouped into Categories and labelled per
+// locale. The tags themselves live in the database and are managed by
+// admins.
+package interests
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"dating-backend/internal/models"
+)
+
+// Categories group the interests.
+var Categories = []string{"hobbies", "music", "sports", "food", "travel", "movies", "books", "games"}
+
+// MaxPerUser is how many interests a user may pick.
+var MaxPerUser = 10
+
+// DefaultLocale labels an interest that has no label in the requested
+// locale; failing that, its code is shown.
+const DefaultLocale = "ru"
+
+var (
+	codeRe   = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+	localeRe = regexp.MustCompile(`^[a-z]{2,3}$`)
+)
+
+// ValidCode reports whether s can be an interest code: lowercase letters
+// and digits, words joined by underscores.
+func ValidCode(s string) bool {
+	return len(s) <= 50 && codeRe.MatchString(s)
+}
+
+// ValidCategory reports whether s is one of Categories.
+func ValidCategory(s string) bool {
+	return slices.Contains(Categories, s)
+}
+
+// ValidLocale reports whether s is a language code labels can be given in,
+// such as "ru" or "en".
+func ValidLocale(s string) bool {
+	return localeRe.MatchString(s)
+}
+
+// Locale picks the language of the labels from a "lang" parameter or, if it
+// is empty, the first language of an Accept-Language header. It falls back
+// to DefaultLocale.
+func Locale(lang, acceptLanguage string) string {
+	if lang == "" {
+		first, _, _ := strings.Cut(acceptLanguage, ",")
+		first, _, _ = strings.Cut(first, ";")
+		lang = strings.TrimSpace(first)
+	}
+	lang, _, _ = strings.Cut(strings.ToLower(lang), "-")
+	if !ValidLocale(lang) {
+		return DefaultLocale
+	}
+	return lang
+}
+
+// Shared returns the interests of theirs that are also in mine, in the
+// order of theirs.
+func Shared(mine, theirs []models.Interest) []models.Interest {
+	ids := make(map[int64]bool, len(mine))
+	for _, i := range mine {
+		ids[i.ID] = true
+	}
+	var out []models.Interest
+	for _, i := range theirs {
+		if ids[i.ID] {
+			out = append(out, i)
+		}
+	}
+	return out
+}
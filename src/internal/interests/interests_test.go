@@ -0,0 +1,48 @@
+package interests
+
+import (
+	"testing"
+
+	"dating-backend/internal/models"
+)
+
+func TestLocale(t *testing.T) {
+	cases := []struct{ lang, header, want string }{
+		{"en", "de-DE,de;q=0.9", "en"},
+		{"", "de-DE,de;q=0.9", "de"},
+		{"", "EN;q=0.8", "en"},
+		{"", "", DefaultLocale},
+		{"", "*", DefaultLocale},
+		{"english", "", DefaultLocale},
+	}
+	for _, c := range cases {
+		if got := Locale(c.lang, c.header); got != c.want {
+			t.Errorf("Locale(%q, %q) = %q, want %q", c.lang, c.header, got, c.want)
+		}
+	}
+}
+
+func TestValidCode(t *testing.T) {
+	for _, s := range []string{"jazz", "board_games", "k_pop2"} {
+		if !ValidCode(s) {
+			t.Errorf("expected %q valid", s)
+		}
+	}
+	for _, s := range []string{"", "Jazz", "board games", "_x", "x__y", "джаз"} {
+		if ValidCode(s) {
+			t.Errorf("expected %q invalid", s)
+		}
+	}
+}
+
+func TestShared(t *testing.T) {
+	mine := []models.Interest{{ID: 1}, {ID: 2}, {ID: 5}}
+	theirs := []models.Interest{{ID: 5}, {ID: 3}, {ID: 1}}
+	got := Shared(mine, theirs)
+	if len(got) != 2 || got[0].ID != 5 || got[1].ID != 1 {
+		t.Errorf("unexpected shared interests %+v", got)
+	}
+	if got := Shared(nil, theirs); got != nil {
+		t.Errorf("expected none shared, got %+v", got)
+	}
+}
@@ -0,0 +1,69 @@
+// Package media recognizes uploaded files by their content and derives
+// resized images from them.
+package media
+
+import "net/http"
+
+// Kind is what an upload is used as.
+type Kind string
+
+const (
+	Image Kind = "image"
+	Voice Kind = "voice"
+)
+
+// MaxSize is the largest upload accepted per kind, in bytes.
+var MaxSize = map[Kind]int64{
+	Image: 10 << 20,
+	Voice: 5 << 20,
+}
+
+// SniffLen is how many leading bytes Sniff needs.
+const SniffLen = 512
+
+type fileType struct {
+	kind Kind
+	ext  string
+}
+
+// types are the accepted MIME types.
+var types = map[string]fileType{
+	"image/jpeg": {Image, ".jpg"},
+	"image/png":  {Image, ".png"},
+	"image/gif":  {Image, ".gif"},
+	"image/webp": {Image, ".webp"},
+	"audio/ogg":  {Voice, ".ogg"},
+	"audio/mpeg": {Voice, ".mp3"},
+	"audio/mp4":  {Voice, ".m4a"},
+	"audio/webm": {Voice, ".webm"},
+	"audio/wave": {Voice, ".wav"},
+}
+
+// containers are sniffed types that hold voice notes under another name.
+var containers = map[string]string{
+	"application/ogg": "audio/ogg",
+	"video/mp4":       "audio/mp4",
+	"video/webm":      "audio/webm",
+}
+
+// Sniff detects the type of a file from its first SniffLen bytes. The
+// type the client declared is never trusted. ok is false for types that
+// aren't accepted.
+func Sniff(head []byte) (mime string, kind Kind, ok bool) {
+	mime = http.DetectContentType(head)
+	if m, found := containers[mime]; found {
+		mime = m
+	}
+	// MP3 without an ID3 tag starts right with a frame header
+	if mime == "application/octet-stream" && len(head) > 1 &&
+		head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0 {
+		mime = "audio/mpeg"
+	}
+	t, ok := types[mime]
+	return mime, t.kind, ok
+}
+
+// Ext is the file extension used for a MIME type accepted by Sniff.
+func Ext(mime string) string {
+	return types[mime].ext
+}
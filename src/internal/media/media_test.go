@@ -0,0 +1,152 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+
+	cases := []struct {
+		name string
+		head []byte
+		mime string
+		kind Kind
+		ok   bool
+	}{
+		{"png", pngData.Bytes(), "image/png", Image, true},
+		{"ogg", []byte("OggS\x00\x02\x00\x00"), "audio/ogg", Voice, true},
+		{"mp3 with ID3", []byte("ID3\x03\x00\x00\x00"), "audio/mpeg", Voice, true},
+		{"bare mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x64, 0x00}, "audio/mpeg", Voice, true},
+		{"html", []byte("<html><body>hi</body></html>"), "text/html; charset=utf-8", "", false},
+		{"pdf", []byte("%PDF-1.4"), "application/pdf", "", false},
+	}
+	for _, c := range cases {
+		mime, kind, ok := Sniff(c.head)
+		if mime != c.mime || kind != c.kind || ok != c.ok {
+			t.Errorf("%s: got %q %q %v, want %q %q %v", c.name, mime, kind, ok, c.mime, c.kind, c.ok)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if x < 200 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	dst := Resize(src, 100)
+	if b := dst.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("expected 100x50 keeping the aspect ratio, got %v", b)
+	}
+	if r, _, _, _ := dst.At(10, 10).RGBA(); r != 0xFFFF {
+		t.Fatalf("expected white on the left, got %v", dst.At(10, 10))
+	}
+	if r, _, _, _ := dst.At(90, 10).RGBA(); r != 0 {
+		t.Fatalf("expected black on the right, got %v", dst.At(90, 10))
+	}
+	if Resize(src, 500) != image.Image(src) {
+		t.Fatalf("expected small images left alone")
+	}
+}
+
+func TestDecodeRejectsHugeDimensions(t *testing.T) {
+	// a PNG header claiming 100000x100000 pixels
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	copy(data[16:24], []byte{0, 1, 0x86, 0xA0, 0, 1, 0x86, 0xA0})
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	if _, err := Decode(data); err != ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := Decode([]byte("RIFF\x00\x00\x00\x00WEBPVP8 ")); err != ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported for WebP, got %v", err)
+	}
+}
+
+// withOrientation inserts an EXIF segment with the orientation tag after
+// the start of a JPEG.
+func withOrientation(jpg []byte, o uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0, 0, 0, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, o)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	jpg, err := EncodeJPEG(image.NewRGBA(image.Rect(0, 0, 4, 2)), 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := Orientation(jpg); o != 1 {
+		t.Fatalf("expected 1 without EXIF, got %d", o)
+	}
+	tagged := withOrientation(jpg, 6)
+	if o := Orientation(tagged); o != 6 {
+		t.Fatalf("expected 6, got %d", o)
+	}
+	if _, err := Decode(tagged); err != nil {
+		t.Fatalf("tagged JPEG doesn't decode: %v", err)
+	}
+	if o := Orientation(tagged[:30]); o != 1 {
+		t.Fatalf("expected 1 for a truncated segment, got %d", o)
+	}
+
+	img, _ := Decode(tagged)
+	out, _ := EncodeJPEG(Orient(img, 6), 80)
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Fatal("re-encoded JPEG still carries EXIF")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 2×1: red on the left, blue on the right
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	cases := []struct {
+		orientation int
+		w, h        int
+		first       color.RGBA // top left after orienting
+	}{
+		{1, 2, 1, red},
+		{2, 2, 1, blue},
+		{3, 2, 1, blue},
+		{6, 1, 2, red},  // turned clockwise: left side goes up
+		{8, 1, 2, blue}, // counterclockwise: right side goes up
+	}
+	for _, c := range cases {
+		out := Orient(src, c.orientation)
+		b := out.Bounds()
+		if b.Dx() != c.w || b.Dy() != c.h {
+			t.Errorf("%d: got %dx%d, want %dx%d", c.orientation, b.Dx(), b.Dy(), c.w, c.h)
+			continue
+		}
+		if got := color.RGBAModel.Convert(out.At(0, 0)); got != c.first {
+			t.Errorf("%d: top left is %v, want %v", c.orientation, got, c.first)
+		}
+	}
+}
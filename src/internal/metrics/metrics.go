@@ -0,0 +1,23 @@
+package metrics
+
+import "expvar"
+
+// Counters and gauges are published through expvar and served as JSON by
+// the admin metrics endpoint.
+var (
+	SessionsPruned  = expvar.NewInt("sessions_pruned_total")
+	SessionsEvicted = expvar.NewInt("sessions_evicted_total")
+
+	WSSent            = expvar.NewInt("ws_messages_sent_total")
+	WSDropped         = expvar.NewInt("ws_messages_dropped_total")
+	WSSlowDisconnects = expvar.NewInt("ws_slow_disconnects_total")
+	WSEventsPruned    = expvar.NewInt("ws_events_pruned_total")
+)
+
+// Publish exposes a value computed on every read, such as a table size.
+func Publish(name string, f func() any) {
+	expvar.Publish(name, expvar.Func(f))
+}
+
+// Handler serves all published metrics as JSON.
+var Handler = expvar.Handler
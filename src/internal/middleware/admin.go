@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"dating-backend/internal/logging"
+	"net/http"
+)
+
+// AdminUserIDs are the users allowed to call admin endpoints. Main fills it
+// from configuration; when empty, admin endpoints are closed to everyone.
+var AdminUserIDs = map[int64]bool{}
+
+// AdminMiddleware lets the request through only for users listed in
+// AdminUserIDs. It must run after AuthMiddleware, which puts the user id
+// into the context; other users get HTTP 403.
+func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !AdminUserIDs[userID] {
+			logging.Log.Warnf("admin: forbidden for user=%d path=%s", userID, r.URL.Path)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
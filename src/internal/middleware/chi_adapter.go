@@ -36,6 +36,9 @@ var (
     // ChiAuthMiddleware performs authorization checks and injects user id into
     // the request context using the existing AuthMiddleware implementation.
     ChiAuthMiddleware = Adapter(AuthMiddleware)
+    // ChiAdminMiddleware restricts a route group to AdminUserIDs; use it
+    // after ChiAuthMiddleware.
+    ChiAdminMiddleware = Adapter(AdminMiddleware)
     // ChiRequestIDMiddleware injects a request id into each incoming request
     // and sets X-Request-ID header on the response.
     ChiRequestIDMiddleware = Adapter(RequestIDMiddleware)
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Attachment is a file uploaded into a chat. It belongs to the chat from
+// the upload on and to a message once one is sent with it.
+type Attachment struct {
+	ID         int64     `json:"id"`
+	ChatID     int64     `json:"chat_id"`
+	UploaderID int64     `json:"uploader_id"`
+	MessageID  *int64    `json:"message_id,omitempty"`
+	Kind       string    `json:"kind"` // "image" или "voice"
+	MIME       string    `json:"mime"`
+	Size       int64     `json:"size"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// URL and ThumbnailURL are signed download links that expire.
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+
+	Key      string `json:"-"` // blob key of the file
+	ThumbKey string `json:"-"` // blob key of the thumbnail, images only
+}
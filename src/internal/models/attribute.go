@@ -0,0 +1,20 @@
+package models
+
+// AttributeValue is one stored value of an optional profile attribute,
+// see package attributes. Multi-valued attributes have several.
+type AttributeValue struct {
+	Key        string
+	Value      string // "" for an attribute with a visibility but no value
+	Num        *int64 // the value of numeric attributes
+	Visibility string
+}
+
+// AttributeCondition is a search condition on an attribute: the candidate
+// has one of Values, or a number between Min and Max. Soft conditions only
+// rank candidates.
+type AttributeCondition struct {
+	Key      string
+	Values   []string
+	Min, Max *int64
+	Soft     bool
+}
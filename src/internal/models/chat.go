@@ -12,5 +12,6 @@ type Chat struct {
 	LastMessage     string    `json:"last_message,omitempty"`      // Optional field for last message preview
 	LastMessageTime time.Time `json:"last_message_time,omitempty"` // Optional field for last message time
 	LastMessageUser int64	  `json:"last_message_user,omitempty"` // Optional field for last message user ID
+	LastMessageDeleted bool   `json:"last_message_deleted,omitempty"` // last message was unsent; LastMessage is empty
 	IsRead			bool      `json:"is_read"`
 }
\ No newline at end of file
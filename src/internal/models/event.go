@@ -0,0 +1,14 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserEvent is a realtime event kept in a user's event log. Seq increases
+// by one per event of the user, so a client can tell what it missed.
+type UserEvent struct {
+	Seq       int64           `json:"seq"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Interest is a tag of the curated interests taxonomy, such as "hiking" in
+// "sports". Label is in the locale the response was asked in.
+type Interest struct {
+	ID       int64  `json:"id"`
+	Code     string `json:"code"`
+	Category string `json:"category"`
+	Label    string `json:"label"`
+
+	Labels map[string]string `json:"labels,omitempty"` // все переводы, только в админке
+}
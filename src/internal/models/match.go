@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Match is a mutual like between two users. It owns the chat the pair
+// talks in; its status tracks whether the pair is still connected.
+type Match struct {
+	ID              int64          `json:"id"`
+	ChatID          int64          `json:"chat_id"`
+	Source          string         `json:"source"` // "like" или "superlike"
+	Status          string         `json:"status"` // "active", "unmatched" или "expired"
+	CreatedAt       time.Time      `json:"created_at"`
+	User            ProfileSummary `json:"user"` // собеседник
+	HasMessages     bool           `json:"has_messages"`
+	LastMessageTime *time.Time     `json:"last_message_time,omitempty"`
+}
+
+// MatchPair identifies a match and both of its users; background jobs use it
+// to notify the pair.
+type MatchPair struct {
+	ID        int64
+	ChatID    int64
+	User1ID   int64
+	User2ID   int64
+	CreatedAt time.Time
+}
@@ -10,4 +10,25 @@ type Message struct {
 	Content    string    `json:"content"`
 	IsRead     bool      `json:"is_read"`
 	CreatedAt  time.Time `json:"created_at"`
-}
\ No newline at end of file
+	// DeliveredAt and ReadAt are set by the receiver. ReadAt stays empty
+	// when the receiver hides read receipts.
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	// EditedAt is set once the sender edits the message. DeletedAt marks a
+	// message unsent for everyone: a tombstone with empty content.
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ClientID is an optional id chosen by the sending client; resending a
+	// message with the same ClientID doesn't create a duplicate.
+	ClientID string `json:"client_id,omitempty"`
+	// AttachmentIDs lists uploads to send with the message (POST /uploads).
+	// Attachments are the files of a stored message.
+	AttachmentIDs []int64      `json:"attachment_ids,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+}
+
+// MessageEdit is a replaced version of an edited message.
+type MessageEdit struct {
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"edited_at"` // when this version was replaced
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Passport is a temporary search location ("travel mode"). While it is
+// active, discovery uses its coordinates instead of the user's home
+// location; the home location itself stays untouched.
+type Passport struct {
+	City      string    `json:"city"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PassportRadiusKm is the search radius around a passport location when the
+// client doesn't send max_distance_km.
+const PassportRadiusKm = 50.0
+
+// Apply makes f search around the passport location. Without a radius the
+// location alone would not narrow the search, so PassportRadiusKm is used.
+func (p *Passport) Apply(f *SimpleFilter) {
+	f.Latitude = &p.Latitude
+	f.Longitude = &p.Longitude
+	if f.MaxDistanceKm == nil {
+		radius := PassportRadiusKm
+		f.MaxDistanceKm = &radius
+	}
+}
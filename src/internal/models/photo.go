@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// PhotoVariants are the sizes every profile photo is stored in: the
+// longer side is scaled down to the given number of pixels.
+var PhotoVariants = map[string]int{
+	"small":  160,
+	"medium": 640,
+	"large":  1280,
+}
+
+// PrimaryPhotoVariant is the size User.PhotoURL and profile summaries
+// point to.
+const PrimaryPhotoVariant = "medium"
+
+// Photo is one picture of a user's profile gallery. The gallery is ordered
+// by Position; the first photo is the primary one.
+type Photo struct {
+	ID        int64             `json:"id"`
+	Position  int               `json:"position"`
+	Primary   bool              `json:"primary"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	URLs      map[string]string `json:"urls"` // по размерам из PhotoVariants
+	CreatedAt time.Time         `json:"created_at"`
+
+	Key string `json:"-"` // prefix of the blob keys of the variants
+}
+
+// FillURLs sets the URLs of the photo's sizes from its key.
+func (p *Photo) FillURLs() {
+	p.URLs = make(map[string]string, len(PhotoVariants))
+	for variant := range PhotoVariants {
+		p.URLs[variant] = PhotoURL(p.Key, variant)
+	}
+}
+
+// PhotoBlobKey is the blob key of one variant of a photo.
+func PhotoBlobKey(key, variant string) string {
+	return key + "_" + variant + ".jpg"
+}
+
+// PhotoURL is the public URL of one variant of a photo. The key is random,
+// so the URL can't be guessed, and it never changes, so it can be cached.
+func PhotoURL(key, variant string) string {
+	return "/files/" + PhotoBlobKey(key, variant)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Presence is whether a user is connected right now and when they were
+// last seen. Hidden users always appear offline with no last-seen time.
+type Presence struct {
+	UserID   int64      `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Hidden   bool       `json:"-"` // пользователь скрыл свой онлайн-статус
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Prompt is a question users can answer on their profile, such as "The
+// way to my heart is...". Prompts are managed by admins; inactive ones
+// can't be picked anymore but keep the answers given.
+type Prompt struct {
+	ID        int64     `json:"id"`
+	Text      string    `json:"text"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PromptAnswer is a prompt card of a profile. Its ID stays the same while
+// the user keeps answering the prompt, so likes can point at it.
+type PromptAnswer struct {
+	ID       int64  `json:"id"`
+	PromptID int64  `json:"prompt_id"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// LikedContent is the prompt card or photo of a profile a like was given
+// on. Type and ID come with the like, the rest is filled in for the likes
+// inbox.
+type LikedContent struct {
+	Type string `json:"type"` // "prompt" или "photo"
+	ID   int64  `json:"id"`
+
+	Question string `json:"question,omitempty"`
+	Answer   string `json:"answer,omitempty"`
+	PhotoURL string `json:"photo_url,omitempty"`
+}
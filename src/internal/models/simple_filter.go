@@ -10,7 +10,25 @@ type SimpleFilter struct {
 	Latitude      *float64 `json:"latitude,omitempty" schema:"latitude"`
 	Longitude     *float64 `json:"longitude,omitempty" schema:"longitude"`
 	HasPhoto      *bool    `json:"has_photo,omitempty" schema:"has_photo"`
+	VerifiedOnly  *bool    `json:"verified_only,omitempty" schema:"verified_only"`
 	InterestedIn  *string  `json:"interested_in,omitempty" schema:"interested_in"`
 	LastSeenID    *int64   `json:"last_seen_id,omitempty" schema:"last_seen_id"`
 	OnlineOnly    *bool    `json:"onlineOnly,omitempty" schema:"online_only"`
+	// ActiveWithinDays keeps users active in the last N days
+	ActiveWithinDays *int64 `json:"active_within_days,omitempty" schema:"active_within_days"`
+	// Dealbreakers and Preferences are attribute conditions such as
+	// "smoking:never" or "height:170-190", see attributes.ParseCondition.
+	// Dealbreakers exclude candidates, Preferences rank them.
+	Dealbreakers []string `json:"dealbreaker,omitempty" schema:"dealbreaker"`
+	Preferences  []string `json:"prefer,omitempty" schema:"prefer"`
+	// LastSeenScore is the rank_score of the last candidate seen; pages
+	// continue after (LastSeenScore, LastSeenID).
+	LastSeenScore *float64 `json:"last_seen_score,omitempty" schema:"last_seen_score"`
+
+	// Locale is the language of interest labels; the handler falls back
+	// to Accept-Language.
+	Locale string `json:"lang,omitempty" schema:"lang"`
+
+	// Conditions are Dealbreakers and Preferences parsed by the handler.
+	Conditions []AttributeCondition `json:"-" schema:"-"`
 }
\ No newline at end of file
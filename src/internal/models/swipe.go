@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+type Swipe struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	TargetID  int64     `json:"target_id"`
+	Action    string    `json:"action"` // "like", "dislike" или "superlike"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProfileSummary is the compact profile shown in lists (history, inboxes).
+type ProfileSummary struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Age      int    `json:"age"`
+	PhotoURL string `json:"photo_url"`
+}
+
+type SwipeHistoryItem struct {
+	SwipeID   int64          `json:"swipe_id"`
+	Action    string         `json:"action"`
+	CreatedAt time.Time      `json:"created_at"`
+	User      ProfileSummary `json:"user"`
+}
+
+// SwipeStats aggregates a user's swipe activity over one time window.
+type SwipeStats struct {
+	Window        string  `json:"window"` // "24h", "7d", "30d" или "all"
+	LikesSent     int     `json:"likes_sent"`
+	LikesReceived int     `json:"likes_received"`
+	Matches       int     `json:"matches"`
+	MatchRate     float64 `json:"match_rate"` // matches / likes_sent
+}
+
+// LikeInboxItem is an inbound like the user hasn't answered yet.
+type LikeInboxItem struct {
+	SwipeID   int64          `json:"swipe_id"`
+	Action    string         `json:"action"` // "like" или "superlike"
+	CreatedAt time.Time      `json:"created_at"`
+	Seen      bool           `json:"seen"`
+	Blurred   bool           `json:"blurred,omitempty"` // профиль скрыт: нет доступа к списку лайков
+	Content   *LikedContent  `json:"content,omitempty"` // что именно понравилось
+	Comment   string         `json:"comment,omitempty"`
+	User      ProfileSummary `json:"user"`
+}
@@ -10,23 +10,37 @@ type User struct {
 	Birthday     *SQLiteDate `json:"birthday"`
 	InterestedIn string      `json:"interested_in"` // кого ищет: "male", "female"
 	Bio          string      `json:"bio"`
-	PhotoURL     string      `json:"photo_url"`
+	PhotoURL     string      `json:"photo_url"` // главное фото галереи, задаётся сервером
+	Photos       []Photo     `json:"photos,omitempty"` // галерея по порядку
+	PhotoVerified bool       `json:"photo_verified"` // фото подтверждены селфи
 	Location     *string     `json:"location"` // город/район (для вывода)
 	Latitude     *float64    `json:"latitude"` // для геолокации
 	Longitude    *float64    `json:"longitude"`
 	CreatedAt    string      `json:"created_at"`
 	LastActive   string      `json:"last_active"`
+	Timezone     string      `json:"timezone,omitempty"` // IANA, например "Europe/Moscow"
 	DistanceKm   *int        `json:"distance_km"` // расстояние до текущего пользователя, км
+	TravelingTo  *string     `json:"traveling_to,omitempty"` // город из активного паспорта
+	SuperLikedYou bool       `json:"superliked_you,omitempty"` // кандидат поставил суперлайк текущему пользователю
+	HideOnline   bool        `json:"hide_online,omitempty"` // не показывать онлайн-статус и время последнего визита
+	HideReadReceipts bool    `json:"hide_read_receipts,omitempty"` // не сообщать собеседникам о прочтении
 
-	// Дополнительные поля профиля (необязательные) // пока набрасываю
-	// Occupation  *string                `json:"occupation,omitempty"`
-	// Religion    *string                `json:"religion,omitempty"`
-	// Smoking     *string                `json:"smoking,omitempty"`
-	// Drinking    *string                `json:"drinking,omitempty"`
-	// Pets       *string                `json:"pets,omitempty"`
-	// Height      *int                   `json:"height,omitempty"`
-	// Weight      *int                   `json:"weight,omitempty"`
-	// Education   *string                `json:"education,omitempty"`
-	// Children    *string                `json:"children,omitempty"`
-	// Extras      map[string]interface{} `json:"extras,omitempty"` // хобби, питомцы, предпочтения
-}
\ No newline at end of file
+	Attributes   map[string]any    `json:"attributes,omitempty"` // дополнительные поля, см. attributes.Schema
+	AttributeVisibility map[string]string `json:"attribute_visibility,omitempty"` // кто видит поля, только в своём профиле
+	Prompts      []PromptAnswer `json:"prompts,omitempty"` // карточки вопрос-ответ, не больше трёх
+	Interests    []Interest  `json:"interests,omitempty"`
+	SharedInterests []Interest `json:"shared_interests,omitempty"` // общие со смотрящим интересы
+	RankScore    float64     `json:"rank_score,omitempty"` // насколько кандидат подходит под мягкие предпочтения
+}
+
+// ProfileUpdate is a profile edit saved at once: User carries the new
+// profile fields, nil InterestIDs and Prompts and an empty
+// AttributeVisibility leave those parts as they are.
+type ProfileUpdate struct {
+	User                *User
+	InterestIDs         *[]int64
+	InterestLimit       int
+	Prompts             *[]PromptAnswer
+	AttributeValues     map[string][]AttributeValue
+	AttributeVisibility map[string]string
+}
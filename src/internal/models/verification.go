@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Verification is a user's request to get the photo_verified badge: a
+// selfie in the requested pose, decided by an engine or a moderator.
+type Verification struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Pose        string     `json:"pose"`
+	Instruction string     `json:"instruction,omitempty"` // что сделать на селфи
+	Status      string     `json:"status"`                // requested, pending, approved, rejected
+	Reason      string     `json:"reason,omitempty"`      // причина отказа
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // до когда ждём селфи
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+
+	// For moderators: a signed link to the selfie and the profile photos
+	// to compare it with.
+	SelfieURL string  `json:"selfie_url,omitempty"`
+	Photos    []Photo `json:"photos,omitempty"`
+
+	SelfieKey  string `json:"-"`
+	ReviewerID *int64 `json:"-"` // nil when decided by the engine
+}
@@ -0,0 +1,183 @@
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy describes how many uses of an action a user gets per window.
+// A Daily policy resets at midnight in the user's timezone; otherwise the
+// window is rolling and covers the last Window of time.
+type Policy struct {
+	Limit  int
+	Window time.Duration
+	Daily  bool
+}
+
+// DefaultPolicies are the built-in quotas. "like" limits likes only (dislikes
+// are free), "swipe" is a short rolling rate limit on every swipe to slow
+// down bots, "superlike" and "rewind" cap the premium swipe actions.
+var DefaultPolicies = map[string]Policy{
+	"like":      {Limit: 100, Daily: true},
+	"swipe":     {Limit: 60, Window: time.Minute},
+	"superlike": {Limit: 1, Daily: true},
+	"rewind":    {Limit: 3, Daily: true},
+}
+
+// ParsePolicy builds a policy from configuration strings: limit is an
+// integer and window is either "daily" or a Go duration such as "12h".
+func ParsePolicy(limit, window string) (Policy, error) {
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return Policy{}, fmt.Errorf("quota: invalid limit %q", limit)
+	}
+	if strings.EqualFold(window, "daily") || window == "" {
+		return Policy{Limit: n, Daily: true}, nil
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Policy{}, fmt.Errorf("quota: invalid window %q", window)
+	}
+	return Policy{Limit: n, Window: d}, nil
+}
+
+// Status is a snapshot of a user's quota for one action.
+type Status struct {
+	Kind      string     `json:"kind"`
+	Limit     int        `json:"limit"`
+	Used      int        `json:"used"`
+	Remaining int        `json:"remaining"`
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+}
+
+// ExceededError is returned by Limiter.Allow when the quota is exhausted.
+type ExceededError struct {
+	Kind    string
+	Limit   int
+	ResetAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota of %d exceeded, resets at %s", e.Kind, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// Limiter applies policies on top of a Store.
+type Limiter struct {
+	Store    Store
+	Policies map[string]Policy
+	Now      func() time.Time
+}
+
+// NewLimiter creates a limiter using the wall clock.
+func NewLimiter(store Store, policies map[string]Policy) *Limiter {
+	return &Limiter{Store: store, Policies: policies, Now: time.Now}
+}
+
+// Default is the limiter used by handlers. Main can replace its Store (for
+// example with a Redis-backed one) or its policies before the server starts.
+var Default = NewLimiter(SQLiteStore{}, DefaultPolicies)
+
+// Allow consumes one use of kind for the user. Actions without a policy are
+// always allowed. When the quota is exhausted it returns *ExceededError.
+func (l *Limiter) Allow(kind string, userID int64, loc *time.Location) (*Status, error) {
+	p, ok := l.Policies[kind]
+	if !ok {
+		return nil, nil
+	}
+	now := l.Now()
+	start, end := p.window(now, loc)
+
+	used, ok, err := l.Store.Take(key(kind, userID), p.Limit, start, now, end)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		resetAt, err := l.resetAt(kind, userID, p, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &ExceededError{Kind: kind, Limit: p.Limit, ResetAt: resetAt}
+	}
+	return &Status{Kind: kind, Limit: p.Limit, Used: used, Remaining: p.Limit - used}, nil
+}
+
+// Refund gives back the last use of kind consumed by Allow, for actions that
+// failed after their quota was taken.
+func (l *Limiter) Refund(kind string, userID int64) error {
+	if _, ok := l.Policies[kind]; !ok {
+		return nil
+	}
+	return l.Store.Release(key(kind, userID))
+}
+
+// Status reports the current usage of kind for the user without consuming.
+func (l *Limiter) Status(kind string, userID int64, loc *time.Location) (*Status, error) {
+	p, ok := l.Policies[kind]
+	if !ok {
+		return nil, fmt.Errorf("quota: unknown kind %q", kind)
+	}
+	start, end := p.window(l.Now(), loc)
+
+	used, oldest, err := l.Store.Usage(key(kind, userID), start)
+	if err != nil {
+		return nil, err
+	}
+	st := &Status{Kind: kind, Limit: p.Limit, Used: used, Remaining: max(p.Limit-used, 0)}
+	if used > 0 {
+		resetAt := end
+		if !p.Daily {
+			resetAt = oldest.Add(p.Window)
+		}
+		st.ResetAt = &resetAt
+	}
+	return st, nil
+}
+
+// All reports the status of every configured quota for the user.
+func (l *Limiter) All(userID int64, loc *time.Location) (map[string]*Status, error) {
+	out := make(map[string]*Status, len(l.Policies))
+	for kind := range l.Policies {
+		st, err := l.Status(kind, userID, loc)
+		if err != nil {
+			return nil, err
+		}
+		out[kind] = st
+	}
+	return out, nil
+}
+
+// resetAt finds when the next use frees up: the end of the day for daily
+// policies, or when the oldest use leaves the rolling window.
+func (l *Limiter) resetAt(kind string, userID int64, p Policy, start, end time.Time) (time.Time, error) {
+	if p.Daily {
+		return end, nil
+	}
+	_, oldest, err := l.Store.Usage(key(kind, userID), start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if oldest.IsZero() {
+		return end, nil
+	}
+	return oldest.Add(p.Window), nil
+}
+
+// window returns the start of the current window and the time by which
+// every use in it will have expired.
+func (p Policy) window(now time.Time, loc *time.Location) (time.Time, time.Time) {
+	if !p.Daily {
+		return now.Add(-p.Window), now.Add(p.Window)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1)
+}
+
+func key(kind string, userID int64) string {
+	return "quota:" + kind + ":" + strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,109 @@
+package quota
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+
+	_ "modernc.org/sqlite"
+)
+
+func setupSQLiteStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE quota_events (id INTEGER PRIMARY KEY AUTOINCREMENT, key TEXT NOT NULL, created_at DATETIME NOT NULL);`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	data_access.DB = db
+	t.Cleanup(func() { db.Close() })
+}
+
+// clock is a settable Limiter.Now.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestSQLiteStoreRollingWindow(t *testing.T) {
+	setupSQLiteStore(t)
+	c := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := &Limiter{Store: SQLiteStore{}, Policies: map[string]Policy{"swipe": {Limit: 2, Window: time.Minute}}, Now: c.Now}
+
+	if st, err := l.Allow("swipe", 1, nil); err != nil || st.Used != 1 || st.Remaining != 1 {
+		t.Fatalf("first: got %+v, %v", st, err)
+	}
+	c.now = c.now.Add(20 * time.Second)
+	if st, err := l.Allow("swipe", 1, nil); err != nil || st.Used != 2 || st.Remaining != 0 {
+		t.Fatalf("second: got %+v, %v", st, err)
+	}
+
+	// the third use waits until the first leaves the window
+	c.now = c.now.Add(20 * time.Second)
+	_, err := l.Allow("swipe", 1, nil)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || !exceeded.ResetAt.Equal(time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC)) {
+		t.Fatalf("third: got %v", err)
+	}
+	// other users have their own bucket
+	if _, err := l.Allow("swipe", 2, nil); err != nil {
+		t.Fatalf("other user: %v", err)
+	}
+
+	c.now = time.Date(2024, 1, 1, 12, 1, 1, 0, time.UTC)
+	if st, err := l.Allow("swipe", 1, nil); err != nil || st.Used != 2 {
+		t.Fatalf("after window: got %+v, %v", st, err)
+	}
+	st, err := l.Status("swipe", 1, nil)
+	if err != nil || st.Used != 2 || st.ResetAt == nil || !st.ResetAt.Equal(time.Date(2024, 1, 1, 12, 1, 20, 0, time.UTC)) {
+		t.Fatalf("status: got %+v, %v", st, err)
+	}
+}
+
+func TestSQLiteStoreDailyReset(t *testing.T) {
+	setupSQLiteStore(t)
+	loc := time.FixedZone("MSK", 3*60*60)
+	c := &clock{now: time.Date(2024, 1, 1, 23, 30, 0, 0, loc)}
+	l := &Limiter{Store: SQLiteStore{}, Policies: map[string]Policy{"superlike": {Limit: 1, Daily: true}}, Now: c.Now}
+
+	if _, err := l.Allow("superlike", 1, loc); err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	_, err := l.Allow("superlike", 1, loc)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || !exceeded.ResetAt.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, loc)) {
+		t.Fatalf("second: got %v", err)
+	}
+
+	// the day ends at the user's local midnight, not at UTC midnight
+	c.now = time.Date(2024, 1, 2, 0, 10, 0, 0, loc)
+	if st, err := l.Allow("superlike", 1, loc); err != nil || st.Used != 1 {
+		t.Fatalf("next day: got %+v, %v", st, err)
+	}
+}
+
+func TestLimiterRefund(t *testing.T) {
+	setupSQLiteStore(t)
+	c := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := &Limiter{Store: SQLiteStore{}, Policies: map[string]Policy{"like": {Limit: 1, Daily: true}}, Now: c.Now}
+
+	if _, err := l.Allow("like", 1, nil); err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	if err := l.Refund("like", 1); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if st, err := l.Status("like", 1, nil); err != nil || st.Used != 0 {
+		t.Fatalf("status after refund: got %+v, %v", st, err)
+	}
+	if _, err := l.Allow("like", 1, nil); err != nil {
+		t.Fatalf("allow after refund: %v", err)
+	}
+	if err := l.Refund("unknown", 1); err != nil {
+		t.Fatalf("refund without policy: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps the timestamps of quota uses. Implementations must make Take
+// atomic per key so concurrent requests can't overshoot the limit.
+type Store interface {
+	// Take records a use at now unless limit uses happened since
+	// windowStart. The bucket may be forgotten after expireAt.
+	Take(key string, limit int, windowStart, now, expireAt time.Time) (used int, ok bool, err error)
+	// Release forgets the most recent use so it can be taken again.
+	Release(key string) error
+	// Usage returns the uses since windowStart and the oldest of them.
+	Usage(key string, windowStart time.Time) (used int, oldest time.Time, err error)
+}
+
+// SQLite implementation ----------------------------------------------------
+type SQLiteStore struct{}
+
+func (SQLiteStore) Take(key string, limit int, windowStart, now, _ time.Time) (int, bool, error) {
+	return data_access.TakeQuota(key, limit, windowStart, now)
+}
+
+func (SQLiteStore) Release(key string) error {
+	return data_access.ReleaseQuota(key)
+}
+
+func (SQLiteStore) Usage(key string, windowStart time.Time) (int, time.Time, error) {
+	return data_access.QuotaUsage(key, windowStart)
+}
+
+// Redis-backed implementation ----------------------------------------------
+// Uses are members of a sorted set scored by unix milliseconds.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(opts *redis.Options) *RedisStore {
+	return &RedisStore{client: redis.NewClient(opts)}
+}
+
+var takeScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+local used = redis.call('ZCARD', KEYS[1])
+if used >= tonumber(ARGV[3]) then
+	return {used, 0}
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIREAT', KEYS[1], ARGV[5])
+return {used + 1, 1}
+`)
+
+func (r *RedisStore) Take(key string, limit int, windowStart, now, expireAt time.Time) (int, bool, error) {
+	ctx := context.Background()
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int64())
+	res, err := takeScript.Run(ctx, r.client, []string{key},
+		windowStart.UnixMilli(), now.UnixMilli(), limit, member, expireAt.UnixMilli()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return int(res[0]), res[1] == 1, nil
+}
+
+func (r *RedisStore) Release(key string) error {
+	return r.client.ZPopMax(context.Background(), key, 1).Err()
+}
+
+func (r *RedisStore) Usage(key string, windowStart time.Time) (int, time.Time, error) {
+	ctx := context.Background()
+	min := fmt.Sprint(windowStart.UnixMilli())
+	used, err := r.client.ZCount(ctx, key, min, "+inf").Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if used == 0 {
+		return 0, time.Time{}, nil
+	}
+	oldest, err := r.client.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: min, Max: "+inf", Count: 1,
+	}).Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(oldest) == 0 {
+		return int(used), time.Time{}, nil
+	}
+	return int(used), time.UnixMilli(int64(oldest[0].Score)), nil
+}
@@ -0,0 +1,114 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"dating-backend/internal/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Broker carries events between server instances. Each instance subscribes
+// under its own id; the presence registry tells the sender which instances
+// hold the user's connections.
+type Broker interface {
+	// Publish sends an encoded event for userID to the given instance.
+	Publish(ctx context.Context, instanceID string, userID int64, msg []byte) error
+	// Subscribe delivers events addressed to instanceID until ctx is done.
+	// It returns once the subscription is active.
+	Subscribe(ctx context.Context, instanceID string, deliver func(userID int64, msg []byte)) error
+}
+
+// In-memory implementation -------------------------------------------------
+// Connects hubs living in the same process; used in tests.
+type MemoryBroker struct {
+	mu   sync.RWMutex
+	subs map[string]func(userID int64, msg []byte)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[string]func(int64, []byte))}
+}
+
+func (b *MemoryBroker) Publish(_ context.Context, instanceID string, userID int64, msg []byte) error {
+	b.mu.RLock()
+	deliver := b.subs[instanceID]
+	b.mu.RUnlock()
+	if deliver != nil {
+		deliver(userID, msg)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, instanceID string, deliver func(int64, []byte)) error {
+	b.mu.Lock()
+	b.subs[instanceID] = deliver
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subs, instanceID)
+		b.mu.Unlock()
+	}()
+	return nil
+}
+
+// Redis-backed implementation ----------------------------------------------
+// Every instance listens on its own pub/sub channel.
+type RedisBroker struct {
+	client *redis.Client
+}
+
+func NewRedisBroker(opts *redis.Options) *RedisBroker {
+	return &RedisBroker{client: redis.NewClient(opts)}
+}
+
+type brokerEnvelope struct {
+	UserID int64           `json:"user_id"`
+	Event  json.RawMessage `json:"event"`
+}
+
+func brokerChannel(instanceID string) string {
+	return "realtime:instance:" + instanceID
+}
+
+func (r *RedisBroker) Publish(ctx context.Context, instanceID string, userID int64, msg []byte) error {
+	payload, err := json.Marshal(brokerEnvelope{UserID: userID, Event: msg})
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, brokerChannel(instanceID), payload).Err()
+}
+
+func (r *RedisBroker) Subscribe(ctx context.Context, instanceID string, deliver func(int64, []byte)) error {
+	sub := r.client.Subscribe(ctx, brokerChannel(instanceID))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+
+	go func() {
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-ch:
+				if !ok {
+					return
+				}
+				var env brokerEnvelope
+				if err := json.Unmarshal([]byte(m.Payload), &env); err != nil {
+					logging.Log.Warnf("realtime: bad broker message on %s: %v", m.Channel, err)
+					continue
+				}
+				deliver(env.UserID, env.Event)
+			}
+		}
+	}()
+	return nil
+}
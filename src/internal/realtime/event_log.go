@@ -0,0 +1,75 @@
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/models"
+)
+
+// EventLog keeps the events sent to each user, numbered by a per-user
+// sequence, so a client that was offline can fetch what it missed.
+type EventLog interface {
+	// Append logs an encoded event and returns its sequence number.
+	Append(userID int64, msg []byte, now time.Time) (int64, error)
+	// Since returns the events after seq, oldest first. complete is false
+	// if some of them were dropped from the log already.
+	Since(userID, seq int64) (events []models.UserEvent, complete bool, err error)
+	// Register records that the user's device connected having the events
+	// up to and including seq, or all of them when seq is negative.
+	Register(userID int64, deviceID string, seq int64, now time.Time) error
+	// Ack records that the user's device received the events up to and
+	// including seq. Events are dropped once every registered device acked
+	// them.
+	Ack(userID int64, deviceID string, seq int64, now time.Time) error
+}
+
+// SQLite implementation ----------------------------------------------------
+// MaxPerUser bounds each user's log; older events are also removed by
+// data_access.PruneUserEvents, run from the scheduler.
+type SQLiteEventLog struct {
+	MaxPerUser int
+}
+
+func (l SQLiteEventLog) Append(userID int64, msg []byte, now time.Time) (int64, error) {
+	return data_access.AppendUserEvent(userID, msg, now, l.MaxPerUser)
+}
+
+func (SQLiteEventLog) Since(userID, seq int64) ([]models.UserEvent, bool, error) {
+	return data_access.GetUserEventsSince(userID, seq)
+}
+
+func (SQLiteEventLog) Register(userID int64, deviceID string, seq int64, now time.Time) error {
+	return data_access.RegisterEventDevice(userID, deviceID, seq, now)
+}
+
+func (SQLiteEventLog) Ack(userID int64, deviceID string, seq int64, now time.Time) error {
+	return data_access.AckUserEvents(userID, deviceID, seq, now)
+}
+
+// withSeq adds "seq" as the first field of an encoded JSON object. Other
+// values are returned unchanged.
+func withSeq(msg []byte, seq int64) []byte {
+	if len(msg) < 2 || msg[0] != '{' {
+		return msg
+	}
+	out := make([]byte, 0, len(msg)+24)
+	out = append(out, `{"seq":`...)
+	out = strconv.AppendInt(out, seq, 10)
+	if rest := bytes.TrimSpace(msg[1:]); len(rest) > 0 && rest[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, msg[1:]...)
+}
+
+// seqOf returns the sequence number of an event encoded by withSeq, or 0.
+func seqOf(msg []byte) int64 {
+	var v struct {
+		Seq int64 `json:"seq"`
+	}
+	json.Unmarshal(msg, &v)
+	return v.Seq
+}
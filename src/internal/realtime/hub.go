@@ -1,47 +1,449 @@
 package realtime
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/realtime/protocol"
 
 	"github.com/gorilla/websocket"
 )
 
+// Connection is one WebSocket of a user. A user may hold several, one per
+// device; ID tells them apart. Frames are written by the connection's own
+// write pump, fed through a bounded send buffer.
 type Connection struct {
 	UserID int64
+	ID     string
 	Conn   *websocket.Conn
+
+	hub       *Hub
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// While the connection replays missed events, live ones wait in pending
+	// so the client sees them in sequence order.
+	mu        sync.Mutex
+	replaying bool
+	pending   [][]byte
 }
 
+// Hub tracks the WebSocket connections held by this instance. With a
+// Broker set, events for users connected to other instances are routed to
+// those instances, found through Presence. With an EventLog set, every
+// event is logged and numbered first, so clients can resume after being
+// offline.
 type Hub struct {
-	clients map[int64]*Connection
+	clients map[int64]map[string]*Connection
 	mu      sync.RWMutex
+
+	// present holds the users this instance has recorded in Presence;
+	// presenceLocks serialize each user's presence transitions. Both are
+	// guarded by mu.
+	present       map[int64]bool
+	presenceLocks map[int64]*presenceLock
+
+	// SendBuffer is the number of frames queued per connection before
+	// SlowConsumer applies.
+	SendBuffer   int
+	SlowConsumer SlowConsumerPolicy
+
+	InstanceID string
+	Broker     Broker
+	Presence   Presence
+
+	Events EventLog
+
+	// OnPresence, if set, is called when a user comes online (their first
+	// connection to any instance) or goes offline (their last one closed).
+	OnPresence func(userID int64, online bool)
+}
+
+// NewHub creates an empty single-instance hub that disconnects slow
+// consumers.
+func NewHub() *Hub {
+	return &Hub{
+		clients:       make(map[int64]map[string]*Connection),
+		present:       make(map[int64]bool),
+		presenceLocks: make(map[int64]*presenceLock),
+		SendBuffer:    64,
+		InstanceID:    "local",
+		Presence:      NewMemoryPresence(),
+	}
+}
+
+var ChatHub = NewHub()
+
+// Add registers a connection of the user under connID and starts its write
+// pump. A previous connection with the same id (the same device
+// reconnecting) is closed and replaced; the user's other connections are
+// untouched.
+func (h *Hub) Add(userID int64, connID string, conn *websocket.Conn) *Connection {
+	h.register(userID, connID, -1)
+	return h.add(userID, connID, conn, false)
 }
 
-var ChatHub = &Hub{
-	clients: make(map[int64]*Connection),
+// Resume registers a connection like Add, then sends it the logged events
+// after lastSeq followed by any live events that arrived meanwhile. If
+// events after lastSeq were dropped from the log, a "resync" frame comes
+// first. Without an EventLog it behaves like Add.
+func (h *Hub) Resume(userID int64, connID string, conn *websocket.Conn, lastSeq int64) (*Connection, error) {
+	if h.Events == nil {
+		return h.Add(userID, connID, conn), nil
+	}
+	h.register(userID, connID, lastSeq)
+	c := h.add(userID, connID, conn, true)
+	events, complete, err := h.Events.Since(userID, lastSeq)
+	if err == nil && !complete {
+		msg, _ := protocol.Encode(protocol.Resync{})
+		select {
+		case c.send <- msg:
+		case <-c.done:
+			return c, nil
+		}
+	}
+
+	// the pump is running, so a long backlog is written as fast as the
+	// client reads instead of overflowing the send buffer
+	var sent int64
+	for _, e := range events {
+		select {
+		case c.send <- withSeq(e.Payload, e.Seq):
+			sent = e.Seq
+		case <-c.done:
+			return c, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range c.pending {
+		if seq := seqOf(msg); seq == 0 || seq > sent {
+			c.enqueue(msg)
+		}
+	}
+	c.pending, c.replaying = nil, false
+	return c, err
 }
 
-func (h *Hub) Add(userID int64, conn *websocket.Conn) {
+// Ack tells the event log that the user's device connID has received
+// events up to seq.
+func (h *Hub) Ack(userID int64, connID string, seq int64) error {
+	if h.Events == nil {
+		return nil
+	}
+	return h.Events.Ack(userID, connID, seq, time.Now())
+}
+
+// register tells the event log that the user's device connID is connected
+// with the events up to seq, so other devices' acks don't trim what it has
+// yet to receive. A negative seq starts it at the end of the log.
+func (h *Hub) register(userID int64, connID string, seq int64) {
+	if h.Events == nil {
+		return
+	}
+	if err := h.Events.Register(userID, connID, seq, time.Now()); err != nil {
+		logging.Log.Errorf("realtime: event log register failed user=%d device=%s: %v", userID, connID, err)
+	}
+}
+
+func (h *Hub) add(userID int64, connID string, conn *websocket.Conn, replaying bool) *Connection {
+	c := &Connection{
+		UserID: userID,
+		ID:     connID,
+		Conn:   conn,
+		hub:    h,
+		send:   make(chan []byte, h.SendBuffer),
+		done:   make(chan struct{}),
+
+		replaying: replaying,
+	}
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.clients[userID] = &Connection{UserID: userID, Conn: conn}
+	conns, ok := h.clients[userID]
+	if !ok {
+		conns = make(map[string]*Connection)
+		h.clients[userID] = conns
+	}
+	old := conns[connID]
+	conns[connID] = c
+	h.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+	if !ok {
+		h.syncPresence(userID)
+	}
+	go c.writePump()
+	return c
 }
 
-func (h *Hub) Remove(userID int64) {
+// Remove unregisters the connection and stops its write pump, which closes
+// the socket. It is a no-op for the hub if the connection was already
+// replaced by a newer one with the same id.
+func (h *Hub) Remove(c *Connection) {
+	last := false
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	if c, ok := h.clients[userID]; ok {
-		c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		c.Conn.Close()
-		delete(h.clients, userID)
+	if conns, ok := h.clients[c.UserID]; ok && conns[c.ID] == c {
+		delete(conns, c.ID)
+		if len(conns) == 0 {
+			delete(h.clients, c.UserID)
+			last = true
+		}
+	}
+	h.mu.Unlock()
+
+	c.close()
+	if last {
+		h.syncPresence(c.UserID)
 	}
 }
 
-func (h *Hub) SendToUser(userID int64, data interface{}) error {
+// presenceLock is a per-user mutex, dropped when nobody holds or waits for
+// it.
+type presenceLock struct {
+	sync.Mutex
+	refs int
+}
+
+// syncPresence records the user in Presence as online if this instance
+// holds connections of theirs and as offline otherwise, and calls
+// OnPresence unless another instance keeps them online. Transitions of a
+// user are serialized and go by the connections at that moment, so a
+// Remove of the last connection racing a new Add can't leave a connected
+// user recorded offline.
+func (h *Hub) syncPresence(userID int64) {
+	h.mu.Lock()
+	l := h.presenceLocks[userID]
+	if l == nil {
+		l = &presenceLock{}
+		h.presenceLocks[userID] = l
+	}
+	l.refs++
+	h.mu.Unlock()
+
+	l.Lock()
+	defer func() {
+		l.Unlock()
+		h.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(h.presenceLocks, userID)
+		}
+		h.mu.Unlock()
+	}()
+
 	h.mu.RLock()
-	conn, ok := h.clients[userID]
+	_, online := h.clients[userID]
+	recorded := h.present[userID]
 	h.mu.RUnlock()
-	if !ok {
-		return nil // user offline
+	if online == recorded {
+		return
 	}
-	return conn.Conn.WriteJSON(data)
-}
\ No newline at end of file
+
+	h.setPresence(userID, online)
+	h.mu.Lock()
+	if online {
+		h.present[userID] = true
+	} else {
+		delete(h.present, userID)
+	}
+	h.mu.Unlock()
+	if h.OnPresence != nil && !h.onlineElsewhere(userID) {
+		h.OnPresence(userID, online)
+	}
+}
+
+// onlineElsewhere reports whether another instance holds connections of
+// the user. Lookup errors count as no.
+func (h *Hub) onlineElsewhere(userID int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+	instances, err := h.Presence.Instances(ctx, userID)
+	if err != nil {
+		logging.Log.Errorf("realtime: presence lookup failed user=%d: %v", userID, err)
+		return false
+	}
+	for _, id := range instances {
+		if id != h.InstanceID {
+			return true
+		}
+	}
+	return false
+}
+
+// Online reports which of the users are connected to any instance.
+func (h *Hub) Online(ctx context.Context, userIDs []int64) (map[int64]bool, error) {
+	out := make(map[int64]bool, len(userIDs))
+	for _, id := range userIDs {
+		instances, err := h.Presence.Instances(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		out[id] = len(instances) > 0
+	}
+	return out, nil
+}
+
+// LocalUsers returns the users with connections to this instance.
+func (h *Hub) LocalUsers() []int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	users := make([]int64, 0, len(h.clients))
+	for id := range h.clients {
+		users = append(users, id)
+	}
+	return users
+}
+
+func (h *Hub) setPresence(userID int64, online bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+	var err error
+	if online {
+		err = h.Presence.Add(ctx, userID, h.InstanceID)
+	} else {
+		err = h.Presence.Remove(ctx, userID, h.InstanceID)
+	}
+	if err != nil {
+		logging.Log.Errorf("realtime: presence update failed user=%d online=%v: %v", userID, online, err)
+	}
+}
+
+func (c *Connection) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// Connections returns a snapshot of all registered connections.
+func (h *Hub) Connections() []*Connection {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var out []*Connection
+	for _, conns := range h.clients {
+		for _, c := range conns {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// SendToUser queues an event for every connection of the
+// user, and with a Broker also publishes it to the other instances the user
+// is connected to. Local delivery never blocks on the network; an offline
+// user is not an error. With an EventLog the event is logged first and
+// carries its sequence number as "seq"; if logging fails it is still
+// delivered, unnumbered.
+func (h *Hub) SendToUser(userID int64, event protocol.Frame) error {
+	return h.send(userID, event, true)
+}
+
+// SendEphemeral delivers an event like SendToUser but never logs it, for
+// events only worth seeing live, such as typing and presence. It arrives
+// without "seq" and isn't replayed.
+func (h *Hub) SendEphemeral(userID int64, event protocol.Frame) error {
+	return h.send(userID, event, false)
+}
+
+func (h *Hub) send(userID int64, event protocol.Frame, logged bool) error {
+	msg, err := protocol.Encode(event)
+	if err != nil {
+		return err
+	}
+	if logged && h.Events != nil {
+		seq, err := h.Events.Append(userID, msg, time.Now())
+		if err != nil {
+			logging.Log.Errorf("realtime: event log append failed user=%d: %v", userID, err)
+		} else {
+			msg = withSeq(msg, seq)
+		}
+	}
+	h.deliver(userID, msg)
+
+	if h.Broker == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+	instances, err := h.Presence.Instances(ctx, userID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, id := range instances {
+		if id == h.InstanceID {
+			continue
+		}
+		if err := h.Broker.Publish(ctx, id, userID, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver queues an encoded event for the user's local connections.
+func (h *Hub) deliver(userID int64, msg []byte) {
+	h.mu.RLock()
+	conns := make([]*Connection, 0, len(h.clients[userID]))
+	for _, c := range h.clients[userID] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range conns {
+		c.push(msg)
+	}
+}
+
+// Send queues a frame for this connection only, such as the reply to a
+// frame it sent. Replies are not logged.
+func (c *Connection) Send(f protocol.Frame) error {
+	msg, err := protocol.Encode(f)
+	if err != nil {
+		return err
+	}
+	c.push(msg)
+	return nil
+}
+
+// push queues a live event, holding it back while the connection replays.
+func (c *Connection) push(msg []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replaying {
+		c.pending = append(c.pending, msg)
+		return
+	}
+	c.enqueue(msg)
+}
+
+// Start subscribes the hub to events routed to its instance and keeps its
+// presence entries fresh until ctx is done. Without a Broker it does
+// nothing.
+func (h *Hub) Start(ctx context.Context) error {
+	if h.Broker == nil {
+		return nil
+	}
+	if err := h.Broker.Subscribe(ctx, h.InstanceID, h.deliver); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(presenceTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, id := range h.LocalUsers() {
+					h.setPresence(id, true)
+				}
+			}
+		}
+	}()
+	return nil
+}
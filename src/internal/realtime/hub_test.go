@@ -0,0 +1,542 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/metrics"
+	"dating-backend/internal/models"
+	"dating-backend/internal/realtime/protocol"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// testServer upgrades every request and hands the server side of the
+// connection to the test; the client side is returned by dial.
+type testServer struct {
+	*httptest.Server
+	conns chan *websocket.Conn
+}
+
+func newTestServer(t *testing.T) *testServer {
+	logging.Log = zap.NewNop().Sugar()
+	ts := &testServer{conns: make(chan *websocket.Conn, 8)}
+	upgrader := websocket.Upgrader{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		ts.conns <- c
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) dial(t *testing.T) (client, server *websocket.Conn) {
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, <-ts.conns
+}
+
+func readEvent(t *testing.T, c *websocket.Conn) map[string]any {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var v map[string]any
+	if err := c.ReadJSON(&v); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return v
+}
+
+func TestHubFansOutToEveryDevice(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+
+	phone, phoneSrv := ts.dial(t)
+	laptop, laptopSrv := ts.dial(t)
+	phoneConn := hub.Add(1, "phone", phoneSrv)
+	hub.Add(1, "laptop", laptopSrv)
+
+	if err := hub.SendToUser(1, protocol.MatchEvent{}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	for _, c := range []*websocket.Conn{phone, laptop} {
+		if ev := readEvent(t, c); ev["type"] != "match" {
+			t.Fatalf("unexpected event %v", ev)
+		}
+	}
+
+	hub.Remove(phoneConn)
+	if err := hub.SendToUser(1, protocol.TypingEvent{}); err != nil {
+		t.Fatalf("send after remove: %v", err)
+	}
+	if ev := readEvent(t, laptop); ev["type"] != "typing" {
+		t.Fatalf("expected laptop to stay connected, got %v", ev)
+	}
+	if n := len(hub.Connections()); n != 1 {
+		t.Fatalf("expected 1 connection left, got %d", n)
+	}
+}
+
+func TestHubReplacesSameDevice(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+
+	_, oldSrv := ts.dial(t)
+	newClient, newSrv := ts.dial(t)
+	old := hub.Add(1, "phone", oldSrv)
+	hub.Add(1, "phone", newSrv)
+
+	// the replaced connection's handler exits and removes it; that must not
+	// drop the new one
+	hub.Remove(old)
+	hub.SendToUser(1, protocol.MatchEvent{})
+	if ev := readEvent(t, newClient); ev["type"] != "match" {
+		t.Fatalf("unexpected event %v", ev)
+	}
+	if n := len(hub.Connections()); n != 1 {
+		t.Fatalf("expected 1 connection, got %d", n)
+	}
+}
+
+func TestHubConcurrentUse(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+
+	const devices = 4
+	clients := make([]*websocket.Conn, devices)
+	for i := range clients {
+		var srv *websocket.Conn
+		clients[i], srv = ts.dial(t)
+		hub.Add(1, string(rune('a'+i)), srv)
+	}
+
+	const sends = 50
+	var readers sync.WaitGroup
+	for _, c := range clients {
+		readers.Add(1)
+		go func(c *websocket.Conn) {
+			defer readers.Done()
+			for i := 0; i < sends; i++ {
+				c.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if _, _, err := c.ReadMessage(); err != nil {
+					t.Errorf("read %d: %v", i, err)
+					return
+				}
+			}
+		}(c)
+	}
+
+	var senders sync.WaitGroup
+	for i := 0; i < sends; i++ {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			hub.SendToUser(1, protocol.TypingEvent{})
+			hub.Connections()
+		}()
+	}
+	senders.Wait()
+	readers.Wait()
+}
+
+// stalled registers a connection whose write pump isn't running, as if the
+// client stopped reading.
+func stalled(h *Hub, userID int64) *Connection {
+	c := &Connection{UserID: userID, ID: "stalled", hub: h,
+		send: make(chan []byte, h.SendBuffer), done: make(chan struct{})}
+	h.clients[userID] = map[string]*Connection{c.ID: c}
+	return c
+}
+
+func TestSlowConsumerPolicy(t *testing.T) {
+	logging.Log = zap.NewNop().Sugar()
+
+	h := NewHub()
+	h.SendBuffer = 1
+	h.SlowConsumer = DropMessages
+	c := stalled(h, 1)
+	dropped := metrics.WSDropped.Value()
+	h.SendToUser(1, protocol.TypingEvent{ChatID: 1})
+	h.SendToUser(1, protocol.TypingEvent{ChatID: 2})
+	if got := metrics.WSDropped.Value() - dropped; got != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", got)
+	}
+	if len(h.Connections()) != 1 || string(<-c.send) != `{"type":"typing","chat_id":1,"user_id":0}` {
+		t.Fatalf("expected connection kept with the first event queued")
+	}
+
+	h = NewHub()
+	h.SendBuffer = 1
+	c = stalled(h, 1)
+	h.SendToUser(1, protocol.TypingEvent{ChatID: 1})
+	h.SendToUser(1, protocol.TypingEvent{ChatID: 2})
+	if len(h.Connections()) != 0 {
+		t.Fatalf("expected slow connection removed")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatalf("expected slow connection closed")
+	}
+}
+
+func TestHubRoutesAcrossInstances(t *testing.T) {
+	ts := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker, presence := NewMemoryBroker(), NewMemoryPresence()
+	newInstance := func(id string) *Hub {
+		h := NewHub()
+		h.InstanceID, h.Broker, h.Presence = id, broker, presence
+		if err := h.Start(ctx); err != nil {
+			t.Fatalf("start %s: %v", id, err)
+		}
+		return h
+	}
+	a, b := newInstance("a"), newInstance("b")
+
+	client, srv := ts.dial(t)
+	conn := b.Add(1, "phone", srv)
+
+	// sent on instance a, where user 1 has no connections
+	if err := a.SendToUser(1, protocol.MatchEvent{}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if ev := readEvent(t, client); ev["type"] != "match" {
+		t.Fatalf("unexpected event %v", ev)
+	}
+
+	b.Remove(conn)
+	if ids, _ := presence.Instances(ctx, 1); len(ids) != 0 {
+		t.Fatalf("expected presence cleared after last connection, got %v", ids)
+	}
+}
+
+// memEventLog is an in-memory EventLog.
+type memEventLog struct {
+	mu     sync.Mutex
+	events map[int64][]models.UserEvent
+	seqs   map[int64]int64
+	acks   map[int64]map[string]int64
+}
+
+func newMemEventLog() *memEventLog {
+	return &memEventLog{events: map[int64][]models.UserEvent{}, seqs: map[int64]int64{}, acks: map[int64]map[string]int64{}}
+}
+
+func (l *memEventLog) Append(userID int64, msg []byte, now time.Time) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seqs[userID]++
+	l.events[userID] = append(l.events[userID], models.UserEvent{Seq: l.seqs[userID], Payload: msg, CreatedAt: now})
+	return l.seqs[userID], nil
+}
+
+func (l *memEventLog) Since(userID, seq int64) ([]models.UserEvent, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []models.UserEvent
+	for _, e := range l.events[userID] {
+		if e.Seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out, int64(len(out)) == l.seqs[userID]-seq, nil
+}
+
+func (l *memEventLog) Register(userID int64, deviceID string, seq int64, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.acks[userID] == nil {
+		l.acks[userID] = map[string]int64{}
+	}
+	if seq < 0 {
+		seq = l.seqs[userID]
+	}
+	l.acks[userID][deviceID] = max(l.acks[userID][deviceID], seq)
+	return nil
+}
+
+func (l *memEventLog) Ack(userID int64, deviceID string, seq int64, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.acks[userID] == nil {
+		l.acks[userID] = map[string]int64{}
+	}
+	l.acks[userID][deviceID] = max(l.acks[userID][deviceID], seq)
+	low := seq
+	for _, s := range l.acks[userID] {
+		low = min(low, s)
+	}
+	var kept []models.UserEvent
+	for _, e := range l.events[userID] {
+		if e.Seq > low {
+			kept = append(kept, e)
+		}
+	}
+	l.events[userID] = kept
+	return nil
+}
+
+func TestHubPresenceAcrossInstances(t *testing.T) {
+	ts := newTestServer(t)
+	presence := NewMemoryPresence()
+	var events []bool
+	newInstance := func(id string) *Hub {
+		h := NewHub()
+		h.InstanceID, h.Presence = id, presence
+		h.OnPresence = func(userID int64, online bool) { events = append(events, online) }
+		return h
+	}
+	a, b := newInstance("a"), newInstance("b")
+
+	_, srvA := ts.dial(t)
+	_, srvB := ts.dial(t)
+	connA := a.Add(1, "phone", srvA)
+	connB := b.Add(1, "laptop", srvB)
+	a.Remove(connA)
+	if len(events) != 1 || !events[0] {
+		t.Fatalf("expected a single online event while connected elsewhere, got %v", events)
+	}
+
+	b.Remove(connB)
+	if len(events) != 2 || events[1] {
+		t.Fatalf("expected offline after the last connection, got %v", events)
+	}
+}
+
+// gatedPresence holds Remove until release is closed, so a test can
+// reconnect a user while their last connection is being removed.
+type gatedPresence struct {
+	*MemoryPresence
+	added             chan struct{}
+	removing, release chan struct{}
+}
+
+func (p *gatedPresence) Add(ctx context.Context, userID int64, instanceID string) error {
+	err := p.MemoryPresence.Add(ctx, userID, instanceID)
+	select {
+	case p.added <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+func (p *gatedPresence) Remove(ctx context.Context, userID int64, instanceID string) error {
+	close(p.removing)
+	<-p.release
+	return p.MemoryPresence.Remove(ctx, userID, instanceID)
+}
+
+func TestHubPresenceSurvivesReconnectDuringRemove(t *testing.T) {
+	ts := newTestServer(t)
+	presence := &gatedPresence{
+		MemoryPresence: NewMemoryPresence(),
+		added:          make(chan struct{}, 1),
+		removing:       make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+	hub := NewHub()
+	hub.Presence = presence
+	var mu sync.Mutex
+	var events []bool
+	hub.OnPresence = func(_ int64, online bool) {
+		mu.Lock()
+		events = append(events, online)
+		mu.Unlock()
+	}
+
+	_, srv := ts.dial(t)
+	old := hub.Add(1, "phone", srv)
+	<-presence.added
+
+	removed := make(chan struct{})
+	go func() {
+		hub.Remove(old)
+		close(removed)
+	}()
+	<-presence.removing
+
+	// the phone reconnects while its old connection is recorded offline;
+	// give the new one a chance to record itself online first
+	_, srv = ts.dial(t)
+	added := make(chan struct{})
+	go func() {
+		hub.Add(1, "phone", srv)
+		close(added)
+	}()
+	select {
+	case <-presence.added:
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(presence.release)
+	<-removed
+	<-added
+
+	online, err := hub.Online(context.Background(), []int64{1})
+	if err != nil || !online[1] {
+		t.Fatalf("expected the reconnected user online, got %v %v", online, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) == 0 || !events[len(events)-1] {
+		t.Fatalf("expected the last presence event to be online, got %v", events)
+	}
+}
+
+func TestHubConcurrentReconnects(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+	const n = 20
+	servers := make([]*websocket.Conn, n)
+	for i := range servers {
+		_, servers[i] = ts.dial(t)
+	}
+
+	// every connection but the last is removed while the next one is added
+	var wg sync.WaitGroup
+	prev := hub.Add(1, "phone", servers[0])
+	for i := 1; i < n; i++ {
+		wg.Add(2)
+		go func(c *Connection) {
+			defer wg.Done()
+			hub.Remove(c)
+		}(prev)
+		next := make(chan *Connection, 1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			next <- hub.Add(1, "tablet", conn)
+		}(servers[i])
+		prev = <-next
+	}
+	wg.Wait()
+
+	online, err := hub.Online(context.Background(), []int64{1})
+	if err != nil || !online[1] {
+		t.Fatalf("expected the user online with a connection left, got %v %v", online, err)
+	}
+}
+
+func TestHubResumesFromLastSeq(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+	events := newMemEventLog()
+	hub.Events = events
+
+	// sent while the user is offline
+	for _, ev := range []protocol.Frame{protocol.MatchEvent{}, protocol.MessageEvent{}, protocol.ReadChatEvent{}} {
+		if err := hub.SendToUser(1, ev); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	client, srv := ts.dial(t)
+	if _, err := hub.Resume(1, "phone", srv, 1); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	hub.SendToUser(1, protocol.MatchEvent{})
+
+	for i, want := range []string{"message", "read_chat", "match"} {
+		ev := readEvent(t, client)
+		if ev["type"] != want || ev["seq"] != float64(i+2) {
+			t.Fatalf("event %d: expected %s with seq %d, got %v", i, want, i+2, ev)
+		}
+	}
+
+	// trimmed only once every device acked
+	if err := hub.Ack(1, "laptop", 2); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := hub.Ack(1, "phone", 3); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if left, _, _ := events.Since(1, 0); len(left) != 2 || left[0].Seq != 3 {
+		t.Fatalf("expected events the laptop didn't ack kept, got %v", left)
+	}
+	hub.Ack(1, "laptop", 3)
+	if left, _, _ := events.Since(1, 0); len(left) != 1 || left[0].Seq != 4 {
+		t.Fatalf("expected acked events trimmed, got %v", left)
+	}
+}
+
+func TestHubResyncsPastTrimmedEvents(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+	events := newMemEventLog()
+	hub.Events = events
+
+	for range 3 {
+		hub.SendToUser(1, protocol.MatchEvent{})
+	}
+	hub.Ack(1, "phone", 2)
+
+	// the laptop last saw seq 1, but 2 is gone
+	client, srv := ts.dial(t)
+	if _, err := hub.Resume(1, "laptop", srv, 1); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if ev := readEvent(t, client); ev["type"] != "resync" {
+		t.Fatalf("expected resync first, got %v", ev)
+	}
+	if ev := readEvent(t, client); ev["type"] != "match" || ev["seq"] != float64(3) {
+		t.Fatalf("expected the retained event replayed, got %v", ev)
+	}
+
+	// nothing missing: no resync
+	client, srv = ts.dial(t)
+	hub.Resume(1, "phone", srv, 2)
+	if ev := readEvent(t, client); ev["type"] != "match" || ev["seq"] != float64(3) {
+		t.Fatalf("expected the replay without resync, got %v", ev)
+	}
+}
+
+func TestHubEphemeralEventsAreNotLogged(t *testing.T) {
+	ts := newTestServer(t)
+	hub := NewHub()
+	events := newMemEventLog()
+	hub.Events = events
+
+	client, srv := ts.dial(t)
+	hub.Add(1, "phone", srv)
+	if err := hub.SendEphemeral(1, protocol.TypingEvent{ChatID: 7}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	ev := readEvent(t, client)
+	if ev["type"] != "typing" || ev["seq"] != nil {
+		t.Fatalf("expected an unnumbered typing event, got %v", ev)
+	}
+	if logged, _, _ := events.Since(1, 0); len(logged) != 0 {
+		t.Fatalf("expected nothing logged, got %v", logged)
+	}
+}
+
+func TestWithSeq(t *testing.T) {
+	cases := map[string]string{
+		`{"type":"match"}`: `{"seq":7,"type":"match"}`,
+		`{}`:               `{"seq":7}`,
+		`"text"`:           `"text"`,
+	}
+	for in, want := range cases {
+		if got := string(withSeq([]byte(in), 7)); got != want {
+			t.Errorf("withSeq(%s) = %s, want %s", in, got, want)
+		}
+	}
+	if seqOf([]byte(`{"seq":7,"type":"match"}`)) != 7 {
+		t.Errorf("expected seqOf to read the sequence back")
+	}
+}
@@ -0,0 +1,69 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+)
+
+// LastSeen writes users' last_active time, at most once per MinInterval per
+// user so that reconnect storms and the periodic refresh of connected users
+// don't turn into a write per event.
+type LastSeen struct {
+	MinInterval time.Duration
+
+	mu      sync.Mutex
+	written map[int64]time.Time
+}
+
+func NewLastSeen(minInterval time.Duration) *LastSeen {
+	return &LastSeen{MinInterval: minInterval, written: make(map[int64]time.Time)}
+}
+
+// Touch records that the users were seen at now, skipping those written
+// less than MinInterval ago.
+func (l *LastSeen) Touch(now time.Time, userIDs ...int64) error {
+	l.mu.Lock()
+	var due []int64
+	for _, id := range userIDs {
+		if t, ok := l.written[id]; ok && now.Sub(t) < l.MinInterval {
+			continue
+		}
+		l.written[id] = now
+		due = append(due, id)
+	}
+	// forget users not written for a while, so the map doesn't keep every
+	// user ever seen
+	for id, t := range l.written {
+		if now.Sub(t) >= l.MinInterval {
+			delete(l.written, id)
+		}
+	}
+	l.mu.Unlock()
+
+	return data_access.SetLastActive(due, now)
+}
+
+// Start touches the users returned by connected every interval until ctx
+// is done. Each instance refreshes its own connections, so this runs in
+// every process rather than as a scheduler job, which only one instance
+// would pick up.
+func (l *LastSeen) Start(ctx context.Context, interval time.Duration, connected func() []int64) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := l.Touch(now, connected()...); err != nil {
+					logging.Log.Errorf("realtime: last-seen update failed: %v", err)
+				}
+			}
+		}
+	}()
+}
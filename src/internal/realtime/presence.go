@@ -0,0 +1,106 @@
+package realtime
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// presenceTTL is how long an instance's claim on a user lasts without a
+// refresh, so users of a crashed instance don't stay "present" forever.
+const presenceTTL = 90 * time.Second
+
+// Presence records which instances hold connections of which users.
+type Presence interface {
+	// Add marks the user as connected to the instance, or refreshes the mark.
+	Add(ctx context.Context, userID int64, instanceID string) error
+	Remove(ctx context.Context, userID int64, instanceID string) error
+	// Instances lists the instances the user is connected to.
+	Instances(ctx context.Context, userID int64) ([]string, error)
+}
+
+// In-memory implementation -------------------------------------------------
+type MemoryPresence struct {
+	mu sync.RWMutex
+	m  map[int64]map[string]bool
+}
+
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{m: make(map[int64]map[string]bool)}
+}
+
+func (p *MemoryPresence) Add(_ context.Context, userID int64, instanceID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.m[userID] == nil {
+		p.m[userID] = make(map[string]bool)
+	}
+	p.m[userID][instanceID] = true
+	return nil
+}
+
+func (p *MemoryPresence) Remove(_ context.Context, userID int64, instanceID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.m[userID], instanceID)
+	if len(p.m[userID]) == 0 {
+		delete(p.m, userID)
+	}
+	return nil
+}
+
+func (p *MemoryPresence) Instances(_ context.Context, userID int64) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]string, 0, len(p.m[userID]))
+	for id := range p.m[userID] {
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// Redis-backed implementation ----------------------------------------------
+// A hash per user maps instance ids to the unix time their claim expires.
+type RedisPresence struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+func NewRedisPresence(opts *redis.Options) *RedisPresence {
+	return &RedisPresence{client: redis.NewClient(opts), now: time.Now}
+}
+
+func presenceKey(userID int64) string {
+	return "presence:user:" + strconv.FormatInt(userID, 10)
+}
+
+func (r *RedisPresence) Add(ctx context.Context, userID int64, instanceID string) error {
+	key := presenceKey(userID)
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, key, instanceID, r.now().Add(presenceTTL).Unix())
+	pipe.Expire(ctx, key, presenceTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisPresence) Remove(ctx context.Context, userID int64, instanceID string) error {
+	return r.client.HDel(ctx, presenceKey(userID), instanceID).Err()
+}
+
+func (r *RedisPresence) Instances(ctx context.Context, userID int64) ([]string, error) {
+	fields, err := r.client.HGetAll(ctx, presenceKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := r.now().Unix()
+	out := make([]string, 0, len(fields))
+	for id, exp := range fields {
+		if t, err := strconv.ParseInt(exp, 10, 64); err == nil && t > now {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Typing tells the other participant of a chat that the user is typing.
+type Typing struct {
+	ChatID     int64 `json:"chat_id"`
+	ReceiverID int64 `json:"receiver_id"`
+}
+
+func (Typing) FrameType() string { return "typing" }
+
+func (f *Typing) Validate() error {
+	if f.ChatID <= 0 || f.ReceiverID <= 0 {
+		return errors.New("chat_id and receiver_id are required")
+	}
+	return nil
+}
+
+// Delivered tells the sender of a message that it reached the user's
+// device. Only the receiver of the message may send it; the chat and the
+// sender are taken from the stored message.
+type Delivered struct {
+	MessageID int64 `json:"message_id"`
+	// ChatID and ReceiverID are ignored; older clients still send them.
+	ChatID     int64 `json:"chat_id,omitempty"`
+	ReceiverID int64 `json:"receiver_id,omitempty"`
+}
+
+func (Delivered) FrameType() string { return "delivered" }
+
+func (f *Delivered) Validate() error {
+	if f.MessageID <= 0 {
+		return errors.New("message_id is required")
+	}
+	return nil
+}
+
+// SendMessage sends a chat message, like POST /messages/send. ClientID is
+// chosen by the client and makes resending safe: a message with a
+// ClientID the user already used is acked again but not stored twice.
+// The receiver is the other person in the chat; ReceiverID is ignored.
+type SendMessage struct {
+	ClientID      string  `json:"client_id"`
+	ChatID        int64   `json:"chat_id"`
+	ReceiverID    int64   `json:"receiver_id,omitempty"`
+	Content       string  `json:"content"`
+	AttachmentIDs []int64 `json:"attachment_ids,omitempty"`
+}
+
+func (SendMessage) FrameType() string { return "send_message" }
+
+func (f *SendMessage) Validate() error {
+	if f.ClientID == "" {
+		return errors.New("client_id is required")
+	}
+	return nil
+}
+
+// SeqAck confirms that the client's device received the events up to Seq;
+// once every device of the user did, the server drops them from its log.
+type SeqAck struct {
+	Seq int64 `json:"seq"`
+}
+
+func (SeqAck) FrameType() string { return "ack" }
+
+func (f *SeqAck) Validate() error {
+	if f.Seq <= 0 {
+		return errors.New("seq must be positive")
+	}
+	return nil
+}
+
+// ClientFrames are the frames a client may send.
+var ClientFrames = []Def{
+	{func() Frame { return &Typing{} }, "The user is typing in a chat."},
+	{func() Frame { return &Delivered{} }, "A message reached the user's device."},
+	{func() Frame { return &SendMessage{} }, "Send a chat message; answered with an ack carrying the stored message."},
+	{func() Frame { return &SeqAck{} }, "The client received all events up to seq."},
+}
+
+// Envelope holds the fields common to all client frames.
+type Envelope struct {
+	Type string `json:"type"`
+	// ID is an optional client-chosen request id, echoed in the reply.
+	ID string `json:"id,omitempty"`
+}
+
+// Decode parses a client frame. On failure it returns the envelope read so
+// far, so the error reply can carry the request id.
+func Decode(data []byte) (Envelope, Frame, *Error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return env, nil, &Error{Code: CodeBadFrame, Message: "frame is not a JSON object"}
+	}
+	if env.Type == "" {
+		return env, nil, &Error{ID: env.ID, Code: CodeBadFrame, Message: "missing type"}
+	}
+
+	for _, d := range ClientFrames {
+		f := d.New()
+		if f.FrameType() != env.Type {
+			continue
+		}
+		if err := json.Unmarshal(data, f); err != nil {
+			return env, nil, &Error{ID: env.ID, Code: CodeInvalid, Message: fmt.Sprintf("%s: %v", env.Type, err)}
+		}
+		if v, ok := f.(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return env, nil, &Error{ID: env.ID, Code: CodeInvalid, Message: fmt.Sprintf("%s: %v", env.Type, err)}
+			}
+		}
+		return env, f, nil
+	}
+	return env, nil, &Error{ID: env.ID, Code: CodeUnknownType, Message: fmt.Sprintf("unknown frame type %q", env.Type)}
+}
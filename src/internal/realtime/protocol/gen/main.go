@@ -0,0 +1,34 @@
+// Command gen writes the JSON Schema docs of the WebSocket protocol.
+//
+//	go generate ./internal/realtime/protocol
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"dating-backend/internal/realtime/protocol"
+)
+
+func main() {
+	out := flag.String("o", "docs/ws", "output directory")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	for name, build := range map[string]func() ([]byte, error){
+		"client.schema.json": protocol.ClientSchema,
+		"server.schema.json": protocol.ServerSchema,
+	} {
+		b, err := build()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(*out, name), append(b, '\n'), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package protocol defines the frames exchanged over /ws/chat.
+//
+// Every frame is a JSON object whose "type" field names it. Client frames
+// may carry a request "id"; the server answers such a frame with an "ack"
+// or an "error" frame echoing the id. Frames the server can't handle are
+// always answered with an "error" frame, with or without an id. Events the
+// server sends on its own also carry "seq", see realtime.EventLog, except
+// the ephemeral ones such as typing.
+//
+// The protocol is versioned through the WebSocket subprotocol: clients ask
+// for a version in Sec-WebSocket-Protocol and the server picks one it
+// supports. Clients that don't ask get the oldest version.
+package protocol
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// Version1 is the first protocol version: the flat frames documented in
+// this package.
+const Version1 = "dating.v1"
+
+// Supported lists the versions the server speaks, newest first.
+var Supported = []string{Version1}
+
+// Negotiate picks the protocol version for a connection from the
+// subprotocols requested by the client. ok is false if the client asked
+// only for versions the server doesn't speak.
+func Negotiate(requested []string) (version string, ok bool) {
+	if len(requested) == 0 {
+		return Supported[len(Supported)-1], true
+	}
+	for _, v := range Supported {
+		if slices.Contains(requested, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Frame is any typed frame of the protocol.
+type Frame interface {
+	// FrameType is the value of the frame's "type" field.
+	FrameType() string
+}
+
+// Encode marshals a frame with its "type" as the first field.
+func Encode(f Frame) ([]byte, error) {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(body)+32)
+	out = append(out, `{"type":`...)
+	out = strconv.AppendQuote(out, f.FrameType())
+	if len(body) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, body[1:]...), nil
+}
+
+// Def describes one frame type for decoding and documentation.
+type Def struct {
+	New func() Frame
+	Doc string
+}
+
+func (d Def) Type() string { return d.New().FrameType() }
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	env, f, err := Decode([]byte(`{"type":"typing","id":"r1","chat_id":3,"receiver_id":7}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if typing, ok := f.(*Typing); !ok || env.ID != "r1" || typing.ChatID != 3 || typing.ReceiverID != 7 {
+		t.Fatalf("unexpected frame %#v env %#v", f, env)
+	}
+
+	cases := []struct {
+		frame string
+		code  string
+	}{
+		{`not json`, CodeBadFrame},
+		{`{"id":"r2"}`, CodeBadFrame},
+		{`{"type":"send_gift","id":"r2"}`, CodeUnknownType},
+		{`{"type":"typing","id":"r2","chat_id":"3"}`, CodeInvalid},
+		{`{"type":"delivered","id":"r2","chat_id":3,"receiver_id":7}`, CodeInvalid},
+		{`{"type":"ack","id":"r2"}`, CodeInvalid},
+	}
+	for _, c := range cases {
+		env, _, err := Decode([]byte(c.frame))
+		if err == nil || err.Code != c.code {
+			t.Errorf("%s: expected %s, got %v", c.frame, c.code, err)
+			continue
+		}
+		if env.ID != "" && err.ID != env.ID {
+			t.Errorf("%s: expected the error to echo id %q, got %q", c.frame, env.ID, err.ID)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	b, err := Encode(UnmatchedEvent{MatchID: 4, ChatID: 9})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if want := `{"type":"unmatched","match_id":4,"chat_id":9}`; string(b) != want {
+		t.Fatalf("got %s, want %s", b, want)
+	}
+	if b, _ := Encode(SuperlikeEvent{Action: "superlike"}); !bytes.HasPrefix(b, []byte(`{"type":"superlike",`)) {
+		t.Fatalf("unexpected superlike frame %s", b)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	if v, ok := Negotiate(nil); !ok || v != Version1 {
+		t.Fatalf("expected clients without a subprotocol to get %s, got %q", Version1, v)
+	}
+	if v, ok := Negotiate([]string{"dating.v9", Version1}); !ok || v != Version1 {
+		t.Fatalf("expected %s, got %q", Version1, v)
+	}
+	if _, ok := Negotiate([]string{"dating.v9"}); ok {
+		t.Fatalf("expected unsupported versions to be rejected")
+	}
+}
+
+// The checked-in docs must match the frame types; run go generate after
+// changing them.
+func TestSchemaDocsUpToDate(t *testing.T) {
+	for name, build := range map[string]func() ([]byte, error){
+		"client.schema.json": ClientSchema,
+		"server.schema.json": ServerSchema,
+	} {
+		want, err := build()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := os.ReadFile(filepath.Join("..", "..", "..", "..", "docs", "ws", name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(bytes.TrimSpace(got), want) {
+			t.Errorf("docs/ws/%s is stale, run go generate ./internal/realtime/protocol", name)
+		}
+	}
+}
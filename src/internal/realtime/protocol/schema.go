@@ -0,0 +1,148 @@
+package protocol
+
+//go:generate go run ./gen -o ../../../../docs/ws
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+// ClientSchema returns the JSON Schema of the frames clients send.
+func ClientSchema() ([]byte, error) {
+	g := newSchemaGen()
+	for _, d := range ClientFrames {
+		g.frame(d, map[string]any{
+			"id": map[string]any{"type": "string", "description": "Optional request id, echoed in the ack or error reply."},
+		})
+	}
+	return g.doc("Client frames (" + Version1 + ")")
+}
+
+// ServerSchema returns the JSON Schema of the frames the server sends.
+func ServerSchema() ([]byte, error) {
+	g := newSchemaGen()
+	for _, d := range ServerEvents {
+		g.frame(d, map[string]any{
+			"seq": map[string]any{"type": "integer", "description": "Position in the user's event log."},
+		})
+	}
+	for _, d := range EphemeralEvents {
+		g.frame(d, nil)
+	}
+	for _, d := range Replies {
+		g.frame(d, nil)
+	}
+	return g.doc("Server frames (" + Version1 + ")")
+}
+
+type schemaGen struct {
+	defs  map[string]any
+	oneOf []any
+}
+
+func newSchemaGen() *schemaGen {
+	return &schemaGen{defs: map[string]any{}}
+}
+
+// frame adds a frame type to the accepted alternatives. extra holds
+// optional properties beyond the frame's own fields.
+func (g *schemaGen) frame(d Def, extra map[string]any) {
+	f := d.New()
+	s := g.object(reflect.TypeOf(f).Elem())
+	s["description"] = d.Doc
+	props := s["properties"].(map[string]any)
+	props["type"] = map[string]any{"const": f.FrameType()}
+	for k, v := range extra {
+		props[k] = v
+	}
+	s["required"] = append([]string{"type"}, s["required"].([]string)...)
+
+	name := "frame." + f.FrameType()
+	g.defs[name] = s
+	g.oneOf = append(g.oneOf, map[string]any{"$ref": "#/$defs/" + name})
+}
+
+func (g *schemaGen) doc(title string) ([]byte, error) {
+	return json.MarshalIndent(map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   title,
+		"oneOf":   g.oneOf,
+		"$defs":   g.defs,
+	}, "", "  ")
+}
+
+func (g *schemaGen) typeOf(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.typeOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.typeOf(t.Elem())}
+	case reflect.Struct:
+		// named payload types (profiles etc.) are shared definitions
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// object describes a struct by its JSON fields. Fields without omitempty
+// or omitzero are required.
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	required := []string{}
+	g.fields(t, props, &required)
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.typeOf(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package protocol
+
+import (
+	"time"
+
+	"dating-backend/internal/models"
+)
+
+// MessageEvent is a new chat message for the receiver. The URLs of its
+// attachments expire; GET /attachments/{id} renews them.
+type MessageEvent struct {
+	ID          int64               `json:"id"`
+	ChatID      int64               `json:"chat_id"`
+	UserID      int64               `json:"user_id"` // отправитель
+	Content     string              `json:"content"`
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+}
+
+func (MessageEvent) FrameType() string { return "message" }
+
+// MessageEditedEvent tells both participants that the sender edited a
+// message.
+type MessageEditedEvent struct {
+	ID       int64     `json:"id"`
+	ChatID   int64     `json:"chat_id"`
+	UserID   int64     `json:"user_id"` // отправитель
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+func (MessageEditedEvent) FrameType() string { return "message_edited" }
+
+// MessageDeletedEvent tells that UserID deleted a message. A message
+// deleted for everyone reaches both participants and stays in the chat as
+// a tombstone; one deleted for UserID only reaches UserID's devices and
+// disappears.
+type MessageDeletedEvent struct {
+	ID          int64     `json:"id"`
+	ChatID      int64     `json:"chat_id"`
+	UserID      int64     `json:"user_id"`
+	ForEveryone bool      `json:"for_everyone"`
+	DeletedAt   time.Time `json:"deleted_at"`
+}
+
+func (MessageDeletedEvent) FrameType() string { return "message_deleted" }
+
+// TypingEvent tells the user that UserID is typing in the chat.
+type TypingEvent struct {
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (TypingEvent) FrameType() string { return "typing" }
+
+// DeliveredEvent tells the sender that UserID's device received the
+// message.
+type DeliveredEvent struct {
+	ChatID      int64     `json:"chat_id"`
+	UserID      int64     `json:"user_id"`
+	MessageID   int64     `json:"message_id"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+func (DeliveredEvent) FrameType() string { return "delivered" }
+
+// ReadChatEvent tells the user that UserID read the whole chat. It isn't
+// sent when UserID hides read receipts.
+type ReadChatEvent struct {
+	ChatID int64     `json:"chat_id"`
+	UserID int64     `json:"user_id"`
+	ReadAt time.Time `json:"read_at"`
+}
+
+func (ReadChatEvent) FrameType() string { return "read_chat" }
+
+// ReadMessagesEvent tells the user that UserID read some of the messages.
+// It isn't sent when UserID hides read receipts.
+type ReadMessagesEvent struct {
+	ChatID     int64     `json:"chat_id"`
+	UserID     int64     `json:"user_id"`
+	MessageIDs []int64   `json:"message_id"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+func (ReadMessagesEvent) FrameType() string { return "read_messages" }
+
+// LikeEvent tells the user someone liked them. User is blurred when the
+// user may not see who.
+type LikeEvent struct {
+	Action  string                 `json:"action"`
+	Blurred bool                   `json:"blurred"`
+	User    *models.ProfileSummary `json:"user"`
+}
+
+func (LikeEvent) FrameType() string { return "like_received" }
+
+// SuperlikeEvent is LikeEvent for a superlike.
+type SuperlikeEvent LikeEvent
+
+func (SuperlikeEvent) FrameType() string { return "superlike" }
+
+// MatchEvent is sent to both users when a match is made.
+type MatchEvent struct {
+	MatchID   int64     `json:"match_id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"` // собеседник
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (MatchEvent) FrameType() string { return "match" }
+
+// UnmatchedEvent tells the user the other side removed the match.
+type UnmatchedEvent struct {
+	MatchID int64 `json:"match_id"`
+	ChatID  int64 `json:"chat_id"`
+}
+
+func (UnmatchedEvent) FrameType() string { return "unmatched" }
+
+// MatchExpiringEvent warns that a match without messages expires soon.
+type MatchExpiringEvent struct {
+	MatchID   int64     `json:"match_id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (MatchExpiringEvent) FrameType() string { return "match_expiring" }
+
+// MatchExpiredEvent tells the user a match expired.
+type MatchExpiredEvent struct {
+	MatchID int64 `json:"match_id"`
+	ChatID  int64 `json:"chat_id"`
+	UserID  int64 `json:"user_id"`
+}
+
+func (MatchExpiredEvent) FrameType() string { return "match_expired" }
+
+// PresenceEvent tells the user that a match came online or went offline.
+type PresenceEvent struct {
+	UserID   int64      `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"` // when going offline
+}
+
+func (PresenceEvent) FrameType() string { return "presence" }
+
+// Resync is sent first on a connection resumed with a last_seq the event
+// log no longer reaches back to: the client missed events that won't be
+// replayed and must reload its state over REST.
+type Resync struct{}
+
+func (Resync) FrameType() string { return "resync" }
+
+// Ack confirms a client frame that carried a request id. Frames that
+// create something are always acked, with the result.
+type Ack struct {
+	ID      string      `json:"id,omitempty"`
+	Message *MessageAck `json:"message,omitempty"`
+}
+
+func (Ack) FrameType() string { return "ack" }
+
+// MessageAck identifies a message stored for a send_message frame.
+type MessageAck struct {
+	ID        int64     `json:"id"`
+	ClientID  string    `json:"client_id"`
+	ChatID    int64     `json:"chat_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Error codes.
+const (
+	CodeBadFrame    = "bad_frame"    // not a JSON object or no type
+	CodeUnknownType = "unknown_type" // type the server doesn't handle
+	CodeInvalid     = "invalid"      // fields missing or malformed
+	CodeInternal    = "internal"     // the server failed to handle the frame
+)
+
+// Error rejects a client frame. ID is the frame's request id, if it had one.
+type Error struct {
+	ID      string `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (Error) FrameType() string { return "error" }
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+// ServerEvents are the events the server pushes to users. They are logged
+// and carry "seq".
+var ServerEvents = []Def{
+	{func() Frame { return &MessageEvent{} }, "A new message in one of the user's chats."},
+	{func() Frame { return &MessageEditedEvent{} }, "The sender edited a message."},
+	{func() Frame { return &MessageDeletedEvent{} }, "A message was deleted for everyone, or for the user on another device."},
+	{func() Frame { return &DeliveredEvent{} }, "A message the user sent reached the receiver's device."},
+	{func() Frame { return &ReadChatEvent{} }, "The other participant read the chat."},
+	{func() Frame { return &ReadMessagesEvent{} }, "The other participant read the listed messages."},
+	{func() Frame { return &LikeEvent{} }, "Someone liked the user."},
+	{func() Frame { return &SuperlikeEvent{} }, "Someone superliked the user."},
+	{func() Frame { return &MatchEvent{} }, "A new match."},
+	{func() Frame { return &UnmatchedEvent{} }, "The other side removed the match."},
+	{func() Frame { return &MatchExpiringEvent{} }, "A match without messages expires soon."},
+	{func() Frame { return &MatchExpiredEvent{} }, "A match without messages expired."},
+}
+
+// EphemeralEvents are pushed live only: they are neither logged nor
+// numbered, and missed ones are not replayed.
+var EphemeralEvents = []Def{
+	{func() Frame { return &TypingEvent{} }, "The other participant is typing."},
+	{func() Frame { return &PresenceEvent{} }, "A match came online or went offline."},
+}
+
+// Replies answer a single client frame, or the resume of a connection, on
+// the connection it came from.
+var Replies = []Def{
+	{func() Frame { return &Ack{} }, "The frame with this request id, or a send_message, was handled."},
+	{func() Frame { return &Error{} }, "The frame was rejected."},
+	{func() Frame { return &Resync{} }, "Events after last_seq were dropped from the log; reload state over REST before applying the replayed events."},
+}
@@ -0,0 +1,88 @@
+package realtime
+
+import (
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	pingInterval = 30 * time.Second
+	writeWait    = 5 * time.Second
+)
+
+// SlowConsumerPolicy decides what happens when a connection's send buffer
+// is full because the client doesn't read fast enough.
+type SlowConsumerPolicy int
+
+const (
+	// DisconnectSlow closes the connection; the client reconnects and
+	// reloads what it missed.
+	DisconnectSlow SlowConsumerPolicy = iota
+	// DropMessages discards the event that didn't fit and keeps the
+	// connection.
+	DropMessages
+)
+
+// enqueue hands a frame to the connection's write pump without blocking.
+func (c *Connection) enqueue(msg []byte) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return
+	default:
+	}
+
+	metrics.WSDropped.Add(1)
+	if c.hub.SlowConsumer == DropMessages {
+		logging.Log.Warnf("ws: send buffer full, dropping event for user=%d conn=%s", c.UserID, c.ID)
+		return
+	}
+	logging.Log.Warnf("ws: send buffer full, disconnecting slow user=%d conn=%s", c.UserID, c.ID)
+	metrics.WSSlowDisconnects.Add(1)
+	c.hub.Remove(c)
+}
+
+// writePump is the only goroutine writing to the socket. It sends queued
+// frames and periodic pings until the connection is closed or a write
+// fails.
+func (c *Connection) writePump() {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				logging.Log.Warnf("ws: write failed for user=%d conn=%s: %v", c.UserID, c.ID, err)
+				c.hub.Remove(c)
+				return
+			}
+			metrics.WSSent.Add(1)
+
+		case <-ticker.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				logging.Log.Warnf("ws: ping failed for user=%d conn=%s: %v", c.UserID, c.ID, err)
+				c.hub.Remove(c)
+				return
+			}
+
+		case <-c.done:
+			c.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			return
+		}
+	}
+}
@@ -30,9 +30,7 @@ type InMemorySessionStore struct {
 }
 
 func NewInMemorySessionStore() *InMemorySessionStore {
-    s := &InMemorySessionStore{m: make(map[string]inMemoryEntry)}
-    go s.cleaner()
-    return s
+    return &InMemorySessionStore{m: make(map[string]inMemoryEntry)}
 }
 
 func (s *InMemorySessionStore) Set(token string, userID int64, ttl time.Duration) error {
@@ -66,19 +64,37 @@ func (s *InMemorySessionStore) Delete(token string) error {
     return nil
 }
 
-func (s *InMemorySessionStore) cleaner() {
-    ticker := time.NewTicker(1 * time.Minute)
-    defer ticker.Stop()
-    for range ticker.C {
-        now := time.Now()
-        s.mu.Lock()
-        for k, v := range s.m {
-            if now.After(v.expiresAt) {
-                delete(s.m, k)
-            }
+// Prune drops tokens that expired before now and returns how many were
+// removed. Expired tokens are never returned by Get; pruning only frees
+// memory, so main runs it periodically with StartPruning.
+func (s *InMemorySessionStore) Prune(now time.Time) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    n := 0
+    for k, v := range s.m {
+        if now.After(v.expiresAt) {
+            delete(s.m, k)
+            n++
         }
-        s.mu.Unlock()
     }
+    return n
+}
+
+// StartPruning prunes the store every interval until ctx is done. Each
+// process holds its own tokens, hence a local ticker.
+func (s *InMemorySessionStore) StartPruning(ctx context.Context, interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case now := <-ticker.C:
+                s.Prune(now)
+            }
+        }
+    }()
 }
 
 // Redis-backed implementation ----------------------------------------------
@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+	"dating-backend/internal/realtime"
+	"dating-backend/internal/realtime/protocol"
+)
+
+// MatchExpiry expires matches nobody has written in within After of the
+// match. WarnBefore ahead of that both users get a "match_expiring" event.
+// With Rematch the pair can meet again in discovery, otherwise they stay
+// apart permanently.
+type MatchExpiry struct {
+	After      time.Duration
+	WarnBefore time.Duration
+	Rematch    bool
+}
+
+// Run warns about and expires matches as of now. It is a Handler, meant to
+// be registered with Cron.
+func (e *MatchExpiry) Run(now time.Time, _ *models.Job) error {
+	if e.WarnBefore > 0 && e.WarnBefore < e.After {
+		pairs, err := data_access.GetMatchesToWarn(now.Add(e.WarnBefore - e.After))
+		if err != nil {
+			return err
+		}
+		for _, p := range pairs {
+			expiresAt := p.CreatedAt.Add(e.After)
+			for _, u := range [][2]int64{{p.User1ID, p.User2ID}, {p.User2ID, p.User1ID}} {
+				realtime.ChatHub.SendToUser(u[0], protocol.MatchExpiringEvent{
+					MatchID:   p.ID,
+					ChatID:    p.ChatID,
+					UserID:    u[1],
+					ExpiresAt: expiresAt,
+				})
+			}
+			if err := data_access.MarkMatchWarned(p.ID, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	pairs, err := data_access.ExpireMatches(now.Add(-e.After), now, e.Rematch)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		for _, u := range [][2]int64{{p.User1ID, p.User2ID}, {p.User2ID, p.User1ID}} {
+			realtime.ChatHub.SendToUser(u[0], protocol.MatchExpiredEvent{
+				MatchID: p.ID,
+				ChatID:  p.ChatID,
+				UserID:  u[1],
+			})
+		}
+	}
+	if len(pairs) > 0 {
+		logging.Log.Infow("scheduler: expired matches", "count", len(pairs))
+	}
+	return nil
+}
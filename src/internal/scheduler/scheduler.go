@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+)
+
+// Clock tells the scheduler and its jobs what time it is. Tests pass a fake
+// clock and drive the scheduler with RunDue.
+type Clock interface {
+	Now() time.Time
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+// WallClock is the real time.
+var WallClock Clock = wallClock{}
+
+// Handler runs one job. now is the scheduler's clock at the time of the
+// run. A returned error (or a panic) schedules a retry with backoff.
+type Handler func(now time.Time, job *models.Job) error
+
+// recurring is a job kind enqueued on a schedule.
+type recurring struct {
+	kind     string
+	schedule Schedule
+	next     time.Time
+}
+
+// Scheduler runs jobs from a durable queue in-process. Jobs can be
+// enqueued for later or registered as recurring with Cron. A claimed job is
+// hidden from other workers for Visibility; if the worker dies, the job
+// becomes visible again and is retried. Failed jobs are retried with
+// Backoff until MaxAttempts, then moved to the dead-letter table.
+type Scheduler struct {
+	Clock        Clock
+	Store        Store
+	Visibility   time.Duration
+	MaxAttempts  int
+	Backoff      func(attempt int) time.Duration
+	PollInterval time.Duration
+
+	mu        sync.Mutex
+	handlers  map[string]Handler
+	recurring []*recurring
+}
+
+// New creates a scheduler with default retry settings.
+func New(clock Clock, store Store) *Scheduler {
+	return &Scheduler{
+		Clock:        clock,
+		Store:        store,
+		Visibility:   5 * time.Minute,
+		MaxAttempts:  5,
+		Backoff:      ExponentialBackoff,
+		PollInterval: time.Second,
+		handlers:     make(map[string]Handler),
+	}
+}
+
+// Default is the scheduler started by main.
+var Default = New(WallClock, SQLiteStore{})
+
+// ExponentialBackoff waits 30s before the second attempt and doubles the
+// delay for each further one, up to an hour.
+func ExponentialBackoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
+
+// Handle registers the handler for a job kind.
+func (s *Scheduler) Handle(kind string, h Handler) {
+	s.mu.Lock()
+	s.handlers[kind] = h
+	s.mu.Unlock()
+}
+
+// Cron registers h for kind and enqueues it on the given schedule (see
+// ParseSchedule). Each occurrence is a queued job like any other, so it is
+// retried on failure; it is enqueued once even if several workers share
+// the queue.
+func (s *Scheduler) Cron(kind, spec string, h Handler) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	s.Handle(kind, h)
+	s.mu.Lock()
+	// an interval job is due at once, in the occurrence under way
+	first := s.Clock.Now()
+	if e, ok := schedule.(every); ok {
+		first = first.Truncate(time.Duration(e))
+	} else {
+		first = schedule.Next(first)
+	}
+	s.recurring = append(s.recurring, &recurring{kind: kind, schedule: schedule, next: first})
+	s.mu.Unlock()
+	return nil
+}
+
+// Enqueue queues a job of kind to run at runAt. payload is encoded as JSON
+// and may be nil.
+func (s *Scheduler) Enqueue(kind string, payload any, runAt time.Time) (int64, error) {
+	job := &models.Job{Kind: kind, RunAt: runAt, MaxAttempts: s.MaxAttempts}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return 0, fmt.Errorf("scheduler: encode %s payload: %w", kind, err)
+		}
+		job.Payload = b
+	}
+	return s.Store.Enqueue(job, "")
+}
+
+// RunDue enqueues recurring jobs that came due, then runs queued jobs until
+// none is due. It returns how many jobs ran.
+func (s *Scheduler) RunDue() int {
+	s.enqueueRecurring()
+
+	ran := 0
+	for {
+		now := s.Clock.Now()
+		job, err := s.Store.Claim(now, now.Add(s.Visibility))
+		if err != nil {
+			logging.Log.Errorw("scheduler: claim failed", "err", err)
+			return ran
+		}
+		if job == nil {
+			return ran
+		}
+		s.run(job)
+		ran++
+	}
+}
+
+func (s *Scheduler) enqueueRecurring() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock.Now()
+	for _, r := range s.recurring {
+		if r.next.IsZero() || now.Before(r.next) {
+			continue
+		}
+		job := &models.Job{Kind: r.kind, RunAt: r.next, MaxAttempts: s.MaxAttempts}
+		key := r.kind + ":" + strconv.FormatInt(r.next.Unix(), 10)
+		if _, err := s.Store.Enqueue(job, key); err != nil {
+			logging.Log.Errorw("scheduler: enqueue recurring job failed", "kind", r.kind, "err", err)
+			continue
+		}
+		r.next = r.schedule.Next(now)
+	}
+}
+
+func (s *Scheduler) run(job *models.Job) {
+	s.mu.Lock()
+	h, ok := s.handlers[job.Kind]
+	s.mu.Unlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler for job kind %q", job.Kind)
+	} else {
+		err = s.call(h, job)
+	}
+
+	now := s.Clock.Now()
+	if err == nil {
+		if err := s.Store.Complete(job.ID); err != nil {
+			logging.Log.Errorw("scheduler: complete failed", "job", job.ID, "err", err)
+		}
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		logging.Log.Errorw("scheduler: job failed permanently", "job", job.ID, "kind", job.Kind, "attempts", job.Attempts, "err", err)
+		if err := s.Store.Bury(job.ID, err.Error(), now); err != nil {
+			logging.Log.Errorw("scheduler: bury failed", "job", job.ID, "err", err)
+		}
+		return
+	}
+	logging.Log.Warnw("scheduler: job failed, retrying", "job", job.ID, "kind", job.Kind, "attempt", job.Attempts, "err", err)
+	if err := s.Store.Retry(job.ID, now.Add(s.Backoff(job.Attempts)), err.Error()); err != nil {
+		logging.Log.Errorw("scheduler: retry failed", "job", job.ID, "err", err)
+	}
+}
+
+// call runs the handler, turning a panic into an error.
+func (s *Scheduler) call(h Handler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(s.Clock.Now(), job)
+}
+
+// Start runs due jobs every PollInterval until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.PollInterval)
+		defer ticker.Stop()
+
+		s.RunDue()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.RunDue()
+			}
+		}
+	}()
+}
@@ -0,0 +1,274 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dating-backend/internal/logging"
+	"dating-backend/internal/models"
+
+	"go.uber.org/zap"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// memStore is an in-memory Store with the same claim semantics as SQLite.
+// keys are the unique keys of queued jobs and used every key enqueued, like
+// the unique_key column of jobs and the job_keys table.
+type memStore struct {
+	jobs   []*memJob
+	dead   []models.Job
+	keys   map[string]bool
+	used   map[string]bool
+	nextID int64
+}
+
+type memJob struct {
+	models.Job
+	key         string
+	lockedUntil time.Time
+}
+
+func newMemStore() *memStore { return &memStore{keys: map[string]bool{}, used: map[string]bool{}} }
+
+func (m *memStore) Enqueue(j *models.Job, key string) (int64, error) {
+	if key != "" {
+		if m.keys[key] || m.used[key] {
+			return 0, nil
+		}
+		m.keys[key], m.used[key] = true, true
+	}
+	m.nextID++
+	job := *j
+	job.ID = m.nextID
+	m.jobs = append(m.jobs, &memJob{Job: job, key: key})
+	return job.ID, nil
+}
+
+func (m *memStore) Claim(now, lockedUntil time.Time) (*models.Job, error) {
+	for _, j := range m.jobs {
+		if j.RunAt.After(now) || j.lockedUntil.After(now) {
+			continue
+		}
+		j.lockedUntil = lockedUntil
+		j.Attempts++
+		job := j.Job
+		return &job, nil
+	}
+	return nil, nil
+}
+
+func (m *memStore) remove(id int64) *memJob {
+	for i, j := range m.jobs {
+		if j.ID == id {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			delete(m.keys, j.key)
+			return j
+		}
+	}
+	return nil
+}
+
+func (m *memStore) Complete(id int64) error {
+	m.remove(id)
+	return nil
+}
+
+func (m *memStore) Retry(id int64, runAt time.Time, lastError string) error {
+	for _, j := range m.jobs {
+		if j.ID == id {
+			j.RunAt, j.LastError, j.lockedUntil = runAt, lastError, time.Time{}
+		}
+	}
+	return nil
+}
+
+func (m *memStore) Bury(id int64, lastError string, now time.Time) error {
+	if j := m.remove(id); j != nil {
+		j.LastError = lastError
+		j.FailedAt = &now
+		m.dead = append(m.dead, j.Job)
+	}
+	return nil
+}
+
+func newTestScheduler() (*Scheduler, *fakeClock, *memStore) {
+	logging.Log = zap.NewNop().Sugar()
+	clock := &fakeClock{now: time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)}
+	store := newMemStore()
+	return New(clock, store), clock, store
+}
+
+func TestDelayedJob(t *testing.T) {
+	s, clock, _ := newTestScheduler()
+
+	var got string
+	s.Handle("greet", func(now time.Time, job *models.Job) error {
+		got = string(job.Payload)
+		return nil
+	})
+	if _, err := s.Enqueue("greet", map[string]string{"name": "anna"}, clock.now.Add(time.Hour)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	if n := s.RunDue(); n != 0 {
+		t.Fatalf("expected delayed job to wait, ran %d", n)
+	}
+	clock.now = clock.now.Add(time.Hour)
+	if n := s.RunDue(); n != 1 {
+		t.Fatalf("expected job to run when due, ran %d", n)
+	}
+	if got != `{"name":"anna"}` {
+		t.Fatalf("unexpected payload %q", got)
+	}
+}
+
+func TestRetryWithBackoffThenDeadLetter(t *testing.T) {
+	s, clock, store := newTestScheduler()
+	s.MaxAttempts = 3
+
+	calls := 0
+	s.Handle("flaky", func(now time.Time, job *models.Job) error {
+		calls++
+		if calls == 2 {
+			panic("boom")
+		}
+		return errors.New("still failing")
+	})
+	s.Enqueue("flaky", nil, clock.now)
+
+	s.RunDue()
+	clock.now = clock.now.Add(ExponentialBackoff(1) - time.Second)
+	if n := s.RunDue(); n != 0 {
+		t.Fatalf("expected retry to wait for backoff, ran %d", n)
+	}
+	clock.now = clock.now.Add(time.Second)
+	s.RunDue()
+	clock.now = clock.now.Add(ExponentialBackoff(2))
+	s.RunDue()
+
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+	if len(store.jobs) != 0 || len(store.dead) != 1 {
+		t.Fatalf("expected job dead-lettered, queue=%d dead=%d", len(store.jobs), len(store.dead))
+	}
+	if store.dead[0].LastError != "still failing" {
+		t.Fatalf("unexpected last error %q", store.dead[0].LastError)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	s, clock, store := newTestScheduler()
+	s.Enqueue("slow", nil, clock.now)
+
+	// another worker claimed the job and died
+	if job, _ := store.Claim(clock.now, clock.now.Add(s.Visibility)); job == nil {
+		t.Fatalf("expected to claim job")
+	}
+
+	ran := 0
+	s.Handle("slow", func(now time.Time, job *models.Job) error {
+		ran++
+		return nil
+	})
+	s.RunDue()
+	if ran != 0 {
+		t.Fatalf("expected claimed job to stay hidden")
+	}
+	clock.now = clock.now.Add(s.Visibility)
+	s.RunDue()
+	if ran != 1 {
+		t.Fatalf("expected job to reappear after visibility timeout")
+	}
+}
+
+func TestCronEnqueuesOncePerOccurrence(t *testing.T) {
+	s, clock, _ := newTestScheduler()
+
+	var runs []time.Time
+	if err := s.Cron("tick", "*/15 * * * *", func(now time.Time, job *models.Job) error {
+		runs = append(runs, job.RunAt)
+		return nil
+	}); err != nil {
+		t.Fatalf("cron: %v", err)
+	}
+
+	for i := 0; i < 40; i++ {
+		clock.now = clock.now.Add(time.Minute)
+		s.RunDue()
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected runs at 12:15 and 12:30, got %v", runs)
+	}
+	if runs[0].Minute() != 15 || runs[1].Minute() != 30 {
+		t.Fatalf("unexpected run times %v", runs)
+	}
+}
+
+func TestEveryEnqueuesOncePerIntervalAcrossWorkers(t *testing.T) {
+	logging.Log = zap.NewNop().Sugar()
+	store := newMemStore()
+	var runs []time.Time
+	tick := func(now time.Time, job *models.Job) error {
+		runs = append(runs, job.RunAt)
+		return nil
+	}
+
+	// two workers sharing the queue, started a few minutes apart
+	clockA := &fakeClock{now: time.Date(2025, 3, 10, 12, 2, 0, 0, time.UTC)}
+	clockB := &fakeClock{now: time.Date(2025, 3, 10, 12, 7, 0, 0, time.UTC)}
+	a, b := New(clockA, store), New(clockB, store)
+	a.Cron("tick", "@every 15m", tick)
+	a.RunDue()
+	b.Cron("tick", "@every 15m", tick)
+	for i := 0; i < 30; i++ {
+		clockA.now = clockA.now.Add(time.Minute)
+		clockB.now = clockB.now.Add(time.Minute)
+		a.RunDue()
+		b.RunDue()
+	}
+	if len(runs) != 3 {
+		t.Fatalf("expected runs at 12:00, 12:15 and 12:30, got %v", runs)
+	}
+	for i, r := range runs {
+		if r.Minute() != 15*i {
+			t.Fatalf("unexpected run times %v", runs)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2025, 3, 10, 12, 7, 30, 0, time.UTC) // Monday
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90s", time.Date(2025, 3, 10, 12, 9, 0, 0, time.UTC)},
+		{"@every 15m", time.Date(2025, 3, 10, 12, 15, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2025, 3, 10, 12, 8, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, 3, 11, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * 6,7", time.Date(2025, 3, 15, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2025, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		sched, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if got := sched.Next(from); !got.Equal(c.want) {
+			t.Errorf("%s: next = %v, want %v", c.spec, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every -1s"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"time"
+
+	data_access "dating-backend/internal/data-access"
+	"dating-backend/internal/models"
+)
+
+// Store is the durable job queue. Claim must be atomic so that two workers
+// never hold the same job at once.
+type Store interface {
+	// Enqueue adds a job; a non-empty uniqueKey that was enqueued before,
+	// even by a job that has completed since, is ignored and reported with
+	// id 0.
+	Enqueue(job *models.Job, uniqueKey string) (int64, error)
+	// Claim takes the oldest due job and hides it until lockedUntil, or
+	// returns nil when nothing is due.
+	Claim(now, lockedUntil time.Time) (*models.Job, error)
+	Complete(id int64) error
+	Retry(id int64, runAt time.Time, lastError string) error
+	// Bury moves the job to the dead-letter table.
+	Bury(id int64, lastError string, now time.Time) error
+}
+
+// SQLite implementation ----------------------------------------------------
+type SQLiteStore struct{}
+
+func (SQLiteStore) Enqueue(job *models.Job, uniqueKey string) (int64, error) {
+	return data_access.EnqueueJob(job, uniqueKey)
+}
+
+func (SQLiteStore) Claim(now, lockedUntil time.Time) (*models.Job, error) {
+	return data_access.ClaimJob(now, lockedUntil)
+}
+
+func (SQLiteStore) Complete(id int64) error {
+	return data_access.CompleteJob(id)
+}
+
+func (SQLiteStore) Retry(id int64, runAt time.Time, lastError string) error {
+	return data_access.RetryJob(id, runAt, lastError)
+}
+
+func (SQLiteStore) Bury(id int64, lastError string, now time.Time) error {
+	return data_access.BuryJob(id, lastError, now)
+}
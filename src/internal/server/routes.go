@@ -5,6 +5,7 @@ import (
 	"time"
 
 	handlers "dating-backend/internal/handlers"
+	"dating-backend/internal/metrics"
 	middleware "dating-backend/internal/middleware"
 
 	"github.com/go-chi/chi/v5"
@@ -34,7 +35,15 @@ func NewRouter() http.Handler {
         r.Post("/register", http.HandlerFunc(handlers.RegisterHandler))
         r.Post("/login", 	http.HandlerFunc(handlers.LoginHandler))
         r.Post("/refresh", 	http.HandlerFunc(handlers.RefreshHandler))
+		r.Get("/profile/attributes", http.HandlerFunc(handlers.GetAttributeSchemaHandler))
+		r.Get("/interests", 			http.HandlerFunc(handlers.GetInterestsHandler))
+		r.Get("/prompts", 				http.HandlerFunc(handlers.GetPromptsHandler))
 		r.Get("/ws/chat", 	http.HandlerFunc(handlers.ChatWebSocketHandler))
+		// signed, expiring links stand in for authentication
+		r.Get("/files/attachments/{id}", 		http.HandlerFunc(handlers.ServeAttachmentFileHandler))
+		r.Get("/files/attachments/{id}/thumb", 	http.HandlerFunc(handlers.ServeAttachmentFileHandler))
+		r.Get("/files/photos/{name}", 			http.HandlerFunc(handlers.ServePhotoFileHandler))
+		r.Get("/files/verifications/{id}", 		http.HandlerFunc(handlers.ServeVerificationFileHandler))
 
     })
 
@@ -47,19 +56,66 @@ func NewRouter() http.Handler {
 		
 		r.Get("/me", 				http.HandlerFunc(handlers.GetMyProfileHandler))
 		r.Put("/me", 				http.HandlerFunc(handlers.UpdateProfileHandler))
+		r.Get("/me/passport", 		http.HandlerFunc(handlers.GetPassportHandler))
+		r.Put("/me/passport", 		http.HandlerFunc(handlers.SetPassportHandler))
+		r.Delete("/me/passport", 	http.HandlerFunc(handlers.ClearPassportHandler))
+		r.Get("/me/photos", 		http.HandlerFunc(handlers.GetMyPhotosHandler))
+		r.Post("/me/photos", 		http.HandlerFunc(handlers.UploadPhotoHandler))
+		r.Put("/me/photos/order", 	http.HandlerFunc(handlers.ReorderPhotosHandler))
+		r.Put("/me/photos/{id}/primary", http.HandlerFunc(handlers.SetPrimaryPhotoHandler))
+		r.Delete("/me/photos/{id}", http.HandlerFunc(handlers.DeletePhotoHandler))
+		r.Get("/me/verification", 	http.HandlerFunc(handlers.GetMyVerificationHandler))
+		r.Post("/me/verification", 	http.HandlerFunc(handlers.SubmitVerificationHandler))
+		r.Post("/me/verification/start", http.HandlerFunc(handlers.StartVerificationHandler))
+		r.Get("/me/quota", 			http.HandlerFunc(handlers.GetMyQuotaHandler))
 		r.Get("/user/{id}", 		http.HandlerFunc(handlers.GetUserHandler))
 		r.Get("/followers", 		http.HandlerFunc(handlers.GetMyFollowersHandler))
+		r.Get("/likes", 			http.HandlerFunc(handlers.GetLikesInboxHandler))
+		r.Get("/likes/count", 		http.HandlerFunc(handlers.GetLikesCountHandler))
+		r.Post("/likes/seen", 		http.HandlerFunc(handlers.MarkLikesSeenHandler))
+		r.Get("/matches", 			http.HandlerFunc(handlers.GetMatchesHandler))
+		r.Delete("/matches/{id}", 	http.HandlerFunc(handlers.UnmatchHandler))
 		
 		r.Post("/swipe", 			http.HandlerFunc(handlers.SwipeHandler))
+		r.Post("/swipe/rewind", 	http.HandlerFunc(handlers.RewindHandler))
+		r.Get("/me/swipes", 		http.HandlerFunc(handlers.GetMySwipesHandler))
+		r.Get("/me/swipes/stats", 	http.HandlerFunc(handlers.GetMySwipeStatsHandler))
+		r.Delete("/me/swipes/{targetId}", http.HandlerFunc(handlers.UndoDislikeHandler))
 		r.Get("/profiles/search", 	http.HandlerFunc(handlers.GetSwipeCandidatesHandler))
+		r.Get("/places/autocomplete", http.HandlerFunc(handlers.PlacesAutocompleteHandler))
+		r.Get("/presence", 			http.HandlerFunc(handlers.GetPresenceHandler))
 
 		r.Post("/ws/start", 		http.HandlerFunc(handlers.StartWebSocketSession))
 		r.Post("/messages/send", 	http.HandlerFunc(handlers.SendMessageHandler))
 		r.Post("/messages/read", 	http.HandlerFunc(handlers.MarkMessagesReadHandler))
+		r.Patch("/messages/{id}", 	http.HandlerFunc(handlers.EditMessageHandler))
+		r.Delete("/messages/{id}", 	http.HandlerFunc(handlers.DeleteMessageHandler))
+		r.Post("/uploads", 			http.HandlerFunc(handlers.UploadHandler))
+		r.Get("/attachments/{id}", 	http.HandlerFunc(handlers.GetAttachmentHandler))
 		r.Get("/chats", 			http.HandlerFunc(handlers.GetChatsHandler))
 		r.Post("/chat/read", 		http.HandlerFunc(handlers.MarkChatMessagesAsReadHandler))
 		r.Get("/chat/messages/{chatId}", 	http.HandlerFunc(handlers.GetChatMessagesHandler))
     })
 
+    // Admin routes - authenticated users listed in middleware.AdminUserIDs
+    r.Group(func(r chi.Router) {
+        r.Use(middleware.ChiAuthMiddleware)
+        r.Use(middleware.ChiAdminMiddleware)
+
+		r.Get("/admin/jobs/failed", 			http.HandlerFunc(handlers.GetFailedJobsHandler))
+		r.Post("/admin/jobs/failed/{id}/retry", http.HandlerFunc(handlers.RetryFailedJobHandler))
+		r.Get("/admin/messages/{id}/history", 	http.HandlerFunc(handlers.GetMessageHistoryHandler))
+		r.Get("/admin/verifications", 			http.HandlerFunc(handlers.GetVerificationQueueHandler))
+		r.Post("/admin/verifications/{id}/decision", http.HandlerFunc(handlers.DecideVerificationHandler))
+		r.Get("/admin/interests", 				http.HandlerFunc(handlers.GetAdminInterestsHandler))
+		r.Post("/admin/interests", 				http.HandlerFunc(handlers.CreateInterestHandler))
+		r.Put("/admin/interests/{id}", 			http.HandlerFunc(handlers.UpdateInterestHandler))
+		r.Delete("/admin/interests/{id}", 		http.HandlerFunc(handlers.DeleteInterestHandler))
+		r.Get("/admin/prompts", 				http.HandlerFunc(handlers.GetAdminPromptsHandler))
+		r.Post("/admin/prompts", 				http.HandlerFunc(handlers.CreatePromptHandler))
+		r.Put("/admin/prompts/{id}", 			http.HandlerFunc(handlers.UpdatePromptHandler))
+		r.Method(http.MethodGet, "/admin/metrics", metrics.Handler())
+    })
+
     return r
 }
@@ -0,0 +1,24 @@
+// Package storage keeps uploaded files (blobs) and signs the URLs they are
+// downloaded from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a blob doesn't exist.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// Store is where blobs live. Keys are slash-separated paths chosen by the
+// server, such as "attachments/3f1c2a9e.jpg".
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Default is the store used by the handlers. Main replaces it according to
+// configuration.
+var Default Store = &Local{Dir: "uploads"}
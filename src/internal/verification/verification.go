@@ -0,0 +1,97 @@
+// Package verification decides whether the person on a profile's photos is
+// the one using the account. The user takes a selfie in a pose picked by
+// the server, which stands in for a liveness check, and an Engine compares
+// it with the profile photos.
+package verification
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Statuses of a verification request.
+const (
+	Requested = "requested" // pose handed out, selfie not sent yet
+	Pending   = "pending"   // selfie waits for a decision
+	Approved  = "approved"
+	Rejected  = "rejected"
+)
+
+// Pose is something the user has to do on the selfie.
+type Pose struct {
+	Code        string `json:"code"`
+	Instruction string `json:"instruction"`
+}
+
+// Poses are handed out at random, so a selfie can't be prepared in advance.
+var Poses = []Pose{
+	{"thumbs_up", "Покажите большой палец вверх"},
+	{"peace_sign", "Покажите знак «мир» двумя пальцами"},
+	{"hand_on_head", "Положите ладонь на макушку"},
+	{"touch_nose", "Коснитесь носа указательным пальцем"},
+	{"three_fingers", "Покажите три пальца у щеки"},
+}
+
+// RandomPose picks a pose for a new request.
+func RandomPose() Pose {
+	return Poses[rand.IntN(len(Poses))]
+}
+
+// PoseByCode returns the pose with the code.
+func PoseByCode(code string) (Pose, bool) {
+	for _, p := range Poses {
+		if p.Code == code {
+			return p, true
+		}
+	}
+	return Pose{}, false
+}
+
+// Request is a submitted selfie to decide on.
+type Request struct {
+	ID     int64
+	UserID int64
+	Pose   string
+	// SelfieKey and PhotoKeys are blob keys in storage.Default: the selfie
+	// and the medium size of every profile photo.
+	SelfieKey string
+	PhotoKeys []string
+}
+
+// Result is an engine's verdict. Status is Approved, Rejected, or Pending
+// when the engine leaves the request to moderators.
+type Result struct {
+	Status string
+	Reason string // shown to the user when rejected
+}
+
+// Engine decides verification requests.
+type Engine interface {
+	Review(ctx context.Context, req Request) (Result, error)
+}
+
+// Manual leaves every request to the moderators' review queue.
+type Manual struct{}
+
+func (Manual) Review(context.Context, Request) (Result, error) {
+	return Result{Status: Pending}, nil
+}
+
+// Default is the engine new selfies are sent to.
+var Default Engine = Manual{}
+
+// Decide asks the engine about a request. An engine that fails or answers
+// nonsense must not lose the request, so it is left for manual review then;
+// the error is returned for logging.
+func Decide(ctx context.Context, e Engine, req Request) (Result, error) {
+	res, err := e.Review(ctx, req)
+	if err != nil {
+		return Result{Status: Pending}, err
+	}
+	switch res.Status {
+	case Approved, Rejected, Pending:
+		return res, nil
+	}
+	return Result{Status: Pending}, fmt.Errorf("verification: engine returned status %q", res.Status)
+}
@@ -0,0 +1,60 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeEngine answers every request with a fixed result and remembers what
+// it was asked.
+type fakeEngine struct {
+	res  Result
+	err  error
+	seen []Request
+}
+
+func (f *fakeEngine) Review(_ context.Context, req Request) (Result, error) {
+	f.seen = append(f.seen, req)
+	return f.res, f.err
+}
+
+func TestDecide(t *testing.T) {
+	req := Request{ID: 3, UserID: 7, Pose: "thumbs_up", SelfieKey: "verifications/x.jpg", PhotoKeys: []string{"photos/a_medium.jpg"}}
+
+	cases := []struct {
+		name    string
+		engine  *fakeEngine
+		status  string
+		wantErr bool
+	}{
+		{"approved", &fakeEngine{res: Result{Status: Approved}}, Approved, false},
+		{"rejected", &fakeEngine{res: Result{Status: Rejected, Reason: "pose doesn't match"}}, Rejected, false},
+		{"undecided", &fakeEngine{res: Result{Status: Pending}}, Pending, false},
+		{"engine error", &fakeEngine{err: errors.New("model unavailable")}, Pending, true},
+		{"unknown status", &fakeEngine{res: Result{Status: "maybe"}}, Pending, true},
+	}
+	for _, c := range cases {
+		res, err := Decide(context.Background(), c.engine, req)
+		if res.Status != c.status || (err != nil) != c.wantErr {
+			t.Errorf("%s: got %+v, %v", c.name, res, err)
+		}
+		if len(c.engine.seen) != 1 || c.engine.seen[0].SelfieKey != req.SelfieKey {
+			t.Errorf("%s: engine got %+v", c.name, c.engine.seen)
+		}
+	}
+
+	if res, err := Decide(context.Background(), Manual{}, req); res.Status != Pending || err != nil {
+		t.Errorf("manual: got %+v, %v", res, err)
+	}
+}
+
+func TestPoses(t *testing.T) {
+	p := RandomPose()
+	if got, ok := PoseByCode(p.Code); !ok || got != p {
+		t.Fatalf("pose %q not found", p.Code)
+	}
+	if _, ok := PoseByCode("unknown"); ok {
+		t.Fatal("expected unknown pose not found")
+	}
+}